@@ -5,6 +5,7 @@ go 1.16
 require (
 	github.com/btcsuite/btcd v0.22.0-beta // indirect
 	github.com/ethereum/go-ethereum v1.10.16
+	github.com/gorilla/websocket v1.4.2
 	github.com/panjf2000/ants/v2 v2.4.7
 	github.com/snail-plus/goutil v0.4.4
 	golang.org/x/crypto v0.0.0-20211209193657-4570a0811e8b // indirect
@@ -0,0 +1,139 @@
+package tx
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"strings"
+)
+
+// toBlockNumArg nil 表示 latest, -1 表示 pending
+func toBlockNumArg(number *big.Int) string {
+	if number == nil {
+		return "latest"
+	}
+	if number.Cmp(big.NewInt(-1)) == 0 {
+		return "pending"
+	}
+	return hexutil.EncodeBig(number)
+}
+
+func toCallArg(msg ethereum.CallMsg) interface{} {
+	arg := map[string]interface{}{
+		"from": msg.From,
+		"to":   msg.To,
+	}
+	if len(msg.Data) > 0 {
+		arg["data"] = hexutil.Bytes(msg.Data)
+	}
+	if msg.Value != nil {
+		arg["value"] = (*hexutil.Big)(msg.Value)
+	}
+	if msg.Gas != 0 {
+		arg["gas"] = hexutil.Uint64(msg.Gas)
+	}
+	if msg.GasPrice != nil {
+		arg["gasPrice"] = (*hexutil.Big)(msg.GasPrice)
+	}
+	return arg
+}
+
+func toFilterArg(q ethereum.FilterQuery) (interface{}, error) {
+	arg := map[string]interface{}{
+		"address": q.Addresses,
+		"topics":  q.Topics,
+	}
+	if q.BlockHash != nil {
+		if q.FromBlock != nil || q.ToBlock != nil {
+			return nil, errors.New("cannot specify both BlockHash and FromBlock/ToBlock")
+		}
+		arg["blockHash"] = *q.BlockHash
+		return arg, nil
+	}
+
+	if q.FromBlock == nil {
+		arg["fromBlock"] = "0x0"
+	} else {
+		arg["fromBlock"] = toBlockNumArg(q.FromBlock)
+	}
+	arg["toBlock"] = toBlockNumArg(q.ToBlock)
+	return arg, nil
+}
+
+// requestKey 请求的唯一标识, 用于请求合并和缓存
+func requestKey(method string, args []interface{}) (string, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	return method + strings.ToLower(string(data)), nil
+}
+
+// rpcTransaction eth_getTransactionByHash 返回的交易及所在区块
+type rpcTransaction struct {
+	tx          *types.Transaction
+	BlockNumber *string         `json:"blockNumber,omitempty"`
+	BlockHash   *common.Hash    `json:"blockHash,omitempty"`
+	From        *common.Address `json:"from,omitempty"`
+}
+
+func (tx *rpcTransaction) UnmarshalJSON(msg []byte) error {
+	if err := json.Unmarshal(msg, &tx.tx); err != nil {
+		return err
+	}
+
+	type extraInfo rpcTransaction
+	return json.Unmarshal(msg, (*extraInfo)(tx))
+}
+
+// nullRaw 结果为 null 时 rpc 客户端得到的是空的 RawMessage, 还原成 null 以便按指针解析
+func nullRaw(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return json.RawMessage("null")
+	}
+	return raw
+}
+
+// decodeTransaction 解析 eth_getTransactionByHash 的结果, 结果为 null 时返回 ethereum.NotFound
+func decodeTransaction(raw json.RawMessage) (*types.Transaction, bool, error) {
+	var tx *rpcTransaction
+	if err := json.Unmarshal(raw, &tx); err != nil {
+		return nil, false, err
+	}
+	if tx == nil || tx.tx == nil {
+		return nil, false, ethereum.NotFound
+	}
+	if _, r, _ := tx.tx.RawSignatureValues(); r == nil {
+		return nil, false, errors.New("server returned transaction without signature")
+	}
+	return tx.tx, tx.BlockNumber == nil, nil
+}
+
+// decodeBlock 解析包含完整交易的 eth_getBlockBy* 结果, 不会加载叔块
+func decodeBlock(raw json.RawMessage) (*types.Block, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, ethereum.NotFound
+	}
+
+	var head *types.Header
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Transactions []*rpcTransaction `json:"transactions"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+
+	txs := make([]*types.Transaction, len(body.Transactions))
+	for i, tx := range body.Transactions {
+		txs[i] = tx.tx
+	}
+	return types.NewBlockWithHeader(head).WithBody(txs, nil), nil
+}
@@ -0,0 +1,236 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+)
+
+const (
+	defaultMaxBatchSize = 100
+)
+
+type BigIntResult struct {
+	Value *big.Int
+	Err   error
+}
+
+type Uint64Result struct {
+	Value uint64
+	Err   error
+}
+
+type BytesResult struct {
+	Value []byte
+	Err   error
+}
+
+type ReceiptResult struct {
+	Receipt *types.Receipt
+	Err     error
+}
+
+type TransactionResult struct {
+	Tx        *types.Transaction
+	IsPending bool
+	Err       error
+}
+
+type BlockResult struct {
+	Block *types.Block
+	Err   error
+}
+
+type batchItem struct {
+	method string
+	args   []interface{}
+	// 解析结果, 为 nil 时只记录错误
+	decode func(raw json.RawMessage) error
+	setErr func(err error)
+}
+
+// Batch JSON-RPC 批量请求, 添加请求后调用 Execute, 每个请求的结果和错误写入对应的返回值
+type Batch struct {
+	client *Web3Client
+	items  []*batchItem
+}
+
+// NewBatch 创建批量请求, 超过 WithMaxBatchSize 的部分会自动拆分成多个批次
+func (e *Web3Client) NewBatch() *Batch {
+	return &Batch{client: e}
+}
+
+// Len 当前请求数
+func (b *Batch) Len() int {
+	return len(b.items)
+}
+
+func (b *Batch) add(method string, decode func(raw json.RawMessage) error, setErr func(err error), args ...interface{}) {
+	b.items = append(b.items, &batchItem{
+		method: method,
+		args:   args,
+		decode: decode,
+		setErr: setErr,
+	})
+}
+
+func (b *Batch) BalanceAt(account common.Address, blockNumber *big.Int) *BigIntResult {
+	result := &BigIntResult{}
+	b.add("eth_getBalance", func(raw json.RawMessage) error {
+		var value hexutil.Big
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		result.Value = (*big.Int)(&value)
+		return nil
+	}, func(err error) { result.Err = err }, account, toBlockNumArg(blockNumber))
+	return result
+}
+
+func (b *Batch) NonceAt(account common.Address, blockNumber *big.Int) *Uint64Result {
+	result := &Uint64Result{}
+	b.add("eth_getTransactionCount", func(raw json.RawMessage) error {
+		var value hexutil.Uint64
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		result.Value = uint64(value)
+		return nil
+	}, func(err error) { result.Err = err }, account, toBlockNumArg(blockNumber))
+	return result
+}
+
+func (b *Batch) CodeAt(account common.Address, blockNumber *big.Int) *BytesResult {
+	result := &BytesResult{}
+	b.add("eth_getCode", bytesDecoder(result), func(err error) { result.Err = err }, account, toBlockNumArg(blockNumber))
+	return result
+}
+
+func (b *Batch) StorageAt(account common.Address, key common.Hash, blockNumber *big.Int) *BytesResult {
+	result := &BytesResult{}
+	b.add("eth_getStorageAt", bytesDecoder(result), func(err error) { result.Err = err }, account, key, toBlockNumArg(blockNumber))
+	return result
+}
+
+func (b *Batch) CallContract(msg ethereum.CallMsg, blockNumber *big.Int) *BytesResult {
+	result := &BytesResult{}
+	b.add("eth_call", bytesDecoder(result), func(err error) { result.Err = err }, toCallArg(msg), toBlockNumArg(blockNumber))
+	return result
+}
+
+func (b *Batch) TransactionReceipt(txHash common.Hash) *ReceiptResult {
+	result := &ReceiptResult{}
+	b.add("eth_getTransactionReceipt", func(raw json.RawMessage) error {
+		var receipt *types.Receipt
+		if err := json.Unmarshal(raw, &receipt); err != nil {
+			return err
+		}
+		if receipt == nil {
+			return ethereum.NotFound
+		}
+		result.Receipt = receipt
+		return nil
+	}, func(err error) { result.Err = err }, txHash)
+	return result
+}
+
+func (b *Batch) TransactionByHash(txHash common.Hash) *TransactionResult {
+	result := &TransactionResult{}
+	b.add("eth_getTransactionByHash", func(raw json.RawMessage) (err error) {
+		result.Tx, result.IsPending, err = decodeTransaction(raw)
+		return err
+	}, func(err error) { result.Err = err }, txHash)
+	return result
+}
+
+// BlockByNumber 返回包含完整交易的区块, 不包含叔块
+func (b *Batch) BlockByNumber(number *big.Int) *BlockResult {
+	result := &BlockResult{}
+	b.add("eth_getBlockByNumber", blockDecoder(result), func(err error) { result.Err = err }, toBlockNumArg(number), true)
+	return result
+}
+
+// BlockByHash 返回包含完整交易的区块, 不包含叔块
+func (b *Batch) BlockByHash(hash common.Hash) *BlockResult {
+	result := &BlockResult{}
+	b.add("eth_getBlockByHash", blockDecoder(result), func(err error) { result.Err = err }, hash, true)
+	return result
+}
+
+func bytesDecoder(result *BytesResult) func(raw json.RawMessage) error {
+	return func(raw json.RawMessage) error {
+		var value hexutil.Bytes
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+		result.Value = value
+		return nil
+	}
+}
+
+func blockDecoder(result *BlockResult) func(raw json.RawMessage) error {
+	return func(raw json.RawMessage) (err error) {
+		result.Block, err = decodeBlock(raw)
+		return err
+	}
+}
+
+// Execute 按最大批次大小拆分并发送, 返回的 error 表示有批次整体失败 (此时该批次所有请求的 Err 都是这个错误),
+// 单个请求的错误只写入对应返回值的 Err
+func (b *Batch) Execute(ctx context.Context) error {
+	maxBatchSize := b.client.options.maxBatchSize
+	if maxBatchSize <= 0 {
+		maxBatchSize = defaultMaxBatchSize
+	}
+
+	var firstErr error
+	for start := 0; start < len(b.items); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(b.items) {
+			end = len(b.items)
+		}
+
+		if err := b.client.batchCall(ctx, b.items[start:end]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (e *Web3Client) batchCall(ctx context.Context, items []*batchItem) error {
+	elems := make([]rpc.BatchElem, len(items))
+	raws := make([]json.RawMessage, len(items))
+	methods := make([]string, len(items))
+	for i, item := range items {
+		methods[i] = item.method
+		elems[i] = rpc.BatchElem{
+			Method: item.method,
+			Args:   item.args,
+			Result: &raws[i],
+		}
+	}
+
+	err := e.callBatch(ctx, methods, func(ep *endpoint) error {
+		for i := range elems {
+			elems[i].Error = nil
+		}
+		return ep.rpcClient.BatchCallContext(ctx, elems)
+	})
+
+	for i, item := range items {
+		itemErr := err
+		if itemErr == nil {
+			itemErr = elems[i].Error
+		}
+		if itemErr == nil && item.decode != nil {
+			itemErr = item.decode(nullRaw(raws[i]))
+		}
+		item.setErr(itemErr)
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package tx
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	node := newTestNode(t, 56, "56")
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL, WithMaxBatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := client.NewBatch()
+	accounts := []common.Address{
+		common.HexToAddress("0x0000000100000000000000000000000000000000"),
+		common.HexToAddress("0x0000000200000000000000000000000000000000"),
+		{},
+	}
+	var balances []*BigIntResult
+	for _, account := range accounts {
+		balances = append(balances, batch.BalanceAt(account, nil))
+	}
+	nonce := batch.NonceAt(accounts[0], nil)
+	code := batch.CodeAt(accounts[0], nil)
+	storage := batch.StorageAt(accounts[0], common.Hash{}, nil)
+	block := batch.BlockByHash(common.Hash{})
+
+	requests := node.Requests()
+	if err := batch.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 8 个请求按 WithMaxBatchSize(2) 拆成 4 个 HTTP 请求
+	if sent := node.Requests() - requests; sent != 4 {
+		t.Fatalf("expected 4 batch requests, got %d", sent)
+	}
+
+	for i, balance := range balances[:2] {
+		if balance.Err != nil || balance.Value.Int64() != int64(i+1) {
+			t.Fatalf("unexpected balance %v %v", balance.Value, balance.Err)
+		}
+	}
+	if balances[2].Err == nil {
+		t.Fatal("expected error for zero address")
+	}
+	if nonce.Err != nil || nonce.Value != 7 {
+		t.Fatalf("unexpected nonce %d %v", nonce.Value, nonce.Err)
+	}
+	if code.Err != nil || common.BytesToAddress(code.Value) != accounts[0] {
+		t.Fatalf("unexpected code %x %v", code.Value, code.Err)
+	}
+	if storage.Err != nil || len(storage.Value) != 32 {
+		t.Fatalf("unexpected storage %x %v", storage.Value, storage.Err)
+	}
+	// 测试节点实现了 eth_getStorageAt (ForkBackend 需要), 单个请求失败的情况改用未实现的 eth_getBlockByHash 验证
+	if block.Err == nil {
+		t.Fatal("expected method not found error for eth_getBlockByHash")
+	}
+}
@@ -0,0 +1,297 @@
+package tx
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheFinalityDepth = 12
+	defaultHeadPollInterval   = time.Second
+)
+
+// CacheStats 缓存命中统计
+type CacheStats struct {
+	Hits       uint64
+	Misses     uint64
+	LatestHits uint64
+	Evictions  uint64
+	Size       int
+	Head       uint64
+}
+
+type cacheEntry struct {
+	key   string
+	value json.RawMessage
+}
+
+// lruCache 固定容量的 LRU
+type lruCache struct {
+	capacity  int
+	items     map[string]*list.Element
+	order     *list.List
+	evictions uint64
+}
+
+func newLruCache(capacity int) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *lruCache) get(key string) (json.RawMessage, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).value, true
+}
+
+func (c *lruCache) add(key string, value json.RawMessage) {
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*cacheEntry).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, value: value})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+		c.evictions++
+	}
+}
+
+// responseCache 不可变数据 (指定区块哈希 已确认区块 的结果) 放入 LRU,
+// latest 相关的结果只缓存到最新区块变化 (新区块或重组) 为止, 没有 watchHead 跟踪最新区块时不缓存
+type responseCache struct {
+	mutex         sync.Mutex
+	immutable     *lruCache
+	latest        map[string]json.RawMessage
+	trackLatest   bool
+	head          uint64
+	headHash      common.Hash
+	finalityDepth uint64
+
+	hits       uint64
+	misses     uint64
+	latestHits uint64
+}
+
+func newResponseCache(size int, finalityDepth uint64, trackLatest bool) *responseCache {
+	return &responseCache{
+		immutable:     newLruCache(size),
+		latest:        make(map[string]json.RawMessage),
+		trackLatest:   trackLatest,
+		finalityDepth: finalityDepth,
+	}
+}
+
+func (c *responseCache) get(key string) (json.RawMessage, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if value, ok := c.immutable.get(key); ok {
+		c.hits++
+		return value, true
+	}
+	if value, ok := c.latest[key]; ok {
+		c.hits++
+		c.latestHits++
+		return value, true
+	}
+	c.misses++
+	return nil, false
+}
+
+// finalized 区块已经超过确认深度, 结果不会再因为重组改变
+func (c *responseCache) finalized(number uint64) bool {
+	return c.head > 0 && number+c.finalityDepth <= c.head
+}
+
+func (c *responseCache) put(method string, args []interface{}, key string, value json.RawMessage) {
+	// null 结果 (交易未找到 回执未生成) 很快会变化, 不缓存
+	if len(value) == 0 || string(value) == "null" {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch c.classify(method, args, value) {
+	case cacheImmutable:
+		c.immutable.add(key, value)
+	case cacheLatest:
+		// 没有最新区块的来源时无法判断何时失效
+		if !c.trackLatest {
+			return
+		}
+		// 区块号长时间没有更新时避免无限增长
+		if len(c.latest) >= c.immutable.capacity {
+			c.latest = make(map[string]json.RawMessage)
+		}
+		c.latest[key] = value
+	}
+}
+
+type cacheKind int
+
+const (
+	cacheNone cacheKind = iota
+	cacheLatest
+	cacheImmutable
+)
+
+// classify 根据方法 区块参数 以及结果所在区块判断缓存方式, 调用方持有锁
+func (c *responseCache) classify(method string, args []interface{}, value json.RawMessage) cacheKind {
+	switch method {
+	case "eth_chainId", "eth_getBlockByHash":
+		return cacheImmutable
+	case "eth_blockNumber", "eth_gasPrice":
+		return cacheLatest
+	case "eth_getCode", "eth_call", "eth_getStorageAt", "eth_getBalance", "eth_getTransactionCount", "eth_getBlockByNumber":
+		if len(args) == 0 {
+			return cacheNone
+		}
+		var tag interface{}
+		if method == "eth_getBlockByNumber" {
+			tag = args[0]
+		} else {
+			tag = args[len(args)-1]
+		}
+		return c.classifyBlockTag(tag)
+	case "eth_getTransactionReceipt", "eth_getTransactionByHash":
+		var result struct {
+			BlockNumber *hexutil.Big `json:"blockNumber"`
+		}
+		if err := json.Unmarshal(value, &result); err != nil || result.BlockNumber == nil {
+			// pending 交易
+			return cacheNone
+		}
+		if c.finalized(result.BlockNumber.ToInt().Uint64()) {
+			return cacheImmutable
+		}
+		return cacheLatest
+	}
+	return cacheNone
+}
+
+func (c *responseCache) classifyBlockTag(tag interface{}) cacheKind {
+	str, ok := tag.(string)
+	if !ok {
+		return cacheNone
+	}
+
+	switch str {
+	case "latest":
+		return cacheLatest
+	case "pending", "earliest":
+		return cacheNone
+	}
+
+	number, err := hexutil.DecodeUint64(str)
+	if err != nil {
+		return cacheNone
+	}
+	if c.finalized(number) {
+		return cacheImmutable
+	}
+	return cacheLatest
+}
+
+// observeHead 最新区块哈希变化 (新区块或重组) 时清空 latest 缓存
+func (c *responseCache) observeHead(number uint64, hash common.Hash) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if number > c.head {
+		c.head = number
+	}
+	if hash == c.headHash {
+		return
+	}
+	c.headHash = hash
+	c.latest = make(map[string]json.RawMessage)
+}
+
+// advanceHead 只知道区块号时只用于判断区块是否确认, 不知道哈希无法判断重组, 不清空 latest 缓存
+func (c *responseCache) advanceHead(number uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if number > c.head {
+		c.head = number
+	}
+}
+
+func (c *responseCache) stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return CacheStats{
+		Hits:       c.hits,
+		Misses:     c.misses,
+		LatestHits: c.latestHits,
+		Evictions:  c.immutable.evictions,
+		Size:       c.immutable.order.Len() + len(c.latest),
+		Head:       c.head,
+	}
+}
+
+// watchHead 定时获取最新区块, 用于清空 latest 缓存以及判断区块是否已确认
+func (e *Web3Client) watchHead(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.closeCh:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(ContextWithPriority(context.Background(), PriorityLow), interval)
+		var head struct {
+			Number hexutil.Uint64 `json:"number"`
+			Hash   common.Hash    `json:"hash"`
+		}
+		err := e.call(ctx, "eth_getBlockByNumber", func(ep *endpoint) error {
+			return ep.rpcClient.CallContext(ctx, &head, "eth_getBlockByNumber", "latest", false)
+		})
+		cancel()
+		if err != nil {
+			log.Printf("watch head error: %s", err.Error())
+			continue
+		}
+		e.cache.observeHead(uint64(head.Number), head.Hash)
+	}
+}
+
+// CacheStats 返回缓存命中统计, 未开启缓存时返回零值
+func (e *Web3Client) CacheStats() CacheStats {
+	if e.cache == nil {
+		return CacheStats{}
+	}
+	return e.cache.stats()
+}
+
+// InvalidateLatest 手动清空 latest 缓存
+func (e *Web3Client) InvalidateLatest() {
+	if e.cache == nil {
+		return
+	}
+
+	e.cache.mutex.Lock()
+	defer e.cache.mutex.Unlock()
+	e.cache.latest = make(map[string]json.RawMessage)
+}
@@ -0,0 +1,73 @@
+package tx
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"sync/atomic"
+	"testing"
+)
+
+func TestResponseCache(t *testing.T) {
+	node := newTestNode(t, 56, "56")
+	ctx := context.Background()
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL, WithCache(2), WithHeadPollInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.cache.advanceHead(100)
+
+	account := common.HexToAddress("0x7b4452dd6c38597fa9364ac8905c27ea44425832")
+	expectCalls := func(expected int64, msg string) {
+		t.Helper()
+		if calls := atomic.LoadInt64(&node.eth.codeCalls); calls != expected {
+			t.Fatalf("%s, got %d calls", msg, calls)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		code, err := client.CodeAt(ctx, account, big.NewInt(50))
+		if err != nil || common.BytesToAddress(code) != account {
+			t.Fatalf("unexpected code %x %v", code, err)
+		}
+	}
+	expectCalls(1, "finalized block should be cached")
+
+	// 没有跟踪最新区块时 latest 结果不缓存
+	_, _ = client.CodeAt(ctx, account, nil)
+	_, _ = client.CodeAt(ctx, account, nil)
+	expectCalls(3, "latest result should not be cached without head polling")
+
+	// 模拟 watchHead
+	client.cache.trackLatest = true
+	_, _ = client.CodeAt(ctx, account, nil)
+	_, _ = client.CodeAt(ctx, account, nil)
+	expectCalls(4, "latest result should be cached until next head")
+
+	headHash := common.HexToHash("0x01")
+	client.cache.observeHead(101, headHash)
+	_, _ = client.CodeAt(ctx, account, nil)
+	expectCalls(5, "new head should invalidate latest cache")
+	_, _ = client.CodeAt(ctx, account, nil)
+	client.cache.observeHead(101, headHash)
+	_, _ = client.CodeAt(ctx, account, nil)
+	expectCalls(5, "unchanged head should keep latest cache")
+	// 健康检查只知道区块号, 不清空 latest 缓存
+	client.cache.advanceHead(101)
+	_, _ = client.CodeAt(ctx, account, nil)
+	expectCalls(5, "head number without hash should keep latest cache")
+
+	// 同一高度的区块被重组
+	client.cache.observeHead(101, common.HexToHash("0x02"))
+	_, _ = client.CodeAt(ctx, account, nil)
+	expectCalls(6, "reorged head should invalidate latest cache")
+
+	_, _ = client.CodeAt(ctx, account, big.NewInt(95))
+	_, _ = client.CodeAt(ctx, account, big.NewInt(95))
+	expectCalls(7, "unconfirmed block should be cached until next head")
+
+	stats := client.CacheStats()
+	if stats.Hits != 7 || stats.Misses != 7 || stats.Head != 101 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
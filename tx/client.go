@@ -2,6 +2,10 @@ package tx
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -15,45 +19,94 @@ import (
 	"log"
 	"math/big"
 	"strings"
+	"sync"
 	"time"
 )
 
+// balanceOf(address)
+var balanceOfSelector = hexutil.MustDecode("0x70a08231")
+
+// ErrChainIdMismatch 节点 chainId 与配置的期望 chainId 不一致时拒绝签名
+var ErrChainIdMismatch = errors.New("chain id mismatch")
+
 type Web3Client struct {
-	ethClient  *ethclient.Client
-	rpcClient  *rpc.Client
-	chainId    *big.Int
-	gethClient *gethclient.Client
+	endpoints []*endpoint
+	chainId   *big.Int
+	networkId *big.Int
+
+	options   *clientOptions
+	coalescer *coalescer
+	cache     *responseCache
+	mutex     sync.Mutex
+	// 串行确定 chainId, 避免并发请求重复连接所有节点
+	establishMutex sync.Mutex
+	closeCh        chan struct{}
+	closeOnce      sync.Once
+
+	// 最近一次检测 baseFee 的时间以及是否已检测到 baseFee
+	dynamicFeeCheckTime int64
+	dynamicFee          int32
 }
 
 func NewWeb3Client(nodeUrl string) *Web3Client {
-
-	rpcClient, err := rpc.Dial(nodeUrl)
+	client, err := NewWeb3ClientWithOptions(context.Background(), nodeUrl)
 	if err != nil {
 		panic(err)
 	}
+	return client
+}
+
+// NewWeb3ClientWithOptions 连接节点并解析 chainId, 失败时返回 error 而不是 panic
+func NewWeb3ClientWithOptions(ctx context.Context, nodeUrl string, opts ...Option) (*Web3Client, error) {
+	return NewWeb3PoolClient(ctx, []string{nodeUrl}, opts...)
+}
+
+// resolveChainId 通过 eth_chainId 获取签名用的 chainId, net_version 只作为 NetworkID 的缓存.
+// 两者不同是正常的 (如 ETC 的 chainId 61 networkId 1), 节点的校验见 checkChainId
+func resolveChainId(ctx context.Context, ethClient *ethclient.Client) (*big.Int, *big.Int, error) {
+	chainId, err := ethClient.ChainID(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("eth_chainId: %w", err)
+	}
 
-	ethClient := ethclient.NewClient(rpcClient)
-	networkID, err := ethClient.NetworkID(context.Background())
+	networkId, err := ethClient.NetworkID(ctx)
 	if err != nil {
-		panic(err)
+		return nil, nil, fmt.Errorf("net_version: %w", err)
 	}
+	return chainId, networkId, nil
+}
 
-	return &Web3Client{
-		ethClient:  ethClient,
-		rpcClient:  rpcClient,
-		chainId:    networkID,
-		gethClient: gethclient.New(rpcClient),
+// checkChainId 节点的 eth_chainId 必须与 WithChainId WithExpectedChainId 配置的值一致
+func checkChainId(chainId *big.Int, options *clientOptions) error {
+	for _, configured := range []*big.Int{options.chainId, options.expectedChainId} {
+		if configured != nil && configured.Cmp(chainId) != 0 {
+			return fmt.Errorf("%w: expected %s, node reports %s", ErrChainIdMismatch, configured, chainId)
+		}
 	}
+	return nil
 }
 
+// GetEthClient 返回最健康节点的 ethclient, 没有可用节点时返回 nil
 func (e *Web3Client) GetEthClient() *ethclient.Client {
-	return e.ethClient
+	ep, err := e.bestEndpoint(context.Background())
+	if err != nil {
+		log.Printf("connect error: %s", err.Error())
+		return nil
+	}
+	return ep.ethClient
 }
 
+// GetGEthClient 返回最健康节点的 gethclient, 没有可用节点时返回 nil
 func (e *Web3Client) GetGEthClient() *gethclient.Client {
-	return e.gethClient
+	ep, err := e.bestEndpoint(context.Background())
+	if err != nil {
+		log.Printf("connect error: %s", err.Error())
+		return nil
+	}
+	return ep.gethClient
 }
 
+// SendTransaction 多节点时并行广播到所有节点, 已签名交易重复发送是幂等的, 失败时按重试策略重试
 func (e *Web3Client) SendTransaction(ctx context.Context, tx *types.Transaction) (string, error) {
 	data, err := tx.MarshalBinary()
 	if err != nil {
@@ -61,37 +114,251 @@ func (e *Web3Client) SendTransaction(ctx context.Context, tx *types.Transaction)
 	}
 
 	var result string
-	err = e.rpcClient.CallContext(ctx, &result, "eth_sendRawTransaction", hexutil.Encode(data))
+	var resultMutex sync.Mutex
+	err = e.broadcast(ctx, "eth_sendRawTransaction", func(ep *endpoint) error {
+		var hash string
+		err := ep.rpcClient.CallContext(ctx, &hash, "eth_sendRawTransaction", hexutil.Encode(data))
+		if err != nil && isKnownTransactionError(err) {
+			// 重试或其他节点已经收到同一笔交易
+			hash, err = tx.Hash().Hex(), nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resultMutex.Lock()
+		result = hash
+		resultMutex.Unlock()
+		return nil
+	})
+
+	resultMutex.Lock()
+	defer resultMutex.Unlock()
 	return result, err
 }
 
 func (e *Web3Client) GetGasPrice(ctx context.Context) (*big.Int, error) {
-	return e.ethClient.SuggestGasPrice(ctx)
+	var gasPrice *big.Int
+	err := e.call(ctx, "eth_gasPrice", func(ep *endpoint) (err error) {
+		gasPrice, err = ep.ethClient.SuggestGasPrice(ctx)
+		return err
+	})
+	return gasPrice, err
 }
 
 func (e *Web3Client) GetNonce(ctx context.Context, walletAddress string) (uint64, error) {
-	return e.ethClient.NonceAt(ctx, common.HexToAddress(walletAddress), big.NewInt(-1))
+	raw, err := e.rawCall(ctx, "eth_getTransactionCount", common.HexToAddress(walletAddress), "pending")
+	if err != nil {
+		return 0, err
+	}
+
+	var nonce hexutil.Uint64
+	err = json.Unmarshal(raw, &nonce)
+	return uint64(nonce), err
+}
+
+// rawCall 返回原始结果, 开启请求合并时相同请求共享结果, 不同请求合并成 batch
+// 开启缓存时先查缓存
+func (e *Web3Client) rawCall(ctx context.Context, method string, args ...interface{}) (json.RawMessage, error) {
+	if e.cache == nil {
+		return e.uncachedCall(ctx, method, args...)
+	}
+
+	key, err := requestKey(method, args)
+	if err != nil {
+		return nil, err
+	}
+	if raw, ok := e.cache.get(key); ok {
+		return raw, nil
+	}
+
+	raw, err := e.uncachedCall(ctx, method, args...)
+	if err == nil {
+		e.cache.put(method, args, key, raw)
+	}
+	return raw, err
+}
+
+func (e *Web3Client) uncachedCall(ctx context.Context, method string, args ...interface{}) (json.RawMessage, error) {
+	var raw json.RawMessage
+	var err error
+	if e.coalescer != nil {
+		raw, err = e.coalescer.do(ctx, method, args...)
+	} else {
+		err = e.call(ctx, method, func(ep *endpoint) error {
+			return ep.rpcClient.CallContext(ctx, &raw, method, args...)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nullRaw(raw), nil
+}
+
+// CallContract 实现 bind.ContractCaller, 合约绑定可以直接使用 Web3Client
+func (e *Web3Client) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	raw, err := e.rawCall(ctx, "eth_call", toCallArg(msg), toBlockNumArg(blockNumber))
+	if err != nil {
+		return nil, err
+	}
+
+	var result hexutil.Bytes
+	err = json.Unmarshal(raw, &result)
+	return result, err
 }
 
+// CodeAt 实现 bind.ContractCaller
+func (e *Web3Client) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	raw, err := e.rawCall(ctx, "eth_getCode", account, toBlockNumArg(blockNumber))
+	if err != nil {
+		return nil, err
+	}
+
+	var result hexutil.Bytes
+	err = json.Unmarshal(raw, &result)
+	return result, err
+}
+
+func (e *Web3Client) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	raw, err := e.rawCall(ctx, "eth_getBalance", account, toBlockNumArg(blockNumber))
+	if err != nil {
+		return nil, err
+	}
+
+	var result hexutil.Big
+	err = json.Unmarshal(raw, &result)
+	return (*big.Int)(&result), err
+}
+
+func (e *Web3Client) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	raw, err := e.rawCall(ctx, "eth_getTransactionCount", account, toBlockNumArg(blockNumber))
+	if err != nil {
+		return 0, err
+	}
+
+	var result hexutil.Uint64
+	err = json.Unmarshal(raw, &result)
+	return uint64(result), err
+}
+
+func (e *Web3Client) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	raw, err := e.rawCall(ctx, "eth_getStorageAt", account, key, toBlockNumArg(blockNumber))
+	if err != nil {
+		return nil, err
+	}
+
+	var result hexutil.Bytes
+	err = json.Unmarshal(raw, &result)
+	return result, err
+}
+
+// FilterLogs eth_getLogs, 实现 bind.ContractFilterer 的查询部分
+func (e *Web3Client) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	arg, err := toFilterArg(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []types.Log
+	err = e.call(ctx, "eth_getLogs", func(ep *endpoint) error {
+		return ep.rpcClient.CallContext(ctx, &logs, "eth_getLogs", arg)
+	})
+	return logs, err
+}
+
+// BalanceOf 查询 ERC20 余额
+func (e *Web3Client) BalanceOf(ctx context.Context, token common.Address, owner common.Address) (*big.Int, error) {
+	data := append(common.CopyBytes(balanceOfSelector), common.LeftPadBytes(owner.Bytes(), 32)...)
+	result, err := e.CallContract(ctx, ethereum.CallMsg{To: &token, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) < 32 {
+		return nil, fmt.Errorf("invalid balanceOf result: %x", result)
+	}
+	return new(big.Int).SetBytes(result[:32]), nil
+}
+
+// ChainID 返回签名使用的 chainId (eth_chainId)
+func (e *Web3Client) ChainID() (*big.Int, error) {
+	return e.getChainId(context.Background())
+}
+
+func (e *Web3Client) getChainId(ctx context.Context) (*big.Int, error) {
+	e.mutex.Lock()
+	chainId := e.chainId
+	e.mutex.Unlock()
+	if chainId != nil {
+		return new(big.Int).Set(chainId), nil
+	}
+
+	if _, err := e.bestEndpoint(ctx); err != nil {
+		return nil, err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return new(big.Int).Set(e.chainId), nil
+}
+
+// NetworkID 返回 net_version, 连接时已解析则直接返回缓存值
 func (e *Web3Client) NetworkID() (*big.Int, error) {
-	return e.ethClient.NetworkID(context.Background())
+	ctx := context.Background()
+	var networkId *big.Int
+	err := e.call(ctx, "net_version", func(ep *endpoint) (err error) {
+		if ep.networkId != nil {
+			networkId = ep.networkId
+			return nil
+		}
+		networkId, err = ep.ethClient.NetworkID(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Set(networkId), nil
 }
 
+// GetSigner 没有可用节点时返回 nil
 func (e *Web3Client) GetSigner() types.Signer {
-	signer := types.LatestSignerForChainID(e.chainId)
+	signer, err := e.signer(context.Background())
+	if err != nil {
+		log.Printf("get signer error: %s", err.Error())
+		return nil
+	}
 	return signer
 }
 
+// signer 使用节点的 chainId, 连接时已经与配置的值校验过
+func (e *Web3Client) signer(ctx context.Context) (types.Signer, error) {
+	chainId, err := e.getChainId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return types.LatestSignerForChainID(chainId), nil
+}
+
 func (e *Web3Client) TransactionByHash(ctx context.Context, hashStr string) (tx *types.Transaction, isPending bool, err error) {
-	hash := common.HexToHash(hashStr)
-	return e.ethClient.TransactionByHash(ctx, hash)
+	return e.transactionByHash(ctx, common.HexToHash(hashStr))
+}
+
+func (e *Web3Client) transactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error) {
+	raw, err := e.rawCall(ctx, "eth_getTransactionByHash", hash)
+	if err != nil {
+		return nil, false, err
+	}
+	return decodeTransaction(raw)
 }
 
 func (e *Web3Client) TraceTransaction(ctx context.Context, hashStr string) (result interface{}, err error) {
-	err = e.rpcClient.CallContext(ctx, &result, "debug_traceTransaction", common.HexToHash(hashStr))
+	err = e.call(ctx, "debug_traceTransaction", func(ep *endpoint) error {
+		return ep.rpcClient.CallContext(ctx, &result, "debug_traceTransaction", common.HexToHash(hashStr))
+	})
 	return result, err
 }
 
+// SignNewTx 使用节点的 nonce 和建议的手续费签名, 交易类型由 txInfo.Type 决定,
+// 未指定 txInfo.GasLimit 时通过 eth_estimateGas 预估, 预估失败时返回 *EstimateGasError
 func (e *Web3Client) SignNewTx(ctx context.Context, txInfo TransactionInfo) (*types.Transaction, error) {
 	key, err := secure.StringToPrivateKey(txInfo.PrivateKeyStr)
 	if err != nil {
@@ -104,29 +371,76 @@ func (e *Web3Client) SignNewTx(ctx context.Context, txInfo TransactionInfo) (*ty
 		return nil, err
 	}
 
-	gasPrice, err := e.GetGasPrice(ctx)
+	txType, err := e.resolveTxType(ctx, txInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	var gasPrice, gasFeeCap, gasTipCap *big.Int
+	if txType == TxTypeDynamicFee {
+		gasFeeCap, gasTipCap, err = e.suggestDynamicFee(ctx, txInfo)
+	} else {
+		gasPrice, err = e.GetGasPrice(ctx)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	var toAddress *common.Address
-	if txInfo.To != "" {
-		tmpToAddress := common.HexToAddress(txInfo.To)
-		toAddress = &tmpToAddress
+	value := txInfo.Value
+	if value == nil {
+		value = big.NewInt(0)
 	}
 
-	tx, err := types.SignNewTx(key, e.GetSigner(), &types.LegacyTx{
-		Nonce:    nonce,
-		To:       toAddress,
-		Value:    big.NewInt(0),
-		Gas:      600000,
-		GasPrice: gasPrice,
-		Data:     txInfo.Data,
-	})
+	gas := txInfo.GasLimit
+	if gas == 0 {
+		gas, err = e.estimateGasLimit(ctx, walletAddress, txInfo, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	txData, err := newTxData(txType, txInfo, nonce, value, gas, gasPrice, gasFeeCap, gasTipCap)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := e.signer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := types.SignNewTx(key, signer, txData)
 
 	return tx, err
 }
 
+// suggestDynamicFee 未指定时 tip 使用 eth_maxPriorityFeePerGas, feeCap 使用 2 * baseFee + tip
+func (e *Web3Client) suggestDynamicFee(ctx context.Context, txInfo TransactionInfo) (*big.Int, *big.Int, error) {
+	gasTipCap := txInfo.GasTipCap
+	if gasTipCap == nil {
+		var err error
+		gasTipCap, err = e.SuggestGasTipCap(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	gasFeeCap := txInfo.GasFeeCap
+	if gasFeeCap == nil {
+		baseFee, err := e.LatestBaseFee(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		if baseFee == nil {
+			return nil, nil, errors.New("latest block has no base fee")
+		}
+		gasFeeCap = new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), gasTipCap)
+	}
+	return gasFeeCap, gasTipCap, nil
+}
+
+// SignNewTxInfo 使用指定的 nonce gasPrice gas 签名. DynamicFeeTx 未指定 GasFeeCap 时使用 gasPrice,
+// 未指定 GasTipCap 时使用 eth_maxPriorityFeePerGas, gasPrice 也为 nil 时按 suggestDynamicFee 计算
 func (e *Web3Client) SignNewTxInfo(txInfo TransactionInfo,
 	nonce uint64, gasPrice *big.Int, gas uint64) (*types.Transaction, error) {
 	key, err := secure.StringToPrivateKey(txInfo.PrivateKeyStr)
@@ -134,65 +448,146 @@ func (e *Web3Client) SignNewTxInfo(txInfo TransactionInfo,
 		return nil, err
 	}
 
-	var toAddress *common.Address
-	if txInfo.To != "" {
-		tmpToAddress := common.HexToAddress(txInfo.To)
-		toAddress = &tmpToAddress
+	ctx := context.Background()
+	txType, err := e.resolveTxType(ctx, txInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	var gasFeeCap, gasTipCap *big.Int
+	if txType == TxTypeDynamicFee {
+		// gasPrice 只作为 feeCap, 全部作为 tip 会把整个手续费付给矿工
+		if txInfo.GasFeeCap == nil {
+			txInfo.GasFeeCap = gasPrice
+		}
+		gasFeeCap, gasTipCap, err = e.suggestDynamicFee(ctx, txInfo)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	tx, err := types.SignNewTx(key, e.GetSigner(), &types.LegacyTx{
-		Nonce:    nonce,
-		To:       toAddress,
-		Value:    txInfo.Value,
-		Gas:      gas,
-		GasPrice: gasPrice,
-		Data:     txInfo.Data,
-	})
+	txData, err := newTxData(txType, txInfo, nonce, txInfo.Value, gas, gasPrice, gasFeeCap, gasTipCap)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := e.signer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := types.SignNewTx(key, signer, txData)
 
 	return tx, err
 }
 
 func (e *Web3Client) NewPendingTransactionFilter() (string, error) {
-	pendingTransactionFilter := NewPendingTransactionFilter(e.rpcClient)
-	filterID, err := pendingTransactionFilter.GetFilterId()
+	ctx := context.Background()
+	ep, err := e.bestEndpoint(ctx)
+	if err != nil {
+		return "", err
+	}
+	pendingTransactionFilter := NewPendingTransactionFilter(ep.rpcClient)
+	filterID, err := pendingTransactionFilter.GetFilterId(ctx)
 	return filterID, err
 }
 
 func (e *Web3Client) NewLogFilter(filterQuery FilterQuery) (string, error) {
-	filter := NewLogFilterFilter(e.rpcClient, filterQuery)
-	filterID, err := filter.GetFilterId()
+	ctx := context.Background()
+	ep, err := e.bestEndpoint(ctx)
+	if err != nil {
+		return "", err
+	}
+	filter := NewLogFilterFilter(ep.rpcClient, filterQuery)
+	filterID, err := filter.GetFilterId(ctx)
 	return filterID, err
 }
 
-// pending Filter 时返回 数组hash 获取LOG 时候返回Log对象  0 or nil means latest block -1 pending
-func (e *Web3Client) EthLogFlowable(filterQuery FilterQuery, pullInterval int64) chan interface{} {
-
-	filter := NewLogFilterFilter(e.rpcClient, filterQuery)
-	filter.Run(pullInterval)
-
-	logChan := filter.LogChan
-	return logChan
+// EthLogFlowable 安装 log filter 并每 pullInterval 毫秒轮询. 0 or nil means latest block -1 pending
+// ctx 取消或 Unsubscribe 后卸载 filter 并关闭输出
+func (e *Web3Client) EthLogFlowable(ctx context.Context, filterQuery FilterQuery, pullInterval int64) (*LogSubscription, error) {
+	ep, err := e.bestEndpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter := NewLogFilterFilter(ep.rpcClient, filterQuery)
+	filter.RetryPolicy = e.options.filterRetryPolicy
+	filter.failover = e.filterFailover(ep)
+	filter.logRange = e.GetLogsRange
+	sub, err := filter.Run(ctx, pullInterval)
+	if err != nil {
+		return nil, err
+	}
+	return &LogSubscription{FilterSubscription: sub, ch: filter.LogChan}, nil
 }
 
-// pending Filter 时返回 数组hash 获取LOG 时候返回Log对象  0 or nil means latest block -1 pending
-func (e *Web3Client) EthPendingFlowable(pullInterval int64) chan interface{} {
+// EthPendingFlowable 安装 pending 交易 filter 并每 pullInterval 毫秒轮询, 输出交易 hash
+// ctx 取消或 Unsubscribe 后卸载 filter 并关闭输出
+func (e *Web3Client) EthPendingFlowable(ctx context.Context, pullInterval int64) (*PendingHashSubscription, error) {
+	ep, err := e.bestEndpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter := NewPendingTransactionFilter(ep.rpcClient)
+	filter.RetryPolicy = e.options.filterRetryPolicy
+	filter.failover = e.filterFailover(ep)
+	sub, err := filter.Run(ctx, pullInterval)
+	if err != nil {
+		return nil, err
+	}
+	return &PendingHashSubscription{FilterSubscription: sub, ch: filter.HashChan}, nil
+}
 
-	filter := NewPendingTransactionFilter(e.rpcClient)
-	filter.Run(pullInterval)
+// EthPendingTransactionFlowable 同 EthPendingFlowable, 按 hash 查询完整交易后输出, 查询不到或已打包的交易被忽略
+func (e *Web3Client) EthPendingTransactionFlowable(ctx context.Context, pullInterval int64) (*PendingTxSubscription, error) {
+	hashSub, err := e.EthPendingFlowable(ctx, pullInterval)
+	if err != nil {
+		return nil, err
+	}
 
-	logChan := filter.LogChan
-	return logChan
+	ch := make(chan *types.Transaction, cap(hashSub.ch))
+	sub := hashSub.FilterSubscription
+	go func() {
+		defer close(ch)
+		for hash := range hashSub.Chan() {
+			pendingTx, isPending, err := e.transactionByHash(sub.ctx, hash)
+			if err != nil {
+				if sub.ctx.Err() == nil && !errors.Is(err, ethereum.NotFound) {
+					log.Printf("TransactionByHash error: %s", err.Error())
+				}
+				continue
+			}
+			if !isPending {
+				continue
+			}
+			select {
+			case ch <- pendingTx:
+			case <-sub.ctx.Done():
+				return
+			}
+		}
+	}()
+	return &PendingTxSubscription{FilterSubscription: sub, ch: ch}, nil
 }
 
 func (e *Web3Client) ParityAllTransactions(ctx context.Context) ([]*RPCTransaction, error) {
 	var result []*RPCTransaction
-	err := e.rpcClient.CallContext(ctx, &result, "parity_allTransactions")
+	err := e.call(ctx, "parity_allTransactions", func(ep *endpoint) error {
+		return ep.rpcClient.CallContext(ctx, &result, "parity_allTransactions")
+	})
 	return result, err
 }
 
 func (e *Web3Client) SubscribePendingTransactions(ctx context.Context, ch chan *types.Transaction, coroutines int) (*rpc.ClientSubscription, error) {
 	hashChan := make(chan common.Hash, cap(ch))
-	subscription, err := e.gethClient.SubscribePendingTransactions(ctx, hashChan)
+	var subscription *rpc.ClientSubscription
+	err := e.call(ctx, "eth_subscribe", func(ep *endpoint) (err error) {
+		subscription, err = ep.gethClient.SubscribePendingTransactions(ctx, hashChan)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	go func() {
 		// 控制并发查询
@@ -215,7 +610,7 @@ func (e *Web3Client) SubscribePendingTransactions(ctx context.Context, ch chan *
 
 					c, cancel := context.WithTimeout(ctx, 2*time.Second)
 					defer cancel()
-					pendingTx, isPending, err := e.ethClient.TransactionByHash(c, txHah)
+					pendingTx, isPending, err := e.transactionByHash(c, txHah)
 					if err != nil {
 						if !strings.Contains(err.Error(), "not found") {
 							log.Printf("TransactionByHash error: %s", err.Error())
@@ -247,7 +642,9 @@ func (e *Web3Client) SubscribePendingTransactions(ctx context.Context, ch chan *
 //	}
 func (e *Web3Client) TxPoolContent(ctx context.Context) (map[string]map[string]map[string]*RPCTransaction, error) {
 	var result map[string]map[string]map[string]*RPCTransaction
-	err := e.rpcClient.CallContext(ctx, &result, "txpool_content")
+	err := e.call(ctx, "txpool_content", func(ep *endpoint) error {
+		return ep.rpcClient.CallContext(ctx, &result, "txpool_content")
+	})
 	if err != nil {
 		return result, err
 	}
@@ -257,7 +654,9 @@ func (e *Web3Client) TxPoolContent(ctx context.Context) (map[string]map[string]m
 
 func (e *Web3Client) TxPoolContentPending(ctx context.Context, filter func(toAddress string) bool) ([]*RPCTransaction, error) {
 	var result map[string]map[string]map[string]*RPCTransaction
-	err := e.rpcClient.CallContext(ctx, &result, "txpool_content")
+	err := e.call(ctx, "txpool_content", func(ep *endpoint) error {
+		return ep.rpcClient.CallContext(ctx, &result, "txpool_content")
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -1,22 +1,486 @@
 package tx
 
 import (
-	"fmt"
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/snail-plus/eth-pkg/tx/txtest"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestClientBatchRequest(t *testing.T) {
-	client := NewWeb3Client("https://bsc-dataseed1.defibit.io/")
+	sim := txtest.NewSimChain(t)
+	client, err := NewWeb3ClientWithOptions(context.Background(), sim.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	owner, receiver := sim.Accounts[0], sim.Accounts[1]
+	token := sim.DeployErc20(owner, "Test Token", "TT", 18, big.NewInt(1000000))
 	fq := FilterQuery{
-		Addresses: []common.Address{common.HexToAddress("0x7b4452dd6c38597fa9364ac8905c27ea44425832")},
+		FromBlock: rpc.LatestBlockNumber,
+		ToBlock:   rpc.LatestBlockNumber,
+		Addresses: []common.Address{token},
+	}
+
+	sub, err := client.EthLogFlowable(context.Background(), fq, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	// 持续转账直到收到日志
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ethLog := <-sub.Chan():
+			if ethLog.Address != token || len(ethLog.Topics) != 3 || common.BytesToAddress(ethLog.Topics[2].Bytes()) != receiver.Address {
+				t.Fatalf("unexpected log %+v", ethLog)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+			sim.Erc20Transfer(owner, token, receiver.Address, big.NewInt(1))
+		case <-timeout:
+			t.Fatal("timeout waiting for log")
+		}
+	}
+}
+
+func TestClientFixtureReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "client.json")
+	sim := txtest.NewSimChain(t)
+	account := sim.Accounts[0].Address
+
+	recorder := txtest.NewFixtureTransport(t, path, txtest.FixtureRecord)
+	client, err := NewWeb3ClientWithOptions(ctx, sim.URL, WithHTTPClient(recorder.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance, err := client.BalanceAt(ctx, account, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := client.GetNonce(ctx, account.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	sim.Close()
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
 	}
 
-	flowable := client.EthLogFlowable(fq, 1000)
-	for item := range flowable {
-		ethLog := item.(types.Log)
-		fmt.Println(ethLog)
+	// 回放时节点已关闭, 结果全部来自 fixture
+	replayer := txtest.NewFixtureTransport(t, path, txtest.FixtureReplay, txtest.WithStrict())
+	client, err = NewWeb3ClientWithOptions(ctx, "http://fixture.invalid", WithHTTPClient(replayer.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if chainId, _ := client.ChainID(); chainId.Cmp(txtest.SimChainId) != 0 {
+		t.Fatalf("unexpected chainId %s", chainId)
+	}
+	replayedBalance, err := client.BalanceAt(ctx, account, nil)
+	if err != nil {
+		t.Fatal(err)
 	}
+	replayedNonce, err := client.GetNonce(ctx, account.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayedBalance.Cmp(balance) != 0 || replayedNonce != nonce {
+		t.Fatalf("replayed balance %s nonce %d, want %s %d", replayedBalance, replayedNonce, balance, nonce)
+	}
+}
 
+func TestNewWeb3ClientWithOptions(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewWeb3ClientWithOptions(ctx, "http://127.0.0.1:1", WithDialTimeout(time.Second)); err == nil {
+		t.Fatal("expected dial error")
+	}
+
+	client, err := NewWeb3ClientWithOptions(ctx, "http://127.0.0.1:1", WithLazyConnect(), WithDialTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("lazy connect should not dial: %v", err)
+	}
+	if _, err := client.GetNonce(ctx, "0x7b4452dd6c38597fa9364ac8905c27ea44425832"); err == nil {
+		t.Fatal("expected connect error on first request")
+	}
+}
+
+func TestWsEndpointHeaders(t *testing.T) {
+	node := txtest.NewMockNode(t)
+	ctx := context.Background()
+	if _, err := NewWeb3ClientWithOptions(ctx, node.WSURL, WithHeader("X-Api-Key", "secret")); !errors.Is(err, ErrWsHeaderUnsupported) {
+		t.Fatalf("expected ErrWsHeaderUnsupported, got %v", err)
+	}
+
+	if _, err := NewWeb3ClientWithOptions(ctx, node.WSURL, WithHTTPClient(new(http.Client))); !errors.Is(err, ErrHTTPOptionUnsupported) {
+		t.Fatalf("expected ErrHTTPOptionUnsupported, got %v", err)
+	}
+	// ipc 等其他协议不支持 http 的配置
+	if _, err := NewWeb3ClientWithOptions(ctx, "/tmp/geth.ipc", WithBasicAuth("user", "pass")); !errors.Is(err, ErrHTTPOptionUnsupported) {
+		t.Fatalf("expected ErrHTTPOptionUnsupported, got %v", err)
+	}
+
+	client, err := NewWeb3ClientWithOptions(ctx, node.WSURL, WithBasicAuth("user", "pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+}
+
+type testEthService struct {
+	chainId    *big.Int
+	baseFee    *big.Int
+	nonceCalls int64
+	codeCalls  int64
+
+	mutex    sync.Mutex
+	head     uint64
+	extra    []byte
+	receipts map[common.Hash]map[string]interface{}
+	// 查询这些交易的回执时延迟返回
+	receiptDelays map[common.Hash]time.Duration
+	txs           map[common.Hash]*types.Transaction
+	// 设置后 GetCode 按此返回, 否则返回地址本身
+	codes   map[common.Address][]byte
+	storage map[common.Address]map[common.Hash]common.Hash
+}
+
+func (s *testEthService) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(s.chainId)
+}
+
+func (s *testEthService) GetTransactionCount(address common.Address, block string) hexutil.Uint64 {
+	atomic.AddInt64(&s.nonceCalls, 1)
+	return 7
+}
+
+func (s *testEthService) GetBalance(address common.Address, block string) (*hexutil.Big, error) {
+	if address == (common.Address{}) {
+		return nil, errors.New("zero address")
+	}
+	return (*hexutil.Big)(new(big.Int).SetBytes(address[:4])), nil
+}
+
+func (s *testEthService) GetCode(address common.Address, block string) hexutil.Bytes {
+	atomic.AddInt64(&s.codeCalls, 1)
+	if s.codes != nil {
+		return s.codes[address]
+	}
+	return address[:]
+}
+
+func (s *testEthService) GetStorageAt(address common.Address, slot common.Hash, block string) common.Hash {
+	return s.storage[address][slot]
+}
+
+func (s *testEthService) GetBlockByNumber(number string, fullTx bool) *types.Header {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n, err := hexutil.DecodeUint64(number)
+	if err != nil {
+		n = s.head
+	}
+	return &types.Header{
+		Number:     new(big.Int).SetUint64(n),
+		Coinbase:   common.HexToAddress("0xc0ffee"),
+		Difficulty: big.NewInt(2),
+		GasLimit:   30000000,
+		BaseFee:    s.baseFee,
+		Extra:      s.extra,
+	}
+}
+
+func (s *testEthService) BlockNumber() hexutil.Uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return hexutil.Uint64(s.head)
+}
+
+// setReceipt 把交易放进当前 extra 下 number 高度的区块
+func (s *testEthService) setReceipt(hash common.Hash, number uint64) common.Hash {
+	blockHash := s.GetBlockByNumber(hexutil.EncodeUint64(number), false).Hash()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.receipts == nil {
+		s.receipts = make(map[common.Hash]map[string]interface{})
+	}
+	s.receipts[hash] = map[string]interface{}{
+		"transactionHash":   hash,
+		"blockHash":         blockHash,
+		"blockNumber":       hexutil.EncodeUint64(number),
+		"transactionIndex":  "0x0",
+		"status":            "0x1",
+		"gasUsed":           "0x5208",
+		"cumulativeGasUsed": "0x5208",
+		"effectiveGasPrice": "0x3b9aca00",
+		"logsBloom":         types.Bloom{},
+		"logs":              []*types.Log{},
+	}
+	return blockHash
+}
+
+func (s *testEthService) GetTransactionReceipt(hash common.Hash) map[string]interface{} {
+	s.mutex.Lock()
+	delay := s.receiptDelays[hash]
+	s.mutex.Unlock()
+	time.Sleep(delay)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.receipts[hash]
+}
+
+// GetTransactionByHash 和节点一样返回交易及 from
+func (s *testEthService) GetTransactionByHash(hash common.Hash) (map[string]interface{}, error) {
+	s.mutex.Lock()
+	tx := s.txs[hash]
+	s.mutex.Unlock()
+	if tx == nil {
+		return nil, nil
+	}
+
+	data, err := tx.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return nil, err
+	}
+	result["from"] = from
+	return result, nil
+}
+
+func (s *testEthService) addTransaction(tx *types.Transaction) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.txs == nil {
+		s.txs = make(map[common.Hash]*types.Transaction)
+	}
+	s.txs[tx.Hash()] = tx
+}
+
+// Call 有状态覆盖时返回 to 账户覆盖后的余额
+func (s *testEthService) Call(args map[string]interface{}, block interface{}, overrides *map[common.Address]map[string]interface{}) (hexutil.Bytes, error) {
+	if data, _ := args["data"].(string); strings.HasPrefix(data, "0xdead") {
+		return nil, testRevertError{data: testRevertData}
+	}
+	if to, _ := args["to"].(string); overrides != nil {
+		balance, _ := (*overrides)[common.HexToAddress(to)]["balance"].(string)
+		return common.LeftPadBytes(hexutil.MustDecodeBig(balance).Bytes(), 32), nil
+	}
+	return hexutil.Bytes{}, nil
+}
+
+func (s *testEthService) GasPrice() *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(5))
+}
+
+func (s *testEthService) MaxPriorityFeePerGas() *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(3))
+}
+
+type testRevertError struct {
+	data string
+}
+
+func (e testRevertError) Error() string          { return "execution reverted" }
+func (e testRevertError) ErrorCode() int         { return 3 }
+func (e testRevertError) ErrorData() interface{} { return e.data }
+
+// 0x08c379a0 Error("insufficient output amount")
+const testRevertData = "0x08c379a0" +
+	"0000000000000000000000000000000000000000000000000000000000000020" +
+	"000000000000000000000000000000000000000000000000000000000000001a" +
+	"696e73756666696369656e74206f757470757420616d6f756e74000000000000"
+
+func (s *testEthService) EstimateGas(args map[string]interface{}) (hexutil.Uint64, error) {
+	if data, _ := args["data"].(string); strings.HasPrefix(data, "0xdead") {
+		return 0, testRevertError{data: testRevertData}
+	}
+	return 50000, nil
+}
+
+func (s *testEthService) SendRawTransaction(data hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(data); err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), nil
+}
+
+type testNetService struct {
+	networkId string
+}
+
+func (s *testNetService) Version() string {
+	return s.networkId
+}
+
+// testNode 在 MockNode 上注册固定响应的 eth net debug 服务
+type testNode struct {
+	*txtest.MockNode
+	eth *testEthService
+}
+
+func newTestNode(t *testing.T, chainId int64, networkId string) *testNode {
+	node := &testNode{MockNode: txtest.NewMockNode(t), eth: &testEthService{chainId: big.NewInt(chainId), head: 100}}
+	if err := node.Register("eth", node.eth); err != nil {
+		t.Fatal(err)
+	}
+	if err := node.Register("net", &testNetService{networkId: networkId}); err != nil {
+		t.Fatal(err)
+	}
+	if err := node.Register("debug", &testDebugService{}); err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func TestClientChainId(t *testing.T) {
+	node := newTestNode(t, 61, "1")
+	ctx := context.Background()
+	privateKey := "0x4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainId, _ := client.ChainID()
+	networkId, _ := client.NetworkID()
+	if chainId.Int64() != 61 || networkId.Int64() != 1 {
+		t.Fatalf("unexpected chainId %s networkId %s", chainId, networkId)
+	}
+
+	tx, err := client.SignNewTxInfo(TransactionInfo{PrivateKeyStr: privateKey, Value: big.NewInt(0)}, 0, big.NewInt(1), 21000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.ChainId().Int64() != 61 {
+		t.Fatalf("tx signed with chainId %s", tx.ChainId())
+	}
+
+	// 配置的 chainId 与节点不一致时连接失败, 不会只比较两个配置值
+	if _, err := NewWeb3ClientWithOptions(ctx, node.URL, WithExpectedChainId(big.NewInt(1))); !errors.Is(err, ErrChainIdMismatch) {
+		t.Fatalf("expected ErrChainIdMismatch, got %v", err)
+	}
+	if _, err := NewWeb3ClientWithOptions(ctx, node.URL, WithChainId(big.NewInt(1))); !errors.Is(err, ErrChainIdMismatch) {
+		t.Fatalf("expected ErrChainIdMismatch, got %v", err)
+	}
+
+	client, err = NewWeb3ClientWithOptions(ctx, node.URL, WithChainId(big.NewInt(1)), WithLazyConnect())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.SignNewTxInfo(TransactionInfo{PrivateKeyStr: privateKey, Value: big.NewInt(0)}, 0, big.NewInt(1), 21000)
+	if !errors.Is(err, ErrChainIdMismatch) {
+		t.Fatalf("expected ErrChainIdMismatch, got %v", err)
+	}
+}
+
+func TestPoolClientFailover(t *testing.T) {
+	ctx := context.Background()
+	node := newTestNode(t, 56, "56")
+	client, err := NewWeb3PoolClient(ctx, []string{"http://127.0.0.1:1", node.URL}, WithDialTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		nonce, err := client.GetNonce(ctx, "0x7b4452dd6c38597fa9364ac8905c27ea44425832")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nonce != 7 {
+			t.Fatalf("unexpected nonce %d", nonce)
+		}
+	}
+
+	stats := client.EndpointStats()
+	if stats[0].Failures == 0 || stats[0].Score <= stats[1].Score {
+		t.Fatalf("dead endpoint should be penalized: %+v", stats)
+	}
+}
+
+func TestPoolClientChainId(t *testing.T) {
+	ctx := context.Background()
+	bsc, mainnet := newTestNode(t, 56, "56"), newTestNode(t, 1, "1")
+
+	// 没有配置 chainId 时节点必须一致, 不信任最先连接的节点
+	for i := 0; i < 3; i++ {
+		if _, err := NewWeb3PoolClient(ctx, []string{mainnet.URL, bsc.URL}); !errors.Is(err, ErrChainIdMismatch) {
+			t.Fatalf("expected ErrChainIdMismatch, got %v", err)
+		}
+	}
+
+	// 配置 chainId 时拒绝不一致的节点, 请求只发送到一致的节点
+	client, err := NewWeb3PoolClient(ctx, []string{mainnet.URL, bsc.URL}, WithExpectedChainId(big.NewInt(56)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetNonce(ctx, "0x7b4452dd6c38597fa9364ac8905c27ea44425832"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if chainId, _ := client.ChainID(); chainId.Int64() != 56 {
+		t.Fatalf("unexpected chainId %s", chainId)
+	}
+	if count := mainnet.CallCount("eth_getTransactionCount"); count != 0 {
+		t.Fatalf("mismatched endpoint received %d requests", count)
+	}
+}
+
+func TestPoolClientBroadcast(t *testing.T) {
+	ctx := context.Background()
+	nodes := []string{newTestNode(t, 56, "56").URL, newTestNode(t, 56, "56").URL}
+	client, err := NewWeb3PoolClient(ctx, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	tx, err := client.SignNewTxInfo(TransactionInfo{
+		PrivateKeyStr: "0x4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318",
+		Value:         big.NewInt(0),
+	}, 0, big.NewInt(1), 21000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := client.SendTransaction(ctx, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != tx.Hash().Hex() {
+		t.Fatalf("unexpected hash %s", hash)
+	}
+	for _, stat := range client.EndpointStats() {
+		if !stat.Connected {
+			t.Fatalf("endpoint not connected: %+v", stat)
+		}
+	}
 }
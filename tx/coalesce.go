@@ -0,0 +1,173 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	// 合并后的请求不受单个调用方 ctx 取消的影响, 有调用方没有 deadline 时至少等待这个超时
+	coalesceTimeout = 30 * time.Second
+)
+
+type coalescedCall struct {
+	method string
+	args   []interface{}
+	raw    json.RawMessage
+	err    error
+	done   chan struct{}
+
+	// 等待该请求的调用方中最高的 ContextWithPriority 优先级和最晚的 deadline.
+	// 每个调用方按自己的 ctx 返回, 用最早的 deadline 会让一个短超时的调用方取消所有调用方的请求
+	priority    Priority
+	hasPriority bool
+	deadline    time.Time
+	// 有调用方没有 deadline
+	unbounded bool
+}
+
+// join 合并调用方 ctx 的优先级和 deadline, 需持有 coalescer.mutex
+func (c *coalescedCall) join(ctx context.Context) {
+	priority, hasPriority := ctx.Value(priorityKey{}).(Priority)
+	deadline, ok := ctx.Deadline()
+	c.merge(priority, hasPriority, deadline, !ok)
+}
+
+func (c *coalescedCall) merge(priority Priority, hasPriority bool, deadline time.Time, unbounded bool) {
+	if hasPriority && (!c.hasPriority || priority > c.priority) {
+		c.priority, c.hasPriority = priority, true
+	}
+	if deadline.After(c.deadline) {
+		c.deadline = deadline
+	}
+	c.unbounded = c.unbounded || unbounded
+}
+
+// coalescer 合并相同的进行中请求, 并把 window 时间内到达的不同请求合并成一个 JSON-RPC batch
+type coalescer struct {
+	client   *Web3Client
+	window   time.Duration
+	mutex    sync.Mutex
+	inflight map[string]*coalescedCall
+	pending  []*coalescedCall
+	// 当前 pending 批次的定时器, 提前发送时停止, batch 区分定时器属于哪个批次
+	timer *time.Timer
+	batch uint64
+}
+
+func newCoalescer(client *Web3Client, window time.Duration) *coalescer {
+	return &coalescer{
+		client:   client,
+		window:   window,
+		inflight: make(map[string]*coalescedCall),
+	}
+}
+
+func (c *coalescer) do(ctx context.Context, method string, args ...interface{}) (json.RawMessage, error) {
+	key, err := requestKey(method, args)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	call, ok := c.inflight[key]
+	if !ok {
+		call = &coalescedCall{
+			method: method,
+			args:   args,
+			done:   make(chan struct{}),
+		}
+		c.inflight[key] = call
+		c.pending = append(c.pending, call)
+		call.join(ctx)
+
+		if len(c.pending) >= c.client.options.maxBatchSize {
+			c.flushLocked()
+		} else if len(c.pending) == 1 {
+			batch := c.batch
+			c.timer = time.AfterFunc(c.window, func() { c.flush(batch) })
+		}
+	} else {
+		// 已发送的请求不再受影响
+		call.join(ctx)
+	}
+	c.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.raw, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flush 定时器到期时发送 batch 批次, 该批次已提前发送时忽略
+func (c *coalescer) flush(batch uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if batch == c.batch {
+		c.flushLocked()
+	}
+}
+
+func (c *coalescer) flushLocked() {
+	calls := c.pending
+	c.pending = nil
+	c.batch++
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if len(calls) == 0 {
+		return
+	}
+
+	merged := &coalescedCall{}
+	for _, call := range calls {
+		merged.merge(call.priority, call.hasPriority, call.deadline, call.unbounded)
+	}
+
+	go func() {
+		deadline := merged.deadline
+		if fallback := time.Now().Add(coalesceTimeout); merged.unbounded && fallback.After(deadline) {
+			deadline = fallback
+		}
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		if merged.hasPriority {
+			ctx = ContextWithPriority(ctx, merged.priority)
+		}
+
+		if len(calls) == 1 {
+			call := calls[0]
+			call.err = c.client.call(ctx, call.method, func(ep *endpoint) error {
+				return ep.rpcClient.CallContext(ctx, &call.raw, call.method, call.args...)
+			})
+		} else {
+			items := make([]*batchItem, len(calls))
+			for i, call := range calls {
+				call := call
+				items[i] = &batchItem{
+					method: call.method,
+					args:   call.args,
+					decode: func(raw json.RawMessage) error {
+						call.raw = raw
+						return nil
+					},
+					setErr: func(err error) { call.err = err },
+				}
+			}
+			_ = c.client.batchCall(ctx, items)
+		}
+
+		c.mutex.Lock()
+		for _, call := range calls {
+			key, _ := requestKey(call.method, call.args)
+			delete(c.inflight, key)
+			close(call.done)
+		}
+		c.mutex.Unlock()
+	}()
+}
@@ -0,0 +1,139 @@
+package tx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescing(t *testing.T) {
+	node := newTestNode(t, 56, "56")
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL, WithCoalescing(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := node.Requests()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			address := fmt.Sprintf("0x%040x", i%4)
+			nonce, err := client.GetNonce(context.Background(), address)
+			if err != nil || nonce != 7 {
+				t.Errorf("unexpected nonce %d %v", nonce, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if calls := atomic.LoadInt64(&node.eth.nonceCalls); calls != 4 {
+		t.Fatalf("identical requests should be merged, got %d calls", calls)
+	}
+	if sent := node.Requests() - requests; sent != 1 {
+		t.Fatalf("distinct requests should be batched, got %d http requests", sent)
+	}
+}
+
+func TestCoalescingEarlyFlush(t *testing.T) {
+	node := newTestNode(t, 56, "56")
+	window := 200 * time.Millisecond
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL, WithCoalescing(window), WithMaxBatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 达到 maxBatchSize 立即发送
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := client.GetNonce(context.Background(), fmt.Sprintf("0x%040x", i)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed >= window {
+		t.Fatalf("full batch should be sent immediately, took %s", elapsed)
+	}
+
+	// 上一批次的定时器不能提前发送下一批次
+	time.Sleep(window / 2)
+	start = time.Now()
+	if _, err := client.GetNonce(context.Background(), fmt.Sprintf("0x%040x", 2)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < window*9/10 {
+		t.Fatalf("batch flushed by stale timer after %s", elapsed)
+	}
+}
+
+func TestCoalescingRateLimit(t *testing.T) {
+	node := newTestNode(t, 56, "56")
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL, WithCoalescing(10*time.Millisecond),
+		WithMethodRateLimit("eth_getTransactionCount", 0.1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := client.GetNonce(ctx, fmt.Sprintf("0x%040x", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 合并后的 batch 按方法限流, 令牌用完后普通请求等待到 deadline
+	timeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetNonce(timeout, fmt.Sprintf("0x%040x", 1)); err == nil {
+		t.Fatal("expected rate limited request to time out")
+	}
+
+	// 调用方的高优先级传给合并后的 batch, 不等待限流
+	high, cancel := context.WithTimeout(ContextWithPriority(ctx, PriorityHigh), time.Second)
+	defer cancel()
+	if _, err := client.GetNonce(high, fmt.Sprintf("0x%040x", 2)); err != nil {
+		t.Fatalf("high priority request should not wait: %v", err)
+	}
+}
+
+func TestCoalescingDeadline(t *testing.T) {
+	node := newTestNode(t, 56, "56")
+	node.SetLatency("eth_getTransactionCount", 200*time.Millisecond)
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL, WithCoalescing(10*time.Millisecond), WithRetryPolicy(NoRetryPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := fmt.Sprintf("0x%040x", 0)
+
+	// 短超时的调用方超时返回, 不取消其他调用方共享的请求
+	short, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	long, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i, ctx := range []context.Context{short, long} {
+		wg.Add(1)
+		go func(i int, ctx context.Context) {
+			defer wg.Done()
+			_, errs[i] = client.GetNonce(ctx, address)
+		}(i, ctx)
+	}
+	wg.Wait()
+
+	if errs[0] == nil {
+		t.Fatal("short caller should time out")
+	}
+	if errs[1] != nil {
+		t.Fatalf("long caller should get the result: %v", errs[1])
+	}
+	if calls := atomic.LoadInt64(&node.eth.nonceCalls); calls != 1 {
+		t.Fatalf("identical requests should be merged, got %d calls", calls)
+	}
+}
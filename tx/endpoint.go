@@ -0,0 +1,196 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethclient/gethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 平滑系数, 越大越偏向最近的请求
+	healthAlpha = 0.2
+	// 没有延迟样本时的默认延迟
+	defaultLatency = 100 * time.Millisecond
+	// 每落后一个区块相当于增加的延迟
+	blockLagPenalty = 200 * time.Millisecond
+)
+
+// endpoint 单个节点连接及其健康状态
+type endpoint struct {
+	url     string
+	options *clientOptions
+	limiter *endpointLimiter
+
+	connMutex  sync.Mutex
+	rpcClient  *rpc.Client
+	ethClient  *ethclient.Client
+	gethClient *gethclient.Client
+	chainId    *big.Int
+	networkId  *big.Int
+
+	statMutex sync.RWMutex
+	latency   time.Duration
+	errorRate float64
+	headBlock uint64
+	requests  uint64
+	failures  uint64
+}
+
+// EndpointStats 节点健康状态快照
+type EndpointStats struct {
+	Url       string
+	Connected bool
+	Latency   time.Duration
+	ErrorRate float64
+	HeadBlock uint64
+	Requests  uint64
+	Failures  uint64
+	// 因限流而等待过的请求数
+	RateLimited uint64
+	Score       float64
+}
+
+func newEndpoint(url string, options *clientOptions) *endpoint {
+	return &endpoint{
+		url:     url,
+		options: options,
+		limiter: newEndpointLimiter(url, options),
+	}
+}
+
+// connect 建立连接并解析 chainId, 已连接时直接返回
+func (p *endpoint) connect(ctx context.Context) error {
+	p.connMutex.Lock()
+	defer p.connMutex.Unlock()
+
+	if p.rpcClient != nil {
+		return nil
+	}
+
+	if p.options.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.options.dialTimeout)
+		defer cancel()
+	}
+
+	rpcClient, err := dialRpcClient(ctx, p.url, p.options)
+	if err != nil {
+		return err
+	}
+
+	ethClient := ethclient.NewClient(rpcClient)
+	chainId, networkId, err := resolveChainId(ctx, ethClient)
+	if err == nil {
+		err = checkChainId(chainId, p.options)
+	}
+	if err != nil {
+		rpcClient.Close()
+		return fmt.Errorf("endpoint %s: %w", p.url, err)
+	}
+
+	p.rpcClient = rpcClient
+	p.ethClient = ethClient
+	p.gethClient = gethclient.New(rpcClient)
+	p.chainId = chainId
+	p.networkId = networkId
+	return nil
+}
+
+func (p *endpoint) connected() bool {
+	p.connMutex.Lock()
+	defer p.connMutex.Unlock()
+	return p.rpcClient != nil
+}
+
+func (p *endpoint) close() {
+	p.connMutex.Lock()
+	defer p.connMutex.Unlock()
+	if p.rpcClient != nil {
+		p.rpcClient.Close()
+	}
+}
+
+// record 记录一次请求的延迟和结果, 只有节点自身的错误才算失败
+func (p *endpoint) record(latency time.Duration, failed bool) {
+	p.statMutex.Lock()
+	defer p.statMutex.Unlock()
+
+	p.requests++
+	if failed {
+		p.failures++
+		p.errorRate = p.errorRate*(1-healthAlpha) + healthAlpha
+		return
+	}
+
+	p.errorRate = p.errorRate * (1 - healthAlpha)
+	if p.latency == 0 {
+		p.latency = latency
+	} else {
+		p.latency = time.Duration(float64(p.latency)*(1-healthAlpha) + float64(latency)*healthAlpha)
+	}
+}
+
+func (p *endpoint) setHeadBlock(number uint64) {
+	p.statMutex.Lock()
+	defer p.statMutex.Unlock()
+	if number > p.headBlock {
+		p.headBlock = number
+	}
+}
+
+// score 越小越健康, 综合延迟 错误率 以及相对最高区块的落后程度
+func (p *endpoint) score(head uint64) float64 {
+	p.statMutex.RLock()
+	defer p.statMutex.RUnlock()
+
+	latency := p.latency
+	if latency == 0 {
+		latency = defaultLatency
+	}
+
+	score := float64(latency) * (1 + 10*p.errorRate)
+	if head > p.headBlock && p.headBlock > 0 {
+		score += float64(head-p.headBlock) * float64(blockLagPenalty)
+	}
+	return score
+}
+
+func (p *endpoint) stats(head uint64) EndpointStats {
+	score := p.score(head)
+
+	p.statMutex.RLock()
+	defer p.statMutex.RUnlock()
+	return EndpointStats{
+		Url:       p.url,
+		Connected: p.connected(),
+		Latency:   p.latency,
+		ErrorRate: p.errorRate,
+		HeadBlock: p.headBlock,
+		Requests:  p.requests,
+		Failures:  p.failures,
+
+		RateLimited: atomic.LoadUint64(&p.limiter.limited),
+		Score:       score,
+	}
+}
+
+// isEndpointError 判断错误是否由节点本身引起 (连接失败 超时 HTTP 错误等), 这类错误需要切换节点
+// JSON-RPC 返回的业务错误 (revert nonce too low 等) 换节点也不会成功
+func isEndpointError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var rpcErr rpc.Error
+	return !errors.As(err, &rpcErr)
+}
@@ -0,0 +1,152 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 未检测到 baseFee 时多久重新检测一次
+	dynamicFeeRecheckInterval = time.Minute
+)
+
+// TxType 签名时使用的交易类型
+type TxType int
+
+const (
+	// TxTypeLegacy 默认类型, 有 AccessList 时使用 AccessListTx
+	TxTypeLegacy TxType = iota
+	// TxTypeAuto 最新区块有 baseFee 时使用 DynamicFeeTx, 否则有 AccessList 时使用 AccessListTx, 其余使用 LegacyTx
+	TxTypeAuto
+	TxTypeAccessList
+	TxTypeDynamicFee
+)
+
+// LatestBaseFee 返回最新区块的 baseFee, 链不支持 EIP-1559 时返回 nil
+func (e *Web3Client) LatestBaseFee(ctx context.Context) (*big.Int, error) {
+	raw, err := e.rawCall(ctx, "eth_getBlockByNumber", "latest", false)
+	if err != nil {
+		return nil, err
+	}
+
+	var head *types.Header
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, err
+	}
+	if head == nil {
+		return nil, errors.New("latest block not found")
+	}
+	return head.BaseFee, nil
+}
+
+// SuggestGasTipCap eth_maxPriorityFeePerGas
+func (e *Web3Client) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	var tipCap hexutil.Big
+	err := e.call(ctx, "eth_maxPriorityFeePerGas", func(ep *endpoint) error {
+		return ep.rpcClient.CallContext(ctx, &tipCap, "eth_maxPriorityFeePerGas")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return (*big.Int)(&tipCap), nil
+}
+
+// dynamicFeeSupported 检测到 baseFee 后不再检测 (London 分叉后不会回退), 未检测到时每分钟最多检测一次
+func (e *Web3Client) dynamicFeeSupported(ctx context.Context) (bool, error) {
+	if atomic.LoadInt32(&e.dynamicFee) == 1 {
+		return true, nil
+	}
+	if time.Now().Unix()-atomic.LoadInt64(&e.dynamicFeeCheckTime) < int64(dynamicFeeRecheckInterval/time.Second) {
+		return false, nil
+	}
+
+	baseFee, err := e.LatestBaseFee(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	atomic.StoreInt64(&e.dynamicFeeCheckTime, time.Now().Unix())
+	if baseFee == nil {
+		return false, nil
+	}
+	atomic.StoreInt32(&e.dynamicFee, 1)
+	return true, nil
+}
+
+func (e *Web3Client) resolveTxType(ctx context.Context, txInfo TransactionInfo) (TxType, error) {
+	if txInfo.Type == TxTypeLegacy && len(txInfo.AccessList) > 0 {
+		return TxTypeAccessList, nil
+	}
+	if txInfo.Type != TxTypeAuto {
+		return txInfo.Type, nil
+	}
+
+	supported, err := e.dynamicFeeSupported(ctx)
+	if err != nil {
+		return TxTypeAuto, err
+	}
+	if supported {
+		return TxTypeDynamicFee, nil
+	}
+	if len(txInfo.AccessList) > 0 {
+		return TxTypeAccessList, nil
+	}
+	return TxTypeLegacy, nil
+}
+
+// newTxData 按交易类型构造交易, gasPrice 只用于 Legacy 和 AccessList 交易
+func newTxData(txType TxType, txInfo TransactionInfo, nonce uint64, value *big.Int, gas uint64,
+	gasPrice *big.Int, gasFeeCap *big.Int, gasTipCap *big.Int) (types.TxData, error) {
+	var toAddress *common.Address
+	if txInfo.To != "" {
+		tmpToAddress := common.HexToAddress(txInfo.To)
+		toAddress = &tmpToAddress
+	}
+
+	switch txType {
+	case TxTypeLegacy:
+		return &types.LegacyTx{
+			Nonce:    nonce,
+			To:       toAddress,
+			Value:    value,
+			Gas:      gas,
+			GasPrice: gasPrice,
+			Data:     txInfo.Data,
+		}, nil
+	case TxTypeAccessList:
+		return &types.AccessListTx{
+			Nonce:      nonce,
+			To:         toAddress,
+			Value:      value,
+			Gas:        gas,
+			GasPrice:   gasPrice,
+			Data:       txInfo.Data,
+			AccessList: txInfo.AccessList,
+		}, nil
+	case TxTypeDynamicFee:
+		if gasFeeCap == nil || gasTipCap == nil {
+			return nil, errors.New("dynamic fee tx requires gasFeeCap and gasTipCap")
+		}
+		if gasTipCap.Cmp(gasFeeCap) > 0 {
+			gasTipCap = gasFeeCap
+		}
+		return &types.DynamicFeeTx{
+			Nonce:      nonce,
+			To:         toAddress,
+			Value:      value,
+			Gas:        gas,
+			GasFeeCap:  gasFeeCap,
+			GasTipCap:  gasTipCap,
+			Data:       txInfo.Data,
+			AccessList: txInfo.AccessList,
+		}, nil
+	}
+	return nil, errors.New("unknown tx type")
+}
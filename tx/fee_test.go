@@ -0,0 +1,68 @@
+package tx
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"testing"
+)
+
+func TestSignTxType(t *testing.T) {
+	ctx := context.Background()
+	txInfo := TransactionInfo{
+		PrivateKeyStr: "0x4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318",
+		Value:         big.NewInt(0),
+	}
+
+	node := newTestNode(t, 1, "1")
+	node.eth.baseFee = big.NewInt(30)
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 默认使用 LegacyTx
+	tx, err := client.SignNewTxInfo(txInfo, 0, big.NewInt(100), 21000)
+	if err != nil || tx.Type() != types.LegacyTxType || tx.GasPrice().Int64() != 100 {
+		t.Fatalf("expected legacy tx by default: %v", err)
+	}
+
+	// gasPrice 作为 feeCap, tip 使用节点建议值
+	txInfo.Type = TxTypeAuto
+	tx, err = client.SignNewTxInfo(txInfo, 0, big.NewInt(100), 21000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Type() != types.DynamicFeeTxType || tx.GasFeeCap().Int64() != 100 || tx.GasTipCap().Int64() != 3 {
+		t.Fatalf("expected dynamic fee tx, got type %d feeCap %s tipCap %s", tx.Type(), tx.GasFeeCap(), tx.GasTipCap())
+	}
+
+	// 没有 gasPrice 时 feeCap 为 2 * baseFee + tip
+	tx, err = client.SignNewTxInfo(txInfo, 0, nil, 21000)
+	if err != nil || tx.GasFeeCap().Int64() != 63 || tx.GasTipCap().Int64() != 3 {
+		t.Fatalf("unexpected suggested fees: %v", err)
+	}
+
+	txInfo.GasTipCap = big.NewInt(2)
+	tx, err = client.SignNewTxInfo(txInfo, 0, big.NewInt(100), 21000)
+	if err != nil || tx.GasTipCap().Int64() != 2 {
+		t.Fatalf("explicit tip cap ignored: %v", err)
+	}
+
+	txInfo.Type = TxTypeLegacy
+	tx, err = client.SignNewTxInfo(txInfo, 0, big.NewInt(100), 21000)
+	if err != nil || tx.Type() != types.LegacyTxType {
+		t.Fatalf("expected legacy tx: %v", err)
+	}
+
+	legacyNode := newTestNode(t, 56, "56")
+	client, err = NewWeb3ClientWithOptions(ctx, legacyNode.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txInfo.Type = TxTypeAuto
+	tx, err = client.SignNewTxInfo(txInfo, 0, big.NewInt(100), 21000)
+	if err != nil || tx.Type() != types.LegacyTxType {
+		t.Fatalf("chain without base fee should use legacy tx: %v", err)
+	}
+}
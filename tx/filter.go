@@ -1,19 +1,32 @@
 package tx
 
 import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rpc"
 	"log"
-	"reflect"
 	"strings"
 	"time"
 )
 
 const (
-	notFoundErrorStr = "filter not found"
+	notFoundErrorStr       = "filter not found"
+	uninstallFilterTimeout = 5 * time.Second
 )
 
+// DefaultFilterRetryPolicy filter 轮询失败和重新安装的默认退避策略
+var DefaultFilterRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
 type FilterQuery struct {
 	BlockHash *common.Hash     // used by eth_getLogs, return logs only from block with this hash
 	FromBlock rpc.BlockNumber  // beginning of the queried range, nil means genesis block
@@ -34,124 +47,472 @@ type FilterQuery struct {
 	Topics [][]common.Hash
 }
 
+// filterArg eth_newFilter eth_getLogs 的参数. FilterQuery 没有 json tag, 直接序列化时节点会忽略 Addresses;
+// ToBlock 为 0 时表示最新区块, 否则零值会被序列化为 earliest 导致过滤掉所有新日志
+func (q FilterQuery) filterArg() map[string]interface{} {
+	arg := map[string]interface{}{
+		"address": q.Addresses,
+		"topics":  q.Topics,
+	}
+	if q.BlockHash != nil {
+		arg["blockHash"] = *q.BlockHash
+		return arg
+	}
+	arg["fromBlock"] = q.FromBlock
+	arg["toBlock"] = q.ToBlock
+	if q.ToBlock == 0 {
+		arg["toBlock"] = rpc.LatestBlockNumber
+	}
+	return arg
+}
+
+// Filter 基于 eth_getFilterChanges 轮询的 filter, 由 BaseFilter 驱动
 type Filter interface {
-	GetFilterId() (string, error)
-	Type() reflect.Type
+	GetFilterId(ctx context.Context) (string, error)
+	// Poll 拉取一次 filterId 的变化并输出
+	Poll(ctx context.Context, filterId string) error
+	// Close 轮询结束后关闭输出
+	Close()
+}
+
+// backfiller 重新安装后补齐 filter 丢失期间遗漏的数据
+type backfiller interface {
+	Backfill(ctx context.Context) error
 }
 
 type BaseFilter struct {
-	FilterId     string
-	Filter       Filter
-	FilterQuery  FilterQuery
+	FilterId    string
+	Filter      Filter
+	FilterQuery FilterQuery
+	// 轮询失败和重新安装的退避策略, MaxAttempts 为连续重新安装失败的上限
+	RetryPolicy  RetryPolicy
 	rpcClient    *rpc.Client
 	pullInterval int64
-	LogChan      chan interface{}
+	// 多节点客户端设置, 轮询遇到节点错误时调用, 返回非 nil 表示切换到该节点并重新安装 filter
+	failover func(ctx context.Context) *rpc.Client
 }
 
-func (b BaseFilter) Run(pullInterval int64) {
+// FilterSubscription 轮询 filter 的订阅, 实现 ethereum.Subscription.
+// ctx 取消或调用 Unsubscribe 后卸载 filter 并关闭输出; 因错误终止时 Err 先收到该错误, 之后 Err 关闭
+type FilterSubscription struct {
+	ctx    context.Context
+	err    chan error
+	cancel context.CancelFunc
+	done   chan struct{}
+}
 
-	go func() {
-		ticker := time.NewTicker(time.Duration(pullInterval) * time.Millisecond)
-		defer func() {
-			defer func() {
-				if r := recover(); r != nil {
-					log.Printf("Run error: %v", r)
-				}
-			}()
-			ticker.Stop()
-			b.ReInstall()
-		}()
-
-		b.pullInterval = pullInterval
-		filterId, err := b.Filter.GetFilterId()
-		if err != nil {
-			log.Printf("get filterId error: %s", err.Error())
+func (s *FilterSubscription) Err() <-chan error {
+	return s.err
+}
+
+// Unsubscribe 停止轮询并等待 filter 卸载完成, 可重复调用
+func (s *FilterSubscription) Unsubscribe() {
+	s.cancel()
+	<-s.done
+}
+
+// LogSubscription log filter 的订阅
+type LogSubscription struct {
+	*FilterSubscription
+	ch <-chan types.Log
+}
+
+func (s *LogSubscription) Chan() <-chan types.Log {
+	return s.ch
+}
+
+// PendingHashSubscription pending 交易 filter 的订阅, 输出交易 hash
+type PendingHashSubscription struct {
+	*FilterSubscription
+	ch <-chan common.Hash
+}
+
+func (s *PendingHashSubscription) Chan() <-chan common.Hash {
+	return s.ch
+}
+
+// PendingTxSubscription pending 交易 filter 的订阅, 输出完整交易
+type PendingTxSubscription struct {
+	*FilterSubscription
+	ch <-chan *types.Transaction
+}
+
+func (s *PendingTxSubscription) Chan() <-chan *types.Transaction {
+	return s.ch
+}
+
+// Run 安装 filter 并每 pullInterval 毫秒轮询 eth_getFilterChanges, 安装失败时返回 error
+func (b *BaseFilter) Run(ctx context.Context, pullInterval int64) (*FilterSubscription, error) {
+	filterId, err := b.Filter.GetFilterId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.FilterId = filterId
+	b.pullInterval = pullInterval
+
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &FilterSubscription{
+		ctx:    ctx,
+		err:    make(chan error, 1),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go b.loop(ctx, sub)
+	return sub, nil
+}
+
+func (b *BaseFilter) loop(ctx context.Context, sub *FilterSubscription) {
+	ticker := time.NewTicker(time.Duration(b.pullInterval) * time.Millisecond)
+	defer func() {
+		ticker.Stop()
+		b.uninstall()
+		b.Filter.Close()
+		close(sub.err)
+		close(sub.done)
+	}()
+
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
 		}
 
-		for range ticker.C {
-			var err error
-			typeName := b.Filter.Type().Kind()
-			switch typeName {
-			case reflect.String:
-				var hashArr []string
-				err = b.rpcClient.Call(&hashArr, "eth_getFilterChanges", filterId)
-				if err == nil {
-					for _, item := range hashArr {
-						b.LogChan <- item
-					}
-				}
-
-			case reflect.Struct:
-				var ethLogArr []types.Log
-				err = b.rpcClient.Call(&ethLogArr, "eth_getFilterChanges", filterId)
-				if err == nil {
-					for _, item := range ethLogArr {
-						b.LogChan <- item
-					}
+		err := b.Filter.Poll(ctx, b.FilterId)
+		if err == nil || ctx.Err() != nil {
+			failures = 0
+			continue
+		}
+		log.Printf("eth_getFilterChanges error: %s", err.Error())
+		if strings.Contains(err.Error(), notFoundErrorStr) {
+			// 节点重启或 filter 过期, 多次重新安装失败时终止
+			if err := b.reinstall(ctx); err != nil {
+				if ctx.Err() == nil {
+					sub.err <- err
 				}
+				return
 			}
+			failures = 0
+			continue
+		}
 
-			if err != nil {
-				log.Printf("eth_getFilterChanges error: %s", err.Error())
-				if strings.Contains(err.Error(), notFoundErrorStr) {
+		failures++
+		if b.failover != nil && isEndpointError(err) {
+			if rpcClient := b.failover(ctx); rpcClient != nil {
+				// 原节点上的 filter 无法卸载, 由节点过期删除
+				b.rpcClient = rpcClient
+				if err := b.reinstall(ctx); err != nil {
+					if ctx.Err() == nil {
+						sub.err <- err
+					}
 					return
 				}
+				failures = 0
+				continue
 			}
 		}
-	}()
+		if !sleepContext(ctx, b.RetryPolicy.backoff(failures)) {
+			return
+		}
+	}
+}
 
+// reinstall 按退避策略重复 ReInstall, 直到成功或达到 MaxAttempts
+func (b *BaseFilter) reinstall(ctx context.Context) error {
+	for attempt := 1; ; attempt++ {
+		err := b.ReInstall(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt >= b.RetryPolicy.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+		log.Printf("%s, retry %d", err.Error(), attempt)
+		if !sleepContext(ctx, b.RetryPolicy.backoff(attempt)) {
+			return ctx.Err()
+		}
+	}
 }
 
-func (b BaseFilter) ReInstall() {
-	b.Run(b.pullInterval)
+// ReInstall 重新安装 filter 并补齐 filter 丢失期间遗漏的数据, 之后的轮询使用新的 filterId
+func (b *BaseFilter) ReInstall(ctx context.Context) error {
+	filterId, err := b.Filter.GetFilterId(ctx)
+	if err != nil {
+		return fmt.Errorf("reinstall filter: %w", err)
+	}
+	b.FilterId = filterId
+
+	if f, ok := b.Filter.(backfiller); ok {
+		if err := f.Backfill(ctx); err != nil {
+			// 下次重试会安装新的 filter
+			b.uninstall()
+			return fmt.Errorf("backfill filter: %w", err)
+		}
+	}
+	return nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// uninstall 尽力卸载 filter, 节点端的 filter 过期后也会自动删除
+func (b *BaseFilter) uninstall() {
+	ctx, cancel := context.WithTimeout(context.Background(), uninstallFilterTimeout)
+	defer cancel()
+
+	var uninstalled bool
+	if err := b.rpcClient.CallContext(ctx, &uninstalled, "eth_uninstallFilter", b.FilterId); err != nil {
+		log.Printf("eth_uninstallFilter error: %s", err.Error())
+	}
 }
 
 type PendingTransactionFilter struct {
 	*BaseFilter
+	HashChan chan common.Hash
 }
 
-func (f *PendingTransactionFilter) GetFilterId() (string, error) {
+func (f *PendingTransactionFilter) GetFilterId(ctx context.Context) (string, error) {
 	var filterID string
-	err := f.rpcClient.Call(&filterID, "eth_newPendingTransactionFilter")
+	err := f.rpcClient.CallContext(ctx, &filterID, "eth_newPendingTransactionFilter")
 	return filterID, err
 }
 
-func (f *PendingTransactionFilter) Type() reflect.Type {
-	return reflect.TypeOf("")
+func (f *PendingTransactionFilter) Poll(ctx context.Context, filterId string) error {
+	var hashArr []common.Hash
+	if err := f.rpcClient.CallContext(ctx, &hashArr, "eth_getFilterChanges", filterId); err != nil {
+		return err
+	}
+	for _, hash := range hashArr {
+		select {
+		case f.HashChan <- hash:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (f *PendingTransactionFilter) Close() {
+	close(f.HashChan)
 }
 
 func NewPendingTransactionFilter(rpcClient *rpc.Client) *PendingTransactionFilter {
-	p := &PendingTransactionFilter{}
+	p := &PendingTransactionFilter{HashChan: make(chan common.Hash, 500)}
 	p.BaseFilter = &BaseFilter{
-		Filter:    p,
-		rpcClient: rpcClient,
-		LogChan:   make(chan interface{}, 500),
+		Filter:      p,
+		RetryPolicy: DefaultFilterRetryPolicy,
+		rpcClient:   rpcClient,
 	}
 	return p
 }
 
+// logKey 日志的唯一标识, 用于去重
+type logKey struct {
+	blockHash common.Hash
+	txIndex   uint
+	logIndex  uint
+	removed   bool
+}
+
 type LogFilter struct {
 	*BaseFilter
+	LogChan chan types.Log
+
+	// 重新安装后从该区块开始补齐: 最近一次轮询成功时的最新区块或已输出日志的最高区块, 尚未轮询时为安装时的下一个区块
+	fromBlock uint64
+	// 已输出的日志及其区块号, 只保留 fromBlock 及之后的区块
+	seen map[logKey]uint64
+	// 由 Web3Client 设置, 补齐时分段查询; 为 nil 时用一次 eth_getLogs 查询
+	logRange func(ctx context.Context, query FilterQuery, from uint64, to uint64) *LogIterator
 }
 
-func (f *LogFilter) GetFilterId() (string, error) {
+func (f *LogFilter) GetFilterId(ctx context.Context) (string, error) {
 	var filterID string
-	err := f.rpcClient.Call(&filterID, "eth_newFilter", f.FilterQuery)
+	err := f.rpcClient.CallContext(ctx, &filterID, "eth_newFilter", f.FilterQuery.filterArg())
 	return filterID, err
 }
 
-func (f *LogFilter) Type() reflect.Type {
-	return reflect.TypeOf(types.Log{})
+// Run 记录安装时的区块作为补齐的起点, 再开始轮询
+func (f *LogFilter) Run(ctx context.Context, pullInterval int64) (*FilterSubscription, error) {
+	head, err := f.head(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.fromBlock = head + 1
+	return f.BaseFilter.Run(ctx, pullInterval)
+}
+
+// Poll 轮询前先读取最新区块, 轮询成功后该区块之前的日志都已输出, 补齐的起点前进到该区块
+func (f *LogFilter) Poll(ctx context.Context, filterId string) error {
+	head, err := f.head(ctx)
+	if err != nil {
+		return err
+	}
+	var ethLogArr []types.Log
+	if err := f.rpcClient.CallContext(ctx, &ethLogArr, "eth_getFilterChanges", filterId); err != nil {
+		return err
+	}
+	if err := f.deliver(ctx, ethLogArr); err != nil {
+		return err
+	}
+	f.advance(head)
+	return nil
+}
+
+// Backfill 查询 fromBlock 到最新区块的日志, 已输出的日志会被去重
+func (f *LogFilter) Backfill(ctx context.Context) error {
+	query := f.FilterQuery
+	if query.BlockHash != nil {
+		return nil
+	}
+	from := f.fromBlock
+	if query.FromBlock >= 0 && uint64(query.FromBlock) > from {
+		from = uint64(query.FromBlock)
+	}
+	to, err := f.head(ctx)
+	if err != nil {
+		return err
+	}
+	if query.ToBlock > 0 && uint64(query.ToBlock) < to {
+		to = uint64(query.ToBlock)
+	}
+	if to < from {
+		return nil
+	}
+
+	if f.logRange == nil {
+		arg := query.filterArg()
+		arg["fromBlock"] = hexutil.EncodeUint64(from)
+		arg["toBlock"] = hexutil.EncodeUint64(to)
+		var ethLogArr []types.Log
+		if err := f.rpcClient.CallContext(ctx, &ethLogArr, "eth_getLogs", arg); err != nil {
+			return err
+		}
+		if err := f.deliver(ctx, ethLogArr); err != nil {
+			return err
+		}
+	} else {
+		it := f.logRange(ctx, query, from, to)
+		defer it.Close()
+		for it.Next() {
+			if err := f.deliver(ctx, []types.Log{it.Log()}); err != nil {
+				return err
+			}
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+	}
+	f.advance(to)
+	return nil
+}
+
+func (f *LogFilter) head(ctx context.Context) (uint64, error) {
+	var head hexutil.Uint64
+	err := f.rpcClient.CallContext(ctx, &head, "eth_blockNumber")
+	return uint64(head), err
+}
+
+func (f *LogFilter) deliver(ctx context.Context, logs []types.Log) error {
+	for _, item := range logs {
+		key := logKey{blockHash: item.BlockHash, txIndex: item.TxIndex, logIndex: item.Index, removed: item.Removed}
+		if _, ok := f.seen[key]; ok {
+			continue
+		}
+		select {
+		case f.LogChan <- item:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		f.seen[key] = item.BlockNumber
+		f.advance(item.BlockNumber)
+	}
+	return nil
+}
+
+// advance fromBlock 前进到 number, 同时删除之前区块的去重记录
+func (f *LogFilter) advance(number uint64) {
+	if number <= f.fromBlock {
+		return
+	}
+	f.fromBlock = number
+	for k, blockNumber := range f.seen {
+		if blockNumber < f.fromBlock {
+			delete(f.seen, k)
+		}
+	}
+}
+
+func (f *LogFilter) Close() {
+	close(f.LogChan)
 }
 
 func NewLogFilterFilter(rpcClient *rpc.Client, filterQuery FilterQuery) *LogFilter {
-	l := &LogFilter{}
+	l := &LogFilter{
+		LogChan: make(chan types.Log, 5000),
+		seen:    make(map[logKey]uint64),
+	}
 	l.BaseFilter = &BaseFilter{
 		Filter:      l,
 		FilterQuery: filterQuery,
+		RetryPolicy: DefaultFilterRetryPolicy,
 		rpcClient:   rpcClient,
-		LogChan:     make(chan interface{}, 5000),
 	}
 	return l
 }
+
+// filterLogs 按地址和 topic 过滤日志
+func filterLogs(logs []*types.Log, query ethereum.FilterQuery) []types.Log {
+	var result []types.Log
+	for _, l := range logs {
+		if matchLog(l, query.Addresses, query.Topics) {
+			result = append(result, *l)
+		}
+	}
+	return result
+}
+
+func matchLog(l *types.Log, addresses []common.Address, topics [][]common.Hash) bool {
+	if len(addresses) > 0 {
+		found := false
+		for _, address := range addresses {
+			if l.Address == address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(topics) > len(l.Topics) {
+		return false
+	}
+	for i, sub := range topics {
+		if len(sub) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range sub {
+			if l.Topics[i] == topic {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,468 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/snail-plus/eth-pkg/tx/txtest"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEthPendingFlowable(t *testing.T) {
+	sim := txtest.NewSimChain(t, txtest.WithAutoMine(false))
+	client, err := NewWeb3ClientWithOptions(context.Background(), sim.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	sub, err := client.EthPendingFlowable(context.Background(), 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	sent := make(map[common.Hash]bool)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case hash := <-sub.Chan():
+			if !sent[hash] {
+				t.Fatalf("unexpected pending hash %s", hash.Hex())
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+			tx, err := sim.SignTx(sim.Accounts[0], &to, nil, big.NewInt(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sent[tx.Hash()] = true
+			if err := sim.SendTransaction(tx); err != nil {
+				t.Fatal(err)
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for pending transaction")
+		}
+	}
+}
+
+func TestSubscribePendingTransactions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sim := txtest.NewSimChain(t, txtest.WithAutoMine(false))
+	client, err := NewWeb3ClientWithOptions(ctx, sim.WSURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ch := make(chan *types.Transaction, 10)
+	subscription, err := client.SubscribePendingTransactions(ctx, ch, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscription.Unsubscribe()
+
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	tx, err := sim.SignTx(sim.Accounts[0], &to, nil, big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.SendTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case pending := <-ch:
+		if pending.Hash() != tx.Hash() {
+			t.Fatalf("unexpected pending transaction %s", pending.Hash().Hex())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for pending transaction")
+	}
+
+	content, err := client.TxPoolContentPending(ctx, nil)
+	if err != nil || len(content) != 1 || content[0].Hash != tx.Hash() {
+		t.Fatalf("unexpected txpool content %v %v", content, err)
+	}
+	sim.Mine()
+	if content, err := client.TxPoolContentPending(ctx, nil); err != nil || len(content) != 0 {
+		t.Fatalf("expected empty txpool after mining %v %v", content, err)
+	}
+}
+
+func signMockTx(t *testing.T, nonce uint64, to common.Address) *types.Transaction {
+	tx, err := types.SignNewTx(txtest.NewAccount(0).Key, types.LatestSignerForChainID(txtest.SimChainId), &types.DynamicFeeTx{
+		ChainID:   txtest.SimChainId,
+		Nonce:     nonce,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(1),
+		Gas:       21000,
+		To:        &to,
+		Value:     big.NewInt(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestEthLogFlowableMockNode(t *testing.T) {
+	node := txtest.NewMockNode(t)
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	token := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := client.EthLogFlowable(ctx, FilterQuery{FromBlock: rpc.LatestBlockNumber, ToBlock: rpc.LatestBlockNumber}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node.EmitLogs(types.Log{Address: token, BlockNumber: 1, Index: 0}, types.Log{Address: token, BlockNumber: 1, Index: 1})
+	for i := uint(0); i < 2; i++ {
+		select {
+		case ethLog := <-sub.Chan():
+			if ethLog.Address != token || ethLog.Index != i {
+				t.Fatalf("unexpected log %+v", ethLog)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for log")
+		}
+	}
+
+	// 取消后卸载 filter 并关闭输出, 没有错误
+	cancel()
+	for range sub.Chan() {
+	}
+	if err := <-sub.Err(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if node.CallCount("eth_uninstallFilter") != 1 {
+		t.Fatal("filter not uninstalled")
+	}
+	sub.Unsubscribe()
+}
+
+func TestEthPendingFlowableTerminalError(t *testing.T) {
+	node := txtest.NewMockNode(t)
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, Multiplier: 2}
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL, WithFilterRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	node.SetError("eth_newPendingTransactionFilter", errors.New("filters disabled"))
+	if _, err := client.EthPendingFlowable(context.Background(), 10); err == nil {
+		t.Fatal("expected install error")
+	}
+	node.SetError("eth_newPendingTransactionFilter", nil)
+
+	sub, err := client.EthPendingFlowable(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	tx := signMockTx(t, 0, common.HexToAddress("0x00000000000000000000000000000000000000aa"))
+	node.AddPendingTransactions(tx)
+	select {
+	case hash := <-sub.Chan():
+		if hash != tx.Hash() {
+			t.Fatalf("unexpected pending hash %s", hash.Hex())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for pending hash")
+	}
+
+	// filter 丢失后重新安装失败, 错误通过 Err 返回并关闭输出
+	node.SetError("eth_newPendingTransactionFilter", errors.New("filters disabled"))
+	node.UninstallFilters()
+	select {
+	case err := <-sub.Err():
+		if err == nil || !strings.Contains(err.Error(), "filters disabled") {
+			t.Fatalf("unexpected error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for terminal error")
+	}
+	if _, ok := <-sub.Chan(); ok {
+		t.Fatal("expected closed chan")
+	}
+	if count := node.CallCount("eth_newPendingTransactionFilter"); count != 2+policy.MaxAttempts {
+		t.Fatalf("eth_newPendingTransactionFilter called %d times", count)
+	}
+}
+
+func TestEthLogFlowableReinstall(t *testing.T) {
+	node := txtest.NewMockNode(t)
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, Multiplier: 2}
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL, WithFilterRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	token := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	newLog := func(address common.Address, number uint64, index uint) types.Log {
+		return types.Log{Address: address, BlockNumber: number, BlockHash: common.BigToHash(new(big.Int).SetUint64(number)), Index: index}
+	}
+	// 安装前的日志不补齐
+	node.EmitLogs(newLog(token, 10, 0))
+	sub, err := client.EthLogFlowable(context.Background(), FilterQuery{Addresses: []common.Address{token}}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	next := func() types.Log {
+		select {
+		case ethLog := <-sub.Chan():
+			return ethLog
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for log")
+		}
+		return types.Log{}
+	}
+
+	node.EmitLogs(newLog(token, 11, 0), newLog(other, 11, 1))
+	if ethLog := next(); ethLog.BlockNumber != 11 || ethLog.Index != 0 {
+		t.Fatalf("unexpected log %+v", ethLog)
+	}
+
+	// filter 丢失期间产生的日志通过 eth_getLogs 补齐, 已输出的不重复; 重新安装失败时退避重试
+	node.UninstallFilters()
+	node.Script("eth_newFilter", txtest.MockResponse{Err: errors.New("busy")})
+	node.Script("eth_getLogs", txtest.MockResponse{Err: errors.New("busy")})
+	node.EmitLogs(newLog(token, 11, 2), newLog(token, 12, 0), newLog(other, 12, 1))
+	for _, want := range []types.Log{newLog(token, 11, 2), newLog(token, 12, 0)} {
+		if ethLog := next(); ethLog.BlockNumber != want.BlockNumber || ethLog.Index != want.Index {
+			t.Fatalf("unexpected log %+v, want block %d index %d", ethLog, want.BlockNumber, want.Index)
+		}
+	}
+	node.EmitLogs(newLog(token, 13, 0))
+	if ethLog := next(); ethLog.BlockNumber != 13 {
+		t.Fatalf("unexpected log %+v", ethLog)
+	}
+	select {
+	case ethLog := <-sub.Chan():
+		t.Fatalf("unexpected duplicate log %+v", ethLog)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	calls := node.Calls("eth_getLogs")
+	if len(calls) != 2 || !strings.Contains(string(calls[1].Params), `"fromBlock":"0xb"`) {
+		t.Fatalf("unexpected eth_getLogs calls %v", calls)
+	}
+}
+
+func TestEthLogFlowableBackfillRange(t *testing.T) {
+	node := txtest.NewMockNode(t)
+	node.SetBlockNumber(10)
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, Multiplier: 2}
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL, WithFilterRetryPolicy(policy), WithLogRangeChunkSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	token := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	sub, err := client.EthLogFlowable(context.Background(), FilterQuery{Addresses: []common.Address{token}}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	// 没有日志时补齐的起点也随轮询前进, 等到至少一次轮询看到区块 100
+	node.SetBlockNumber(100)
+	polls := node.CallCount("eth_getFilterChanges")
+	for deadline := time.Now().Add(5 * time.Second); node.CallCount("eth_getFilterChanges") < polls+2; {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for poll")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	node.UninstallFilters()
+	node.EmitLogs(types.Log{Address: token, BlockNumber: 125, BlockHash: common.HexToHash("0x7d")})
+	select {
+	case ethLog := <-sub.Chan():
+		if ethLog.BlockNumber != 125 {
+			t.Fatalf("unexpected log %+v", ethLog)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for log")
+	}
+
+	// 从区块 100 开始按 10 个区块分段补齐到 125
+	// 分段并发请求, 不检查顺序
+	calls := node.Calls("eth_getLogs")
+	if len(calls) != 3 {
+		t.Fatalf("unexpected eth_getLogs calls %v", calls)
+	}
+	for _, from := range []string{"0x64", "0x6e", "0x78"} {
+		found := false
+		for _, call := range calls {
+			found = found || strings.Contains(string(call.Params), `"fromBlock":"`+from+`"`)
+		}
+		if !found {
+			t.Fatalf("missing eth_getLogs from %s in %v", from, calls)
+		}
+	}
+}
+
+func TestEthLogFlowableFailover(t *testing.T) {
+	primary, backup := txtest.NewMockNode(t), txtest.NewMockNode(t)
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, Multiplier: 2}
+	client, err := NewWeb3PoolClient(context.Background(), []string{primary.URL, backup.URL}, WithFilterRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	token := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	sub, err := client.EthLogFlowable(context.Background(), FilterQuery{FromBlock: rpc.LatestBlockNumber, Addresses: []common.Address{token}}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	if primary.CallCount("eth_newFilter") != 1 {
+		t.Fatal("filter not installed on primary")
+	}
+
+	// 安装 filter 的节点宕机, 切换到备用节点重新安装并补齐宕机期间的日志
+	primary.Close()
+	backup.EmitLogs(types.Log{Address: token, BlockNumber: 1, BlockHash: common.HexToHash("0x01")})
+	select {
+	case ethLog := <-sub.Chan():
+		if ethLog.BlockNumber != 1 {
+			t.Fatalf("unexpected log %+v", ethLog)
+		}
+	case err := <-sub.Err():
+		t.Fatalf("unexpected error %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for log from backup")
+	}
+	if backup.CallCount("eth_newFilter") != 1 {
+		t.Fatal("filter not reinstalled on backup")
+	}
+}
+
+func TestSubscribePendingTransactionsMockNode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node := txtest.NewMockNode(t)
+	client, err := NewWeb3ClientWithOptions(ctx, node.WSURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ch := make(chan *types.Transaction, 10)
+	subscription, err := client.SubscribePendingTransactions(ctx, ch, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscription.Unsubscribe()
+
+	// 第一笔查询交易时失败, 不应推送
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	failed, tx := signMockTx(t, 0, to), signMockTx(t, 1, to)
+	node.Script("eth_getTransactionByHash", txtest.MockResponse{Err: errors.New("transaction indexing is in progress")})
+	node.AddPendingTransactions(failed)
+	deadline := time.Now().Add(5 * time.Second)
+	for node.CallCount("eth_getTransactionByHash") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("pending hash not looked up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	node.AddPendingTransactions(tx)
+
+	select {
+	case pending := <-ch:
+		if pending.Hash() != tx.Hash() {
+			t.Fatalf("unexpected pending transaction %s", pending.Hash().Hex())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for pending transaction")
+	}
+	select {
+	case pending := <-ch:
+		t.Fatalf("unexpected pending transaction %s", pending.Hash().Hex())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTxPoolContentPendingMockNode(t *testing.T) {
+	ctx := context.Background()
+	node := txtest.NewMockNode(t)
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	router := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	node.AddPendingTransactions(signMockTx(t, 0, router), signMockTx(t, 1, other), signMockTx(t, 2, router))
+
+	content, err := client.TxPoolContentPending(ctx, func(toAddress string) bool {
+		return strings.EqualFold(toAddress, router.Hex())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content) != 2 || *content[0].To != router || *content[1].To != router {
+		t.Fatalf("unexpected txpool content %v", content)
+	}
+
+	node.SetError("txpool_content", &txtest.MockError{Code: -32601, Message: "the method txpool_content does not exist/is not available"})
+	if _, err := client.TxPoolContentPending(ctx, nil); err == nil {
+		t.Fatal("expected txpool_content error")
+	}
+}
+
+func TestEthPendingTransactionFlowable(t *testing.T) {
+	node := txtest.NewMockNode(t)
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	sub, err := client.EthPendingTransactionFlowable(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	// 查询时已离开交易池的交易被忽略
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	dropped, tx := signMockTx(t, 0, to), signMockTx(t, 1, to)
+	node.Script("eth_getTransactionByHash", txtest.MockResponse{Result: nil})
+	node.AddPendingTransactions(dropped, tx)
+	select {
+	case pending := <-sub.Chan():
+		if pending.Hash() != tx.Hash() {
+			t.Fatalf("unexpected pending transaction %s", pending.Hash().Hex())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for pending transaction")
+	}
+
+	sub.Unsubscribe()
+	for range sub.Chan() {
+	}
+}
@@ -0,0 +1,638 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
+	"math"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	defaultForkGasTipCap = params.GWei
+)
+
+// ErrUnknownForkChain 没有内置配置的链需要在 NewForkBackend 中传入链配置
+var ErrUnknownForkChain = errors.New("no built-in chain config for fork")
+
+// knownChainConfigs go-ethereum 内置的网络配置
+var knownChainConfigs = map[uint64]*params.ChainConfig{
+	params.MainnetChainConfig.ChainID.Uint64(): params.MainnetChainConfig,
+	params.RopstenChainConfig.ChainID.Uint64(): params.RopstenChainConfig,
+	params.SepoliaChainConfig.ChainID.Uint64(): params.SepoliaChainConfig,
+	params.RinkebyChainConfig.ChainID.Uint64(): params.RinkebyChainConfig,
+	params.GoerliChainConfig.ChainID.Uint64():  params.GoerliChainConfig,
+}
+
+// ErrForkStateUnavailable 只保留最新的本地状态, 不能在分叉之后的历史区块上调用
+var ErrForkStateUnavailable = errors.New("state of local fork block is not available")
+
+// forkBlock 本地执行交易产生的区块, 每笔交易单独出块
+type forkBlock struct {
+	header  *types.Header
+	hash    common.Hash
+	tx      *types.Transaction
+	receipt *types.Receipt
+}
+
+// ForkBackend 在远程节点指定区块的状态上用本地 EVM 执行调用和交易, 账户 代码 存储在第一次访问时从远程节点读取并缓存.
+// 实现 bind.ContractBackend 和 bind.DeployBackend, contract 包中的合约绑定可以直接使用, Client 返回在分叉上工作的 Web3Client
+type ForkBackend struct {
+	client     *Web3Client
+	config     *params.ChainConfig
+	forkNumber *big.Int
+	forkHeader *types.Header
+	forkHash   common.Hash
+
+	mutex       sync.Mutex
+	state       *forkState
+	blocks      []*forkBlock
+	blockHashes map[uint64]common.Hash
+	txs         map[common.Hash]*forkBlock
+	timeOffset  uint64
+	logsFeed    event.Feed
+}
+
+// NewForkBackend 在 blockNumber (nil 为最新区块) 分叉. config 为 nil 时按 chainId 使用 go-ethereum 内置的网络配置,
+// 其他链 (如 BSC) 的升级高度和以太坊不同, 必须传入该链的配置
+func (e *Web3Client) NewForkBackend(ctx context.Context, blockNumber *big.Int, config *params.ChainConfig) (*ForkBackend, error) {
+	header, hash, err := e.headerByNumber(ctx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	chainId, err := e.getChainId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		if config = knownChainConfigs[chainId.Uint64()]; config == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownForkChain, chainId)
+		}
+	}
+	if config.ChainID == nil || config.ChainID.Cmp(chainId) != 0 {
+		return nil, fmt.Errorf("%w: config %v, node reports %s", ErrChainIdMismatch, config.ChainID, chainId)
+	}
+
+	fork := &ForkBackend{
+		client:      e,
+		config:      config,
+		forkNumber:  header.Number,
+		forkHeader:  header,
+		forkHash:    hash,
+		blockHashes: map[uint64]common.Hash{header.Number.Uint64(): hash},
+		txs:         make(map[common.Hash]*forkBlock),
+	}
+	fork.state = newForkState(&remoteForkSource{client: e, blockNumber: header.Number})
+	return fork, nil
+}
+
+// remoteForkSource 从远程节点读取分叉区块的状态, 一个账户的余额 nonce 代码合并成一个 batch 请求
+type remoteForkSource struct {
+	client      *Web3Client
+	blockNumber *big.Int
+}
+
+func (s *remoteForkSource) account(ctx context.Context, address common.Address) (*big.Int, uint64, []byte, error) {
+	batch := s.client.NewBatch()
+	balance := batch.BalanceAt(address, s.blockNumber)
+	nonce := batch.NonceAt(address, s.blockNumber)
+	code := batch.CodeAt(address, s.blockNumber)
+	if err := batch.Execute(ctx); err != nil {
+		return nil, 0, nil, err
+	}
+	for _, err := range []error{balance.Err, nonce.Err, code.Err} {
+		if err != nil {
+			return nil, 0, nil, err
+		}
+	}
+	return balance.Value, nonce.Value, code.Value, nil
+}
+
+func (s *remoteForkSource) storage(ctx context.Context, address common.Address, slot common.Hash) (common.Hash, error) {
+	value, err := s.client.StorageAt(ctx, address, slot, s.blockNumber)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(value), nil
+}
+
+// head 调用方持有锁
+func (f *ForkBackend) head() (*types.Header, common.Hash) {
+	if len(f.blocks) == 0 {
+		return f.forkHeader, f.forkHash
+	}
+	block := f.blocks[len(f.blocks)-1]
+	return block.header, block.hash
+}
+
+// pendingHeader 下一个区块, 调用和交易都在该区块上执行, baseFee 保持分叉区块的值
+func (f *ForkBackend) pendingHeader() *types.Header {
+	head, hash := f.head()
+	return &types.Header{
+		ParentHash: hash,
+		Coinbase:   head.Coinbase,
+		Difficulty: head.Difficulty,
+		Number:     new(big.Int).Add(head.Number, big.NewInt(1)),
+		GasLimit:   head.GasLimit,
+		Time:       head.Time + 1 + f.timeOffset,
+		BaseFee:    head.BaseFee,
+	}
+}
+
+// isLocal 区块号对应本地状态 (nil 或最新区块), 分叉区块及之前的查询转发到远程节点
+func (f *ForkBackend) isLocal(blockNumber *big.Int) (bool, error) {
+	if blockNumber == nil || blockNumber.Sign() < 0 {
+		return true, nil
+	}
+	head, _ := f.head()
+	if blockNumber.Cmp(head.Number) == 0 {
+		return true, nil
+	}
+	if blockNumber.Cmp(f.forkNumber) <= 0 {
+		return false, nil
+	}
+	return false, ErrForkStateUnavailable
+}
+
+func (f *ForkBackend) getHash(number uint64) common.Hash {
+	if hash, ok := f.blockHashes[number]; ok {
+		return hash
+	}
+	if number > f.forkNumber.Uint64() {
+		return common.Hash{}
+	}
+
+	hash, err := f.client.blockHashByNumber(f.state.ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		f.state.setError(err)
+		return common.Hash{}
+	}
+	f.blockHashes[number] = hash
+	return hash
+}
+
+// execute 在 header 区块上执行消息, 读取远程状态失败时返回该错误
+func (f *ForkBackend) execute(ctx context.Context, msg types.Message, header *types.Header, noBaseFee bool) (*core.ExecutionResult, error) {
+	f.state.ctx = ctx
+	f.state.err = nil
+	defer func() { f.state.ctx = context.Background() }()
+
+	blockContext := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		GetHash:     f.getHash,
+		Coinbase:    header.Coinbase,
+		GasLimit:    header.GasLimit,
+		BlockNumber: header.Number,
+		Time:        new(big.Int).SetUint64(header.Time),
+		Difficulty:  header.Difficulty,
+		BaseFee:     header.BaseFee,
+	}
+	evm := vm.NewEVM(blockContext, core.NewEVMTxContext(msg), f.state, f.config, vm.Config{NoBaseFee: noBaseFee})
+
+	gasPool := new(core.GasPool).AddGas(header.GasLimit)
+	if noBaseFee {
+		gasPool = new(core.GasPool).AddGas(math.MaxUint64)
+	}
+	result, err := core.ApplyMessage(evm, msg, gasPool)
+	if f.state.err != nil {
+		return nil, f.state.err
+	}
+	return result, err
+}
+
+// callMessage 调用不检查 nonce, 未指定 gas 时使用区块 gas 上限
+func (f *ForkBackend) callMessage(call ethereum.CallMsg, header *types.Header) types.Message {
+	gas := call.Gas
+	if gas == 0 {
+		gas = header.GasLimit
+	}
+	gasPrice, gasFeeCap, gasTipCap := call.GasPrice, call.GasFeeCap, call.GasTipCap
+	if gasPrice == nil {
+		gasPrice = new(big.Int)
+		if gasFeeCap != nil {
+			gasPrice = gasFeeCap
+		}
+	}
+	if gasFeeCap == nil {
+		gasFeeCap = gasPrice
+	}
+	if gasTipCap == nil {
+		gasTipCap = gasPrice
+	}
+	value := call.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+	return types.NewMessage(call.From, call.To, 0, value, gas, gasPrice, gasFeeCap, gasTipCap, call.Data, call.AccessList, true)
+}
+
+// call 执行后回滚状态, 合约 revert 时返回 *RevertError
+func (f *ForkBackend) call(ctx context.Context, call ethereum.CallMsg) (*core.ExecutionResult, error) {
+	header := f.pendingHeader()
+	snapshot := f.state.Snapshot()
+	defer f.state.RevertToSnapshot(snapshot)
+
+	result, err := f.execute(ctx, f.callMessage(call, header), header, true)
+	if err != nil {
+		return nil, err
+	}
+	if errors.Is(result.Err, vm.ErrExecutionReverted) {
+		revertErr := DecodeRevert(result.Revert())
+		revertErr.Message = result.Err.Error()
+		return result, revertErr
+	}
+	return result, result.Err
+}
+
+// CallContract blockNumber 为 nil 或最新区块时在本地执行
+func (f *ForkBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if local, err := f.isLocal(blockNumber); err != nil {
+		return nil, err
+	} else if !local {
+		return f.client.CallContract(ctx, call, blockNumber)
+	}
+
+	result, err := f.call(ctx, call)
+	if err != nil {
+		return nil, err
+	}
+	return result.Return(), nil
+}
+
+func (f *ForkBackend) PendingCallContract(ctx context.Context, call ethereum.CallMsg) ([]byte, error) {
+	return f.CallContract(ctx, call, nil)
+}
+
+// EstimateGas 二分查找交易能成功执行的最小 gas
+func (f *ForkBackend) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	hi := call.Gas
+	if hi < params.TxGas {
+		hi = f.pendingHeader().GasLimit
+	}
+	lo := params.TxGas - 1
+
+	executable := func(gas uint64) (bool, error) {
+		call.Gas = gas
+		_, err := f.call(ctx, call)
+		if err == nil {
+			return true, nil
+		}
+		var revertErr *RevertError
+		if errors.As(err, &revertErr) || errors.Is(err, core.ErrIntrinsicGas) || errors.Is(err, vm.ErrOutOfGas) ||
+			errors.Is(err, vm.ErrCodeStoreOutOfGas) || errors.Is(err, vm.ErrGasUintOverflow) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		ok, err := executable(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	// 最大 gas 仍失败时返回失败原因
+	call.Gas = hi
+	if _, err := f.call(ctx, call); err != nil {
+		return 0, err
+	}
+	return hi, nil
+}
+
+// SendTransaction 立即执行交易并出块, 交易本身无效 (nonce 错误 余额不足等) 时返回错误且状态不变
+func (f *ForkBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	f.mutex.Lock()
+
+	header := f.pendingHeader()
+	msg, err := tx.AsMessage(types.MakeSigner(f.config, header.Number), header.BaseFee)
+	if err != nil {
+		f.mutex.Unlock()
+		return err
+	}
+
+	snapshot := f.state.Snapshot()
+	result, err := f.execute(ctx, msg, header, false)
+	if err != nil {
+		f.state.RevertToSnapshot(snapshot)
+		f.mutex.Unlock()
+		return err
+	}
+
+	receipt := &types.Receipt{
+		Type:              tx.Type(),
+		Status:            types.ReceiptStatusSuccessful,
+		CumulativeGasUsed: result.UsedGas,
+		TxHash:            tx.Hash(),
+		GasUsed:           result.UsedGas,
+		Logs:              f.state.logs,
+		BlockNumber:       header.Number,
+	}
+	if result.Failed() {
+		receipt.Status = types.ReceiptStatusFailed
+	}
+	if tx.To() == nil {
+		receipt.ContractAddress = crypto.CreateAddress(msg.From(), tx.Nonce())
+	}
+	if receipt.Logs == nil {
+		receipt.Logs = []*types.Log{}
+	}
+	receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+
+	header.GasUsed = result.UsedGas
+	header.Bloom = receipt.Bloom
+	header.TxHash = types.DeriveSha(types.Transactions{tx}, trie.NewStackTrie(nil))
+	hash := header.Hash()
+	receipt.BlockHash = hash
+	for i, l := range receipt.Logs {
+		l.TxHash = tx.Hash()
+		l.BlockNumber = header.Number.Uint64()
+		l.BlockHash = hash
+		l.Index = uint(i)
+	}
+
+	f.state.finalise(f.config.IsEIP158(header.Number))
+	block := &forkBlock{header: header, hash: hash, tx: tx, receipt: receipt}
+	f.blocks = append(f.blocks, block)
+	f.blockHashes[header.Number.Uint64()] = hash
+	f.txs[tx.Hash()] = block
+	f.timeOffset = 0
+	f.mutex.Unlock()
+
+	if len(receipt.Logs) > 0 {
+		f.logsFeed.Send(receipt.Logs)
+	}
+	return nil
+}
+
+func (f *ForkBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if block, ok := f.txs[txHash]; ok {
+		return block.receipt, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (f *ForkBackend) TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if block, ok := f.txs[txHash]; ok {
+		return block.tx, false, nil
+	}
+	return nil, false, ethereum.NotFound
+}
+
+func (f *ForkBackend) BlockNumber(ctx context.Context) (uint64, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	head, _ := f.head()
+	return head.Number.Uint64(), nil
+}
+
+// HeaderByNumber nil latest pending 都为最新的本地区块
+func (f *ForkBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if number == nil || number.Sign() < 0 {
+		head, _ := f.head()
+		return types.CopyHeader(head), nil
+	}
+	if number.Cmp(f.forkNumber) > 0 {
+		index := new(big.Int).Sub(number, f.forkNumber).Uint64() - 1
+		if index >= uint64(len(f.blocks)) {
+			return nil, ethereum.NotFound
+		}
+		return types.CopyHeader(f.blocks[index].header), nil
+	}
+
+	header, _, err := f.client.headerByNumber(ctx, number)
+	return header, err
+}
+
+func (f *ForkBackend) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if local, err := f.isLocal(blockNumber); err != nil {
+		return nil, err
+	} else if !local {
+		return f.client.BalanceAt(ctx, account, blockNumber)
+	}
+	return f.read(ctx, func() interface{} { return f.state.GetBalance(account) }).(*big.Int), f.state.err
+}
+
+func (f *ForkBackend) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if local, err := f.isLocal(blockNumber); err != nil {
+		return 0, err
+	} else if !local {
+		return f.client.NonceAt(ctx, account, blockNumber)
+	}
+	return f.read(ctx, func() interface{} { return f.state.GetNonce(account) }).(uint64), f.state.err
+}
+
+func (f *ForkBackend) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if local, err := f.isLocal(blockNumber); err != nil {
+		return nil, err
+	} else if !local {
+		return f.client.CodeAt(ctx, account, blockNumber)
+	}
+	return f.read(ctx, func() interface{} { return f.state.GetCode(account) }).([]byte), f.state.err
+}
+
+func (f *ForkBackend) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if local, err := f.isLocal(blockNumber); err != nil {
+		return nil, err
+	} else if !local {
+		return f.client.StorageAt(ctx, account, key, blockNumber)
+	}
+	return f.read(ctx, func() interface{} { return f.state.GetState(account, key).Bytes() }).([]byte), f.state.err
+}
+
+// read 读取本地状态, 调用方持有锁并在返回后检查 f.state.err
+func (f *ForkBackend) read(ctx context.Context, fn func() interface{}) interface{} {
+	f.state.ctx = ctx
+	f.state.err = nil
+	defer func() { f.state.ctx = context.Background() }()
+	return fn()
+}
+
+func (f *ForkBackend) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return f.CodeAt(ctx, account, nil)
+}
+
+func (f *ForkBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return f.NonceAt(ctx, account, nil)
+}
+
+// SuggestGasPrice 没有 baseFee 的链固定为 1 gwei
+func (f *ForkBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	price := big.NewInt(defaultForkGasTipCap)
+	if baseFee := f.pendingHeader().BaseFee; baseFee != nil {
+		price.Add(price, baseFee)
+	}
+	return price, nil
+}
+
+func (f *ForkBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(defaultForkGasTipCap), nil
+}
+
+// FilterLogs 分叉区块及之前的部分从远程节点查询
+func (f *ForkBackend) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	f.mutex.Lock()
+	if query.BlockHash != nil {
+		for _, block := range f.blocks {
+			if block.hash == *query.BlockHash {
+				logs := filterLogs(block.receipt.Logs, query)
+				f.mutex.Unlock()
+				return logs, nil
+			}
+		}
+		f.mutex.Unlock()
+		return f.client.FilterLogs(ctx, query)
+	}
+
+	head, _ := f.head()
+	from, to := query.FromBlock, query.ToBlock
+	if from == nil {
+		from = new(big.Int)
+	}
+	if to == nil || to.Sign() < 0 || to.Cmp(head.Number) > 0 {
+		to = head.Number
+	}
+	var local []types.Log
+	for _, block := range f.blocks {
+		if block.header.Number.Cmp(from) >= 0 && block.header.Number.Cmp(to) <= 0 {
+			local = append(local, filterLogs(block.receipt.Logs, query)...)
+		}
+	}
+	f.mutex.Unlock()
+
+	if from.Cmp(f.forkNumber) > 0 {
+		return local, nil
+	}
+	remoteQuery := query
+	remoteQuery.FromBlock = from
+	remoteQuery.ToBlock = f.forkNumber
+	if to.Cmp(f.forkNumber) < 0 {
+		remoteQuery.ToBlock = to
+	}
+	remote, err := f.client.FilterLogs(ctx, remoteQuery)
+	if err != nil {
+		return nil, err
+	}
+	return append(remote, local...), nil
+}
+
+// SubscribeFilterLogs 只推送本地交易产生的日志
+func (f *ForkBackend) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	sink := make(chan []*types.Log)
+	sub := f.logsFeed.Subscribe(sink)
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case logs := <-sink:
+				for _, l := range filterLogs(logs, query) {
+					select {
+					case ch <- l:
+					case err := <-sub.Err():
+						return err
+					case <-quit:
+						return nil
+					}
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// SetBalance SetNonce SetCode SetStorageAt 直接修改本地状态, 不产生区块, 用于测试
+func (f *ForkBackend) SetBalance(ctx context.Context, account common.Address, balance *big.Int) error {
+	return f.modify(ctx, func() {
+		f.state.SubBalance(account, f.state.GetBalance(account))
+		f.state.AddBalance(account, balance)
+	})
+}
+
+func (f *ForkBackend) SetNonce(ctx context.Context, account common.Address, nonce uint64) error {
+	return f.modify(ctx, func() { f.state.SetNonce(account, nonce) })
+}
+
+func (f *ForkBackend) SetCode(ctx context.Context, account common.Address, code []byte) error {
+	return f.modify(ctx, func() { f.state.SetCode(account, code) })
+}
+
+func (f *ForkBackend) SetStorageAt(ctx context.Context, account common.Address, key common.Hash, value common.Hash) error {
+	return f.modify(ctx, func() { f.state.SetState(account, key, value) })
+}
+
+func (f *ForkBackend) modify(ctx context.Context, fn func()) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	snapshot := f.state.Snapshot()
+	f.read(ctx, func() interface{} {
+		fn()
+		return nil
+	})
+	if err := f.state.err; err != nil {
+		f.state.RevertToSnapshot(snapshot)
+		return err
+	}
+	// 直接修改状态不是交易, 不删除空账户, 否则无法给空账户设置存储
+	f.state.finalise(false)
+	return nil
+}
+
+// AdjustTime 下一个区块的时间戳增加 d
+func (f *ForkBackend) AdjustTime(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.timeOffset += uint64(d / time.Second)
+}
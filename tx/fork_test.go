@@ -0,0 +1,249 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/snail-plus/eth-pkg/contract"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var _ bind.ContractBackend = (*ForkBackend)(nil)
+var _ bind.DeployBackend = (*ForkBackend)(nil)
+
+// testTokenCode 调用数据超过 0x24 字节时 sstore(cd[4], cd[36]) 并 log1(topic=cd[4]), 否则返回 sload(cd[4])
+var testTokenCode = hexutil.MustDecode("0x602436116013576004355460005260206000f35b6024356004355560043560006000a100")
+
+// testForkConfig 测试节点的区块没有 baseFee, 不启用 London
+func testForkConfig() *params.ChainConfig {
+	config := *params.AllEthashProtocolChanges
+	config.ChainID = big.NewInt(1337)
+	config.LondonBlock = nil
+	config.ArrowGlacierBlock = nil
+	return &config
+}
+
+func TestForkBackend(t *testing.T) {
+	ctx := context.Background()
+	node := newTestNode(t, 1337, "1337")
+	token := common.HexToAddress("0x1000")
+	holder := common.HexToAddress("0x2000")
+	node.eth.codes = map[common.Address][]byte{token: testTokenCode}
+	node.eth.storage = map[common.Address]map[common.Hash]common.Hash{
+		token: {common.BytesToHash(holder[:]): common.BigToHash(big.NewInt(100))},
+	}
+
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork, err := client.NewForkBackend(ctx, nil, testForkConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	erc20, err := contract.NewErc20(token, fork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 测试节点查询零地址余额会报错
+	callOpts := &bind.CallOpts{From: holder}
+	balance, err := erc20.BalanceOf(callOpts, holder)
+	if err != nil || balance.Int64() != 100 {
+		t.Fatalf("unexpected remote balance %v %v", balance, err)
+	}
+
+	key, _ := crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	if err := fork.SetBalance(ctx, sender, big.NewInt(params.Ether)); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := make(chan types.Log, 1)
+	sub, err := fork.SubscribeFilterLogs(ctx, ethereum.FilterQuery{Addresses: []common.Address{token}}, logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	opts, _ := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	tx, err := erc20.Transfer(opts, holder, big.NewInt(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Nonce() != 7 {
+		t.Fatalf("nonce should come from remote node, got %d", tx.Nonce())
+	}
+
+	receipt, err := bind.WaitMined(ctx, fork, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful || receipt.BlockNumber.Uint64() != 101 || len(receipt.Logs) != 1 {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+	select {
+	case l := <-logs:
+		if l.Topics[0] != common.BytesToHash(holder[:]) || l.TxHash != tx.Hash() {
+			t.Fatalf("unexpected log %+v", l)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("log not delivered")
+	}
+
+	if balance, _ := erc20.BalanceOf(callOpts, holder); balance.Int64() != 42 {
+		t.Fatalf("state not updated: %v", balance)
+	}
+	if nonce, _ := fork.PendingNonceAt(ctx, sender); nonce != 8 {
+		t.Fatalf("unexpected nonce %d", nonce)
+	}
+	if senderBalance, _ := fork.BalanceAt(ctx, sender, nil); senderBalance.Cmp(big.NewInt(params.Ether)) >= 0 {
+		t.Fatal("gas fee not charged")
+	}
+
+	// 分叉区块在远程节点查询, 之后的历史区块不可用
+	if balance, _ := erc20.BalanceOf(&bind.CallOpts{From: holder, BlockNumber: big.NewInt(101)}, holder); balance.Int64() != 42 {
+		t.Fatalf("head block should be local: %v", balance)
+	}
+	if _, err := fork.CodeAt(ctx, token, big.NewInt(100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fork.CallContract(ctx, ethereum.CallMsg{From: holder, To: &token}, big.NewInt(200)); !errors.Is(err, ErrForkStateUnavailable) {
+		t.Fatalf("expected unavailable state, got %v", err)
+	}
+
+	filtered, err := fork.FilterLogs(ctx, ethereum.FilterQuery{FromBlock: big.NewInt(101), Addresses: []common.Address{token}})
+	if err != nil || len(filtered) != 1 {
+		t.Fatalf("unexpected filtered logs %v %v", filtered, err)
+	}
+
+	// nonce 错误的交易不改变状态
+	if err := fork.SendTransaction(ctx, tx); err == nil {
+		t.Fatal("expected nonce error")
+	}
+	if number, _ := fork.BlockNumber(ctx); number != 101 {
+		t.Fatalf("unexpected block number %d", number)
+	}
+
+	// latest 和 pending 对应本地最新区块, 不转发到远程节点
+	for _, number := range []rpc.BlockNumber{rpc.LatestBlockNumber, rpc.PendingBlockNumber} {
+		if header, err := fork.HeaderByNumber(ctx, big.NewInt(number.Int64())); err != nil || header.Number.Uint64() != 101 {
+			t.Fatalf("block %d should resolve to local head: %v %v", number, header, err)
+		}
+	}
+
+	// EIP-158: 0 转账 touch 的空账户在交易结束时删除. 测试节点的 nonce 都是 7, 先在本地清空账户,
+	// 直接修改状态不是交易, 不删除空账户
+	empty := common.HexToAddress("0x3000")
+	if err := fork.SetNonce(ctx, empty, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := fork.SetBalance(ctx, empty, new(big.Int)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fork.SetCode(ctx, empty, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !fork.state.Exist(empty) || !fork.state.Empty(empty) {
+		t.Fatal("modified account should exist and be empty")
+	}
+	gasPrice, err := fork.SuggestGasPrice(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	touchTx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(1337)), &types.LegacyTx{
+		Nonce:    8,
+		To:       &empty,
+		Gas:      21000,
+		GasPrice: gasPrice,
+		Value:    new(big.Int),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fork.SendTransaction(ctx, touchTx); err != nil {
+		t.Fatal(err)
+	}
+	if fork.state.Exist(empty) {
+		t.Fatal("touched empty account should be deleted")
+	}
+}
+
+func TestForkClient(t *testing.T) {
+	ctx := context.Background()
+	node := newTestNode(t, 1337, "1337")
+	token := common.HexToAddress("0x1000")
+	holder := common.HexToAddress("0x2000")
+	node.eth.codes = map[common.Address][]byte{token: testTokenCode}
+
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有内置配置的链必须传入链配置
+	if _, err := client.NewForkBackend(ctx, nil, nil); !errors.Is(err, ErrUnknownForkChain) {
+		t.Fatalf("expected unknown chain error, got %v", err)
+	}
+	fork, err := client.NewForkBackend(ctx, nil, testForkConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "0x4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+	sender := crypto.PubkeyToAddress(crypto.ToECDSAUnsafe(hexutil.MustDecode(key)).PublicKey)
+	if err := fork.SetBalance(ctx, sender, big.NewInt(params.Ether)); err != nil {
+		t.Fatal(err)
+	}
+
+	forkClient, err := fork.Client(ctx, WithReceiptPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer forkClient.Close()
+
+	data := append(hexutil.MustDecode("0xa9059cbb"), common.LeftPadBytes(holder[:], 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(42).Bytes(), 32)...)
+	manager := NewDefaultTransactionManager(forkClient, key)
+	hash, err := manager.ExecuteTransaction(token.Hex(), data, nil, big.NewInt(params.GWei), 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	receipt, err := forkClient.WaitMined(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful || receipt.BlockNumber.Uint64() != 101 ||
+		receipt.EffectiveGasPrice.Int64() != params.GWei || len(receipt.Logs) != 1 {
+		t.Fatalf("unexpected receipt %+v", receipt)
+	}
+	tx, pending, err := forkClient.TransactionByHash(ctx, hash)
+	if err != nil || pending || tx.Nonce() != 7 {
+		t.Fatalf("unexpected tx %v %v %v", tx, pending, err)
+	}
+	// 测试节点查询零地址余额会报错, 调用时指定 from
+	balanceOf := ethereum.CallMsg{From: holder, To: &token, Data: append(common.CopyBytes(balanceOfSelector), common.LeftPadBytes(holder[:], 32)...)}
+	if balance, err := forkClient.CallContract(ctx, balanceOf, nil); err != nil || new(big.Int).SetBytes(balance).Int64() != 42 {
+		t.Fatalf("unexpected balance %x %v", balance, err)
+	}
+	if number, err := forkClient.BlockNumber(ctx); err != nil || number != 101 {
+		t.Fatalf("unexpected block number %d %v", number, err)
+	}
+	if header, err := forkClient.HeaderByNumber(ctx, big.NewInt(100)); err != nil || header.Number.Uint64() != 100 {
+		t.Fatalf("fork block should come from remote node: %v %v", header, err)
+	}
+
+	// 远程节点上的状态不受影响
+	if balance, err := client.CallContract(ctx, balanceOf, nil); err != nil || new(big.Int).SetBytes(balance).Sign() != 0 {
+		t.Fatalf("remote state changed: %x %v", balance, err)
+	}
+}
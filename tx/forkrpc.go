@@ -0,0 +1,308 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/filters"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+)
+
+// Client 返回在分叉状态上工作的 Web3Client, 内部通过进程内 JSON-RPC 连接访问 ForkBackend,
+// 签名 发送交易 等待回执以及 NewDefaultTransactionManager 的 ExecuteTransaction 都在本地执行.
+// 只提供 eth_ 的查询 调用和发送交易, 不支持 filter 订阅和 debug_ 方法
+func (f *ForkBackend) Client(ctx context.Context, opts ...Option) (*Web3Client, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &forkEthService{fork: f}); err != nil {
+		return nil, err
+	}
+	if err := server.RegisterName("net", &forkNetService{fork: f}); err != nil {
+		return nil, err
+	}
+
+	opts = append(append([]Option{}, opts...), withInProcServer(server))
+	return NewWeb3ClientWithOptions(ctx, "inproc://fork", opts...)
+}
+
+type forkNetService struct {
+	fork *ForkBackend
+}
+
+func (s *forkNetService) Version() (string, error) {
+	networkId, err := s.fork.client.NetworkID()
+	if err != nil {
+		return "", err
+	}
+	return networkId.String(), nil
+}
+
+// forkCallArgs eth_call eth_estimateGas 的参数
+type forkCallArgs struct {
+	From                 *common.Address `json:"from"`
+	To                   *common.Address `json:"to"`
+	Gas                  *hexutil.Uint64 `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+	Value                *hexutil.Big    `json:"value"`
+	Data                 *hexutil.Bytes  `json:"data"`
+	Input                *hexutil.Bytes  `json:"input"`
+}
+
+func (args forkCallArgs) toCallMsg() ethereum.CallMsg {
+	var msg ethereum.CallMsg
+	if args.From != nil {
+		msg.From = *args.From
+	}
+	msg.To = args.To
+	if args.Gas != nil {
+		msg.Gas = uint64(*args.Gas)
+	}
+	msg.GasPrice = (*big.Int)(args.GasPrice)
+	msg.GasFeeCap = (*big.Int)(args.MaxFeePerGas)
+	msg.GasTipCap = (*big.Int)(args.MaxPriorityFeePerGas)
+	msg.Value = (*big.Int)(args.Value)
+	if args.Input != nil {
+		msg.Data = *args.Input
+	} else if args.Data != nil {
+		msg.Data = *args.Data
+	}
+	return msg
+}
+
+// forkRevertError 与 geth 一致, revert 时返回 code 3 以及十六进制的 revert 数据
+type forkRevertError struct {
+	*RevertError
+}
+
+func (e forkRevertError) ErrorCode() int {
+	return revertErrorCode
+}
+
+func (e forkRevertError) ErrorData() interface{} {
+	return hexutil.Encode(e.Data)
+}
+
+func toForkRpcError(err error) error {
+	var revertErr *RevertError
+	if errors.As(err, &revertErr) {
+		return forkRevertError{RevertError: revertErr}
+	}
+	return err
+}
+
+// forkBlockArg latest 和 pending 对应本地最新状态
+func forkBlockArg(number rpc.BlockNumber) *big.Int {
+	if number < 0 {
+		return nil
+	}
+	return big.NewInt(number.Int64())
+}
+
+type forkEthService struct {
+	fork *ForkBackend
+}
+
+func (s *forkEthService) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(s.fork.config.ChainID)
+}
+
+func (s *forkEthService) BlockNumber(ctx context.Context) (hexutil.Uint64, error) {
+	number, err := s.fork.BlockNumber(ctx)
+	return hexutil.Uint64(number), err
+}
+
+func (s *forkEthService) GasPrice(ctx context.Context) (*hexutil.Big, error) {
+	price, err := s.fork.SuggestGasPrice(ctx)
+	return (*hexutil.Big)(price), err
+}
+
+func (s *forkEthService) MaxPriorityFeePerGas(ctx context.Context) (*hexutil.Big, error) {
+	tip, err := s.fork.SuggestGasTipCap(ctx)
+	return (*hexutil.Big)(tip), err
+}
+
+func (s *forkEthService) GetBalance(ctx context.Context, address common.Address, number rpc.BlockNumber) (*hexutil.Big, error) {
+	balance, err := s.fork.BalanceAt(ctx, address, forkBlockArg(number))
+	return (*hexutil.Big)(balance), err
+}
+
+func (s *forkEthService) GetTransactionCount(ctx context.Context, address common.Address, number rpc.BlockNumber) (hexutil.Uint64, error) {
+	nonce, err := s.fork.NonceAt(ctx, address, forkBlockArg(number))
+	return hexutil.Uint64(nonce), err
+}
+
+func (s *forkEthService) GetCode(ctx context.Context, address common.Address, number rpc.BlockNumber) (hexutil.Bytes, error) {
+	return s.fork.CodeAt(ctx, address, forkBlockArg(number))
+}
+
+func (s *forkEthService) GetStorageAt(ctx context.Context, address common.Address, key string, number rpc.BlockNumber) (hexutil.Bytes, error) {
+	return s.fork.StorageAt(ctx, address, common.HexToHash(key), forkBlockArg(number))
+}
+
+func (s *forkEthService) Call(ctx context.Context, args forkCallArgs, number rpc.BlockNumber) (hexutil.Bytes, error) {
+	result, err := s.fork.CallContract(ctx, args.toCallMsg(), forkBlockArg(number))
+	return result, toForkRpcError(err)
+}
+
+func (s *forkEthService) EstimateGas(ctx context.Context, args forkCallArgs, number *rpc.BlockNumber) (hexutil.Uint64, error) {
+	gas, err := s.fork.EstimateGas(ctx, args.toCallMsg())
+	return hexutil.Uint64(gas), toForkRpcError(err)
+}
+
+func (s *forkEthService) SendRawTransaction(ctx context.Context, input hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	if err := s.fork.SendTransaction(ctx, tx); err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), nil
+}
+
+func (s *forkEthService) GetLogs(ctx context.Context, criteria filters.FilterCriteria) ([]types.Log, error) {
+	query := ethereum.FilterQuery(criteria)
+	if query.FromBlock != nil && query.FromBlock.Sign() < 0 {
+		number, err := s.fork.BlockNumber(ctx)
+		if err != nil {
+			return nil, err
+		}
+		query.FromBlock = new(big.Int).SetUint64(number)
+	}
+	logs, err := s.fork.FilterLogs(ctx, query)
+	if logs == nil && err == nil {
+		logs = []types.Log{}
+	}
+	return logs, err
+}
+
+// GetBlockByNumber 本地区块直接返回, 分叉区块及之前的区块转发到远程节点
+func (s *forkEthService) GetBlockByNumber(ctx context.Context, number rpc.BlockNumber, fullTx bool) (interface{}, error) {
+	f := s.fork
+	f.mutex.Lock()
+	head, _ := f.head()
+	n := head.Number
+	if number >= 0 {
+		n = big.NewInt(number.Int64())
+	}
+	if n.Cmp(f.forkNumber) <= 0 {
+		f.mutex.Unlock()
+		return s.remote(ctx, "eth_getBlockByNumber", hexutil.EncodeBig(n), fullTx)
+	}
+
+	index := new(big.Int).Sub(n, f.forkNumber).Uint64() - 1
+	if index >= uint64(len(f.blocks)) {
+		f.mutex.Unlock()
+		return nil, nil
+	}
+	block := f.blocks[index]
+	f.mutex.Unlock()
+	return s.marshalBlock(block, fullTx)
+}
+
+func (s *forkEthService) GetTransactionByHash(ctx context.Context, hash common.Hash) (interface{}, error) {
+	if block := s.localBlock(hash); block != nil {
+		return s.marshalTx(block)
+	}
+	return s.remote(ctx, "eth_getTransactionByHash", hash)
+}
+
+func (s *forkEthService) GetTransactionReceipt(ctx context.Context, hash common.Hash) (interface{}, error) {
+	block := s.localBlock(hash)
+	if block == nil {
+		return s.remote(ctx, "eth_getTransactionReceipt", hash)
+	}
+
+	fields, err := jsonFields(block.receipt)
+	if err != nil {
+		return nil, err
+	}
+	signer := types.MakeSigner(s.fork.config, block.header.Number)
+	from, err := types.Sender(signer, block.tx)
+	if err != nil {
+		return nil, err
+	}
+	fields["from"] = from
+	fields["to"] = block.tx.To()
+	fields["effectiveGasPrice"] = (*hexutil.Big)(forkEffectiveGasPrice(block.tx, block.header.BaseFee))
+	return fields, nil
+}
+
+func (s *forkEthService) localBlock(hash common.Hash) *forkBlock {
+	s.fork.mutex.Lock()
+	defer s.fork.mutex.Unlock()
+	return s.fork.txs[hash]
+}
+
+// remote 转发到远程节点, 结果为 null 时返回 nil
+func (s *forkEthService) remote(ctx context.Context, method string, args ...interface{}) (interface{}, error) {
+	raw, err := s.fork.client.rawCall(ctx, method, args...)
+	if err != nil {
+		return nil, err
+	}
+	return nullRaw(raw), nil
+}
+
+func (s *forkEthService) marshalBlock(block *forkBlock, fullTx bool) (map[string]interface{}, error) {
+	fields, err := jsonFields(block.header)
+	if err != nil {
+		return nil, err
+	}
+	fields["hash"] = block.hash
+	fields["uncles"] = []common.Hash{}
+	if !fullTx {
+		fields["transactions"] = []common.Hash{block.tx.Hash()}
+		return fields, nil
+	}
+	txFields, err := s.marshalTx(block)
+	if err != nil {
+		return nil, err
+	}
+	fields["transactions"] = []interface{}{txFields}
+	return fields, nil
+}
+
+// marshalTx 按 geth 的 RPCTransaction 格式输出, 本地每个区块只有一笔交易
+func (s *forkEthService) marshalTx(block *forkBlock) (map[string]interface{}, error) {
+	fields, err := jsonFields(block.tx)
+	if err != nil {
+		return nil, err
+	}
+	signer := types.MakeSigner(s.fork.config, block.header.Number)
+	from, err := types.Sender(signer, block.tx)
+	if err != nil {
+		return nil, err
+	}
+	fields["from"] = from
+	fields["to"] = block.tx.To()
+	fields["blockHash"] = block.hash
+	fields["blockNumber"] = (*hexutil.Big)(block.header.Number)
+	fields["transactionIndex"] = hexutil.Uint64(0)
+	fields["gasPrice"] = (*hexutil.Big)(forkEffectiveGasPrice(block.tx, block.header.BaseFee))
+	return fields, nil
+}
+
+func forkEffectiveGasPrice(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	if baseFee == nil || tx.Type() != types.DynamicFeeTxType {
+		return tx.GasPrice()
+	}
+	return math.BigMin(new(big.Int).Add(tx.GasTipCap(), baseFee), tx.GasFeeCap())
+}
+
+// jsonFields 把 geth 类型的 JSON 编码转换成 map, 便于补充 RPC 额外返回的字段
+func jsonFields(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
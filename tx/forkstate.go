@@ -0,0 +1,401 @@
+package tx
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+)
+
+// forkSource 远程节点在分叉区块的状态
+type forkSource interface {
+	account(ctx context.Context, address common.Address) (balance *big.Int, nonce uint64, code []byte, err error)
+	storage(ctx context.Context, address common.Address, slot common.Hash) (common.Hash, error)
+}
+
+type forkAccount struct {
+	balance  *big.Int
+	nonce    uint64
+	code     []byte
+	codeHash common.Hash
+	exists   bool
+	suicided bool
+	// 当前交易修改过, EIP-158 在交易结束时删除修改过的空账户
+	touched bool
+	// 本地新建的账户不从远程节点读取存储
+	created bool
+	// 当前交易修改过的存储
+	dirty map[common.Hash]common.Hash
+	// 交易开始前的存储, 包括从远程节点读取的
+	committed map[common.Hash]common.Hash
+}
+
+func (a *forkAccount) setCode(code []byte) {
+	a.code = code
+	a.codeHash = crypto.Keccak256Hash(code)
+}
+
+// forkState 实现 vm.StateDB, 账户第一次访问时从远程节点读取, 之后只在本地修改.
+// 读取远程状态失败时记录第一个错误, 执行结束后由调用方检查
+type forkState struct {
+	source forkSource
+	ctx    context.Context
+	err    error
+
+	accounts map[common.Address]*forkAccount
+	journal  []func()
+	refund   uint64
+	logs     []*types.Log
+
+	accessAddresses map[common.Address]map[common.Hash]struct{}
+}
+
+func newForkState(source forkSource) *forkState {
+	return &forkState{
+		source:          source,
+		ctx:             context.Background(),
+		accounts:        make(map[common.Address]*forkAccount),
+		accessAddresses: make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+func (s *forkState) setError(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *forkState) getAccount(address common.Address) *forkAccount {
+	if account, ok := s.accounts[address]; ok {
+		return account
+	}
+
+	account := &forkAccount{
+		balance:   new(big.Int),
+		codeHash:  crypto.Keccak256Hash(nil),
+		dirty:     make(map[common.Hash]common.Hash),
+		committed: make(map[common.Hash]common.Hash),
+	}
+	balance, nonce, code, err := s.source.account(s.ctx, address)
+	if err != nil {
+		// 不缓存, 下次访问重新读取
+		s.setError(err)
+		return account
+	}
+
+	account.balance = balance
+	account.nonce = nonce
+	account.setCode(code)
+	account.exists = balance.Sign() != 0 || nonce != 0 || len(code) > 0
+	s.accounts[address] = account
+	return account
+}
+
+// touch 修改账户前调用, 账户不存在时创建
+func (s *forkState) touch(account *forkAccount) {
+	if !account.touched {
+		account.touched = true
+		s.journal = append(s.journal, func() { account.touched = false })
+	}
+	if account.exists {
+		return
+	}
+	account.exists = true
+	s.journal = append(s.journal, func() { account.exists = false })
+}
+
+func (s *forkState) CreateAccount(address common.Address) {
+	prev, ok := s.accounts[address]
+	account := &forkAccount{
+		balance:   new(big.Int),
+		codeHash:  crypto.Keccak256Hash(nil),
+		exists:    true,
+		created:   true,
+		dirty:     make(map[common.Hash]common.Hash),
+		committed: make(map[common.Hash]common.Hash),
+	}
+	if ok {
+		account.balance = new(big.Int).Set(prev.balance)
+	} else {
+		account.balance = new(big.Int).Set(s.getAccount(address).balance)
+		prev, ok = s.accounts[address]
+	}
+	s.accounts[address] = account
+	s.journal = append(s.journal, func() {
+		if ok {
+			s.accounts[address] = prev
+		} else {
+			delete(s.accounts, address)
+		}
+	})
+}
+
+func (s *forkState) SubBalance(address common.Address, amount *big.Int) {
+	account := s.getAccount(address)
+	s.touch(account)
+	if amount.Sign() == 0 {
+		return
+	}
+	s.setBalance(account, new(big.Int).Sub(account.balance, amount))
+}
+
+func (s *forkState) AddBalance(address common.Address, amount *big.Int) {
+	account := s.getAccount(address)
+	s.touch(account)
+	if amount.Sign() == 0 {
+		return
+	}
+	s.setBalance(account, new(big.Int).Add(account.balance, amount))
+}
+
+func (s *forkState) setBalance(account *forkAccount, balance *big.Int) {
+	prev := account.balance
+	account.balance = balance
+	s.journal = append(s.journal, func() { account.balance = prev })
+}
+
+func (s *forkState) GetBalance(address common.Address) *big.Int {
+	return new(big.Int).Set(s.getAccount(address).balance)
+}
+
+func (s *forkState) GetNonce(address common.Address) uint64 {
+	return s.getAccount(address).nonce
+}
+
+func (s *forkState) SetNonce(address common.Address, nonce uint64) {
+	account := s.getAccount(address)
+	s.touch(account)
+	prev := account.nonce
+	account.nonce = nonce
+	s.journal = append(s.journal, func() { account.nonce = prev })
+}
+
+func (s *forkState) GetCodeHash(address common.Address) common.Hash {
+	account := s.getAccount(address)
+	if !account.exists && !account.suicided {
+		return common.Hash{}
+	}
+	return account.codeHash
+}
+
+func (s *forkState) GetCode(address common.Address) []byte {
+	return s.getAccount(address).code
+}
+
+func (s *forkState) SetCode(address common.Address, code []byte) {
+	account := s.getAccount(address)
+	s.touch(account)
+	prev := account.code
+	account.setCode(code)
+	s.journal = append(s.journal, func() { account.setCode(prev) })
+}
+
+func (s *forkState) GetCodeSize(address common.Address) int {
+	return len(s.getAccount(address).code)
+}
+
+func (s *forkState) AddRefund(gas uint64) {
+	prev := s.refund
+	s.refund += gas
+	s.journal = append(s.journal, func() { s.refund = prev })
+}
+
+func (s *forkState) SubRefund(gas uint64) {
+	prev := s.refund
+	if gas > s.refund {
+		gas = s.refund
+	}
+	s.refund -= gas
+	s.journal = append(s.journal, func() { s.refund = prev })
+}
+
+func (s *forkState) GetRefund() uint64 {
+	return s.refund
+}
+
+func (s *forkState) GetCommittedState(address common.Address, slot common.Hash) common.Hash {
+	account := s.getAccount(address)
+	if value, ok := account.committed[slot]; ok {
+		return value
+	}
+	if account.created {
+		return common.Hash{}
+	}
+
+	value, err := s.source.storage(s.ctx, address, slot)
+	if err != nil {
+		s.setError(err)
+		return common.Hash{}
+	}
+	account.committed[slot] = value
+	return value
+}
+
+func (s *forkState) GetState(address common.Address, slot common.Hash) common.Hash {
+	if value, ok := s.getAccount(address).dirty[slot]; ok {
+		return value
+	}
+	return s.GetCommittedState(address, slot)
+}
+
+func (s *forkState) SetState(address common.Address, slot common.Hash, value common.Hash) {
+	account := s.getAccount(address)
+	s.touch(account)
+	prev, ok := account.dirty[slot]
+	account.dirty[slot] = value
+	s.journal = append(s.journal, func() {
+		if ok {
+			account.dirty[slot] = prev
+		} else {
+			delete(account.dirty, slot)
+		}
+	})
+}
+
+func (s *forkState) Suicide(address common.Address) bool {
+	account := s.getAccount(address)
+	if !account.exists {
+		return false
+	}
+
+	prevSuicided, prevBalance := account.suicided, account.balance
+	account.suicided = true
+	account.balance = new(big.Int)
+	s.journal = append(s.journal, func() {
+		account.suicided = prevSuicided
+		account.balance = prevBalance
+	})
+	return true
+}
+
+func (s *forkState) HasSuicided(address common.Address) bool {
+	return s.getAccount(address).suicided
+}
+
+func (s *forkState) Exist(address common.Address) bool {
+	account := s.getAccount(address)
+	return account.exists || account.suicided
+}
+
+func (s *forkState) Empty(address common.Address) bool {
+	account := s.getAccount(address)
+	return account.balance.Sign() == 0 && account.nonce == 0 && len(account.code) == 0
+}
+
+func (s *forkState) PrepareAccessList(sender common.Address, dest *common.Address, precompiles []common.Address, txAccesses types.AccessList) {
+	prev := s.accessAddresses
+	s.accessAddresses = make(map[common.Address]map[common.Hash]struct{})
+	s.journal = append(s.journal, func() { s.accessAddresses = prev })
+
+	s.AddAddressToAccessList(sender)
+	if dest != nil {
+		s.AddAddressToAccessList(*dest)
+	}
+	for _, address := range precompiles {
+		s.AddAddressToAccessList(address)
+	}
+	for _, tuple := range txAccesses {
+		s.AddAddressToAccessList(tuple.Address)
+		for _, slot := range tuple.StorageKeys {
+			s.AddSlotToAccessList(tuple.Address, slot)
+		}
+	}
+}
+
+func (s *forkState) AddressInAccessList(address common.Address) bool {
+	_, ok := s.accessAddresses[address]
+	return ok
+}
+
+func (s *forkState) SlotInAccessList(address common.Address, slot common.Hash) (addressOk bool, slotOk bool) {
+	slots, addressOk := s.accessAddresses[address]
+	if !addressOk {
+		return false, false
+	}
+	_, slotOk = slots[slot]
+	return addressOk, slotOk
+}
+
+func (s *forkState) AddAddressToAccessList(address common.Address) {
+	if _, ok := s.accessAddresses[address]; ok {
+		return
+	}
+	accessAddresses := s.accessAddresses
+	accessAddresses[address] = make(map[common.Hash]struct{})
+	s.journal = append(s.journal, func() { delete(accessAddresses, address) })
+}
+
+func (s *forkState) AddSlotToAccessList(address common.Address, slot common.Hash) {
+	s.AddAddressToAccessList(address)
+	slots := s.accessAddresses[address]
+	if _, ok := slots[slot]; ok {
+		return
+	}
+	slots[slot] = struct{}{}
+	s.journal = append(s.journal, func() { delete(slots, slot) })
+}
+
+func (s *forkState) Snapshot() int {
+	return len(s.journal)
+}
+
+func (s *forkState) RevertToSnapshot(id int) {
+	for i := len(s.journal) - 1; i >= id; i-- {
+		s.journal[i]()
+	}
+	s.journal = s.journal[:id]
+}
+
+func (s *forkState) AddLog(l *types.Log) {
+	s.logs = append(s.logs, l)
+	s.journal = append(s.journal, func() { s.logs = s.logs[:len(s.logs)-1] })
+}
+
+func (s *forkState) AddPreimage(hash common.Hash, preimage []byte) {}
+
+// ForEachStorage 只遍历本地修改过以及已读取的存储
+func (s *forkState) ForEachStorage(address common.Address, cb func(key, value common.Hash) bool) error {
+	account := s.getAccount(address)
+	for slot, value := range account.committed {
+		if _, ok := account.dirty[slot]; ok {
+			continue
+		}
+		if !cb(slot, value) {
+			return nil
+		}
+	}
+	for slot, value := range account.dirty {
+		if !cb(slot, value) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// finalise 交易执行完成, 删除自毁的账户并清空本次交易的临时状态.
+// deleteEmpty 为 true 时 (EIP-158) 同时删除本次交易修改过的空账户
+func (s *forkState) finalise(deleteEmpty bool) {
+	for address, account := range s.accounts {
+		if account.suicided || (deleteEmpty && account.touched && s.Empty(address)) {
+			s.accounts[address] = &forkAccount{
+				balance:   new(big.Int),
+				codeHash:  crypto.Keccak256Hash(nil),
+				created:   true,
+				dirty:     make(map[common.Hash]common.Hash),
+				committed: make(map[common.Hash]common.Hash),
+			}
+			continue
+		}
+		for slot, value := range account.dirty {
+			account.committed[slot] = value
+		}
+		account.dirty = make(map[common.Hash]common.Hash)
+		account.touched = false
+	}
+
+	s.journal = nil
+	s.refund = 0
+	s.logs = nil
+	s.accessAddresses = make(map[common.Address]map[common.Hash]struct{})
+}
@@ -52,6 +52,10 @@ func NewGasProvider() GasProvider {
 }
 
 func NewDynamicGasProvider(ethClient *ethclient.Client) GasProvider {
+	return newDynamicGasProvider(ethClient, time.Minute)
+}
+
+func newDynamicGasProvider(ethClient *ethclient.Client, interval time.Duration) GasProvider {
 	var gasValue atomic.Value
 	gasValue.Store(big.NewInt(params.GWei * 5))
 
@@ -59,7 +63,7 @@ func NewDynamicGasProvider(ethClient *ethclient.Client) GasProvider {
 		gasPrice:  gasValue,
 		gasLimit:  big.NewInt(3000000),
 		ethClient: ethClient,
-		ticker:    time.NewTicker(1 * time.Minute),
+		ticker:    time.NewTicker(interval),
 	}
 
 	go func() {
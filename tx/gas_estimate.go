@@ -0,0 +1,106 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math"
+	"math/big"
+)
+
+const (
+	defaultGasEstimateMultiplier = 1.2
+)
+
+// ErrGasLimitExceedsCap 预估的 gas 超过配置的上限
+var ErrGasLimitExceedsCap = errors.New("estimated gas exceeds cap")
+
+// EstimateGasError eth_estimateGas 失败, 合约 revert 时 Reason 为 revert 原因, Data 为原始 revert 数据
+type EstimateGasError struct {
+	Reason string
+	Data   []byte
+	Err    error
+}
+
+func (e *EstimateGasError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("estimate gas reverted: %s", e.Reason)
+	}
+	return fmt.Sprintf("estimate gas: %s", e.Err.Error())
+}
+
+func (e *EstimateGasError) Unwrap() error {
+	return e.Err
+}
+
+// revertData 从 JSON-RPC 错误的 data 字段中取出 revert 数据
+func revertData(err error) []byte {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return nil
+	}
+
+	str, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return nil
+	}
+	data, decodeErr := hexutil.Decode(str)
+	if decodeErr != nil {
+		return nil
+	}
+	return data
+}
+
+// EstimateGas eth_estimateGas, 失败时返回 *EstimateGasError
+func (e *Web3Client) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	var gas hexutil.Uint64
+	err := e.call(ctx, "eth_estimateGas", func(ep *endpoint) error {
+		return ep.rpcClient.CallContext(ctx, &gas, "eth_estimateGas", toCallArg(msg))
+	})
+	if err != nil {
+		estimateErr := &EstimateGasError{Err: err, Data: revertData(err)}
+		if reason, unpackErr := abi.UnpackRevert(estimateErr.Data); unpackErr == nil {
+			estimateErr.Reason = reason
+		}
+		return 0, estimateErr
+	}
+	return uint64(gas), nil
+}
+
+// estimateGasLimit 预估 gas 后乘以安全系数, 不超过配置的上限
+func (e *Web3Client) estimateGasLimit(ctx context.Context, from common.Address, txInfo TransactionInfo, value *big.Int) (uint64, error) {
+	msg := ethereum.CallMsg{
+		From:  from,
+		Value: value,
+		Data:  txInfo.Data,
+	}
+	if txInfo.To != "" {
+		to := common.HexToAddress(txInfo.To)
+		msg.To = &to
+	}
+
+	estimated, err := e.EstimateGas(ctx, msg)
+	if err != nil {
+		return 0, err
+	}
+
+	gasCap := e.options.gasLimitCap
+	if gasCap > 0 && estimated > gasCap {
+		return 0, fmt.Errorf("%w: estimated %d, cap %d", ErrGasLimitExceedsCap, estimated, gasCap)
+	}
+
+	multiplier := e.options.gasEstimateMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	gas := uint64(math.Ceil(float64(estimated) * multiplier))
+	if gasCap > 0 && gas > gasCap {
+		gas = gasCap
+	}
+	return gas, nil
+}
@@ -0,0 +1,55 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+)
+
+func TestSignNewTxEstimateGas(t *testing.T) {
+	ctx := context.Background()
+	node := newTestNode(t, 56, "56")
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL, WithGasLimitCap(100000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txInfo := TransactionInfo{
+		To:            "0x10ED43C718714eb63d5aA57B78B54704E256024E",
+		PrivateKeyStr: "0x4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318",
+		Value:         big.NewInt(1000),
+		Data:          common.FromHex("0x38ed1739"),
+	}
+	tx, err := client.SignNewTx(ctx, txInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Gas() != 60000 || tx.Value().Int64() != 1000 || tx.Nonce() != 7 {
+		t.Fatalf("unexpected gas %d value %s nonce %d", tx.Gas(), tx.Value(), tx.Nonce())
+	}
+
+	txInfo.GasLimit = 21000
+	tx, err = client.SignNewTx(ctx, txInfo)
+	if err != nil || tx.Gas() != 21000 {
+		t.Fatalf("explicit gas limit ignored: %v", err)
+	}
+
+	txInfo.GasLimit = 0
+	txInfo.Data = common.FromHex("0xdeadbeef")
+	_, err = client.SignNewTx(ctx, txInfo)
+	var estimateErr *EstimateGasError
+	if !errors.As(err, &estimateErr) || estimateErr.Reason != "insufficient output amount" {
+		t.Fatalf("expected revert reason, got %v", err)
+	}
+
+	client, err = NewWeb3ClientWithOptions(ctx, node.URL, WithGasLimitCap(40000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	txInfo.Data = nil
+	if _, err = client.SignNewTx(ctx, txInfo); !errors.Is(err, ErrGasLimitExceedsCap) {
+		t.Fatalf("expected ErrGasLimitExceedsCap, got %v", err)
+	}
+}
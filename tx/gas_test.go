@@ -0,0 +1,41 @@
+package tx
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/snail-plus/eth-pkg/tx/txtest"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestDynamicGasProvider(t *testing.T) {
+	sim := txtest.NewSimChain(t)
+	ethClient, err := ethclient.Dial(sim.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ethClient.Close()
+
+	expected, err := ethClient.SuggestGasPrice(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected.Cmp(big.NewInt(params.GWei*5)) == 0 {
+		t.Fatal("sim chain gas price should differ from the initial price")
+	}
+
+	provider := newDynamicGasProvider(ethClient, 10*time.Millisecond)
+	if provider.GetGasLimit("").Int64() != 3000000 {
+		t.Fatalf("unexpected gas limit %v", provider.GetGasLimit(""))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for provider.GetGasPrice("").Cmp(expected) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("gas price not refreshed: %v, expected %v", provider.GetGasPrice(""), expected)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
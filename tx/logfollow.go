@@ -0,0 +1,183 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const methodNotFoundErrorCode = -32601
+
+// EthLogFollow 从 query.FromBlock 开始输出日志: 先用 GetLogsRange 分段补齐到当前区块, 再切换到实时日志.
+// 节点支持 eth_subscribe 时使用 WebSocket 订阅, 否则每 pullInterval 毫秒轮询 log filter.
+// 实时订阅在补齐之前建立, 补齐末尾 defaultMaxReorgDepth 个区块内的实时日志按 (blockHash, txIndex, logIndex) 去重:
+// 已经输出的日志不再重复输出, 重组后的新日志照常输出, Removed 日志只在对应日志已经输出过时转发, 因此两段之间没有遗漏和重复.
+// query 只使用 Addresses Topics 和 FromBlock, FromBlock 为 0 或 latest 时不补齐
+func (e *Web3Client) EthLogFollow(ctx context.Context, query FilterQuery, pullInterval int64) (*LogSubscription, error) {
+	if query.BlockHash != nil {
+		return nil, errors.New("log follow does not support BlockHash")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	live, err := e.subscribeLiveLogs(ctx, query, pullInterval)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	head, err := e.BlockNumber(ctx)
+	if err != nil {
+		cancel()
+		live.Unsubscribe()
+		return nil, err
+	}
+
+	out := make(chan types.Log, cap(live.ch))
+	sub := &FilterSubscription{
+		ctx:    ctx,
+		err:    make(chan error, 1),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	send := func(item types.Log) bool {
+		select {
+		case out <- item:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		defer func() {
+			cancel()
+			live.Unsubscribe()
+			close(out)
+			close(sub.err)
+			close(sub.done)
+		}()
+
+		// 补齐期间实时日志积压在 live 的缓冲区中. 只有补齐末尾 defaultMaxReorgDepth 个区块可能在补齐和实时日志之间重组,
+		// emitted 只记录这些区块已经输出的日志, 实时日志超过 backfillTo 后不再需要去重, 置为 nil
+		var backfillTo, reorgFrom uint64
+		var emitted map[logKey]struct{}
+		if query.FromBlock > 0 && uint64(query.FromBlock) <= head {
+			backfillTo = head
+			if head >= defaultMaxReorgDepth {
+				reorgFrom = head - defaultMaxReorgDepth + 1
+			}
+			emitted = make(map[logKey]struct{})
+			it := e.GetLogsRange(ctx, query, uint64(query.FromBlock), head)
+			for it.Next() {
+				item := it.Log()
+				if item.BlockNumber >= reorgFrom {
+					emitted[logKey{blockHash: item.BlockHash, txIndex: item.TxIndex, logIndex: item.Index}] = struct{}{}
+				}
+				if !send(item) {
+					it.Close()
+					return
+				}
+			}
+			it.Close()
+			if err := it.Err(); err != nil {
+				if ctx.Err() == nil {
+					sub.err <- err
+				}
+				return
+			}
+		}
+
+		for item := range live.Chan() {
+			if int64(item.BlockNumber) < int64(query.FromBlock) {
+				continue
+			}
+			if emitted != nil && item.BlockNumber > backfillTo && !item.Removed {
+				emitted = nil
+			}
+			if emitted != nil && item.BlockNumber <= backfillTo {
+				// 更早的区块已经由补齐输出, 不会重组
+				if item.BlockNumber < reorgFrom {
+					continue
+				}
+				// 已经输出的日志不重复输出, 没有输出过的日志不转发 Removed
+				key := logKey{blockHash: item.BlockHash, txIndex: item.TxIndex, logIndex: item.Index}
+				if _, ok := emitted[key]; ok != item.Removed {
+					continue
+				}
+				if item.Removed {
+					delete(emitted, key)
+				} else {
+					emitted[key] = struct{}{}
+				}
+			}
+			if !send(item) {
+				return
+			}
+		}
+		if err := <-live.Err(); err != nil {
+			sub.err <- err
+		}
+	}()
+	return &LogSubscription{FilterSubscription: sub, ch: out}, nil
+}
+
+// subscribeLiveLogs 订阅新区块中的日志, 节点不支持 eth_subscribe 时退回到轮询 log filter
+func (e *Web3Client) subscribeLiveLogs(ctx context.Context, query FilterQuery, pullInterval int64) (*LogSubscription, error) {
+	ep, err := e.bestEndpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan types.Log, 5000)
+	wsSub, err := ep.ethClient.SubscribeFilterLogs(ctx, ethereum.FilterQuery{Addresses: query.Addresses, Topics: query.Topics}, ch)
+	if err != nil {
+		var rpcErr rpc.Error
+		if !errors.Is(err, rpc.ErrNotificationsUnsupported) && !(errors.As(err, &rpcErr) && rpcErr.ErrorCode() == methodNotFoundErrorCode) {
+			return nil, err
+		}
+		pollQuery := FilterQuery{
+			FromBlock: rpc.LatestBlockNumber,
+			ToBlock:   rpc.LatestBlockNumber,
+			Addresses: query.Addresses,
+			Topics:    query.Topics,
+		}
+		return e.EthLogFlowable(ctx, pollQuery, pullInterval)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	out := make(chan types.Log, cap(ch))
+	sub := &FilterSubscription{
+		ctx:    ctx,
+		err:    make(chan error, 1),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer func() {
+			wsSub.Unsubscribe()
+			close(out)
+			close(sub.err)
+			close(sub.done)
+		}()
+		for {
+			select {
+			case item := <-ch:
+				select {
+				case out <- item:
+				case <-ctx.Done():
+					return
+				}
+			case err := <-wsSub.Err():
+				// 连接断开, 不自动重新订阅以免遗漏断开期间的日志
+				if err != nil {
+					sub.err <- err
+				}
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return &LogSubscription{FilterSubscription: sub, ch: out}, nil
+}
@@ -0,0 +1,190 @@
+package tx
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/snail-plus/eth-pkg/tx/txtest"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestEthLogFollow(t *testing.T) {
+	for _, ws := range []bool{true, false} {
+		node := txtest.NewMockNode(t)
+		url := node.URL
+		if ws {
+			url = node.WSURL
+		}
+		client, err := NewWeb3ClientWithOptions(context.Background(), url, WithLogRangeChunkSize(3))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+		newLog := func(number uint64) types.Log {
+			return types.Log{Address: token, BlockNumber: number, BlockHash: common.BigToHash(new(big.Int).SetUint64(number))}
+		}
+		for number := uint64(1); number <= 10; number++ {
+			node.EmitLogs(newLog(number))
+		}
+		sub, err := client.EthLogFollow(context.Background(), FilterQuery{FromBlock: 3, Addresses: []common.Address{token}}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Unsubscribe()
+		node.EmitLogs(newLog(11), newLog(12))
+
+		// 历史日志和实时日志连续输出, 没有遗漏和重复
+		for number := uint64(3); number <= 12; number++ {
+			select {
+			case ethLog := <-sub.Chan():
+				if ethLog.BlockNumber != number {
+					t.Fatalf("ws %v: expected block %d, got %+v", ws, number, ethLog)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("ws %v: timeout waiting for block %d", ws, number)
+			}
+		}
+		select {
+		case ethLog := <-sub.Chan():
+			t.Fatalf("ws %v: unexpected log %+v", ws, ethLog)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		// 只有不支持订阅时才安装 filter
+		if installed := node.CallCount("eth_newFilter") > 0; installed == ws {
+			t.Fatalf("ws %v: eth_newFilter called %v", ws, installed)
+		}
+		sub.Unsubscribe()
+		if err := <-sub.Err(); err != nil {
+			t.Fatal(err)
+		}
+		client.Close()
+	}
+}
+
+func TestEthLogFollowReorg(t *testing.T) {
+	for _, ws := range []bool{true, false} {
+		node := txtest.NewMockNode(t)
+		url := node.URL
+		if ws {
+			url = node.WSURL
+		}
+		client, err := NewWeb3ClientWithOptions(context.Background(), url, WithLogRangeChunkSize(3))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+		newLog := func(number uint64, hash string) types.Log {
+			return types.Log{Address: token, BlockNumber: number, BlockHash: common.HexToHash(hash)}
+		}
+		for number := uint64(1); number <= 10; number++ {
+			node.EmitLogs(newLog(number, fmt.Sprintf("0x%x", number)))
+		}
+		sub, err := client.EthLogFollow(context.Background(), FilterQuery{FromBlock: 3, Addresses: []common.Address{token}}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sub.Unsubscribe()
+
+		next := func() types.Log {
+			select {
+			case ethLog := <-sub.Chan():
+				return ethLog
+			case <-time.After(5 * time.Second):
+				t.Fatalf("ws %v: timeout waiting for log", ws)
+				return types.Log{}
+			}
+		}
+		for number := uint64(3); number <= 10; number++ {
+			if ethLog := next(); ethLog.BlockNumber != number {
+				t.Fatalf("ws %v: expected block %d, got %+v", ws, number, ethLog)
+			}
+		}
+
+		// 补齐范围内的区块 8 重组: 撤销已经输出的日志, 输出新的日志.
+		// 没有输出过的日志的 Removed 和已经输出过的日志不再转发
+		removed := newLog(8, "0x8")
+		removed.Removed = true
+		unknown := newLog(9, "0x99")
+		unknown.Removed = true
+		node.EmitLogs(removed, newLog(8, "0x88"), unknown, newLog(10, "0xa"), newLog(11, "0xb"))
+
+		expected := []types.Log{removed, newLog(8, "0x88"), newLog(11, "0xb")}
+		for _, want := range expected {
+			ethLog := next()
+			if ethLog.BlockNumber != want.BlockNumber || ethLog.BlockHash != want.BlockHash || ethLog.Removed != want.Removed {
+				t.Fatalf("ws %v: expected %+v, got %+v", ws, want, ethLog)
+			}
+		}
+		select {
+		case ethLog := <-sub.Chan():
+			t.Fatalf("ws %v: unexpected log %+v", ws, ethLog)
+		case <-time.After(100 * time.Millisecond):
+		}
+		sub.Unsubscribe()
+		client.Close()
+	}
+}
+
+func TestEthLogFollowReorgWindow(t *testing.T) {
+	node := txtest.NewMockNode(t)
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.WSURL, WithLogRangeChunkSize(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	token := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	newLog := func(number uint64, hash string) types.Log {
+		return types.Log{Address: token, BlockNumber: number, BlockHash: common.HexToHash(hash)}
+	}
+	for number := uint64(1); number <= 100; number++ {
+		node.EmitLogs(newLog(number, fmt.Sprintf("0x%x", number)))
+	}
+	sub, err := client.EthLogFollow(context.Background(), FilterQuery{FromBlock: 1, Addresses: []common.Address{token}}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	next := func() types.Log {
+		select {
+		case ethLog := <-sub.Chan():
+			return ethLog
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for log")
+			return types.Log{}
+		}
+	}
+	for number := uint64(1); number <= 100; number++ {
+		next()
+	}
+
+	// 只在补齐末尾 defaultMaxReorgDepth 个区块内去重, 更早区块的实时日志直接丢弃.
+	// 实时日志超过补齐区块后不再去重, 之后的 Removed 直接转发
+	old := newLog(10, "0xa")
+	old.Removed = true
+	removed := newLog(90, "0x5a")
+	removed.Removed = true
+	replaced := newLog(101, "0x65")
+	replaced.Removed = true
+	node.EmitLogs(old, newLog(20, "0x14"), removed, newLog(90, "0x5a5a"), newLog(101, "0x65"), replaced)
+
+	expected := []types.Log{removed, newLog(90, "0x5a5a"), newLog(101, "0x65"), replaced}
+	for _, want := range expected {
+		ethLog := next()
+		if ethLog.BlockNumber != want.BlockNumber || ethLog.BlockHash != want.BlockHash || ethLog.Removed != want.Removed {
+			t.Fatalf("expected %+v, got %+v", want, ethLog)
+		}
+	}
+	select {
+	case ethLog := <-sub.Chan():
+		t.Fatalf("unexpected log %+v", ethLog)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,193 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/snail-plus/eth-pkg/common/gopool"
+	"math/big"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	defaultLogRangeChunkSize   = 2000
+	defaultLogRangeConcurrency = 4
+	// Infura 等节点超出限制时返回的错误码, 范围过大和限流都使用这个错误码
+	limitExceededErrorCode = -32005
+)
+
+// rangeErrorMessages 节点因结果过多或区块范围过大拒绝 eth_getLogs 时的错误信息
+var rangeErrorMessages = []string{
+	"too many results",
+	"query returned more than",
+	"range too large",
+	"range is too large",
+	"block range is too wide",
+	"exceed maximum block range",
+	"response size exceeded",
+}
+
+// isRangeError eth_getLogs 的区块范围需要缩小. 只看错误码无法区分限流, 限流错误交给重试策略
+func isRangeError(err error) bool {
+	var dataErr interface {
+		ErrorCode() int
+		ErrorData() interface{}
+	}
+	if errors.As(err, &dataErr) && dataErr.ErrorCode() == limitExceededErrorCode {
+		// Infura 在 data 中返回建议的区块范围 {"from": ..., "to": ..., "limit": ...}
+		if data, ok := dataErr.ErrorData().(map[string]interface{}); ok && data["from"] != nil && data["to"] != nil {
+			return true
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range rangeErrorMessages {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// logChunk 一个分段的查询结果
+type logChunk struct {
+	logs []types.Log
+	err  error
+}
+
+// LogIterator 按区块顺序遍历 GetLogsRange 的结果
+//
+//	it := client.GetLogsRange(ctx, query, from, to)
+//	defer it.Close()
+//	for it.Next() {
+//		handle(it.Log())
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type LogIterator struct {
+	chunks <-chan chan logChunk
+	cancel context.CancelFunc
+	logs   []types.Log
+	index  int
+	err    error
+}
+
+// Next 移动到下一条日志, 遍历结束或出错时返回 false
+func (it *LogIterator) Next() bool {
+	for it.index >= len(it.logs) {
+		if it.err != nil {
+			return false
+		}
+		result, ok := <-it.chunks
+		if !ok {
+			return false
+		}
+		chunk := <-result
+		if chunk.err != nil {
+			it.err = chunk.err
+			it.cancel()
+			return false
+		}
+		it.logs, it.index = chunk.logs, 0
+	}
+	it.index++
+	return true
+}
+
+// Log 当前日志
+func (it *LogIterator) Log() types.Log {
+	return it.logs[it.index-1]
+}
+
+func (it *LogIterator) Err() error {
+	return it.err
+}
+
+// Close 停止尚未完成的查询, 提前结束遍历时需要调用
+func (it *LogIterator) Close() {
+	it.cancel()
+}
+
+// GetLogsRange 查询 [from, to] 区间内匹配 query 地址和 topic 的日志. 区间按 WithLogRangeChunkSize 分段,
+// 通过 gopool 并发查询, 结果按区块顺序返回. 节点返回结果过多或范围过大时把分段减半后重试, 后续分段也使用减半后的大小
+func (e *Web3Client) GetLogsRange(ctx context.Context, query FilterQuery, from uint64, to uint64) *LogIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	concurrency := e.options.logRangeConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	// 队列长度限制了同时进行的查询数和未消费的结果数
+	chunks := make(chan chan logChunk, concurrency)
+	it := &LogIterator{chunks: chunks, cancel: cancel}
+
+	chunkSize := e.options.logRangeChunkSize
+	if chunkSize == 0 {
+		chunkSize = defaultLogRangeChunkSize
+	}
+	go func() {
+		defer close(chunks)
+		for start := from; start <= to; {
+			end := to
+			if size := atomic.LoadUint64(&chunkSize); end-start >= size {
+				end = start + size - 1
+			}
+
+			result := make(chan logChunk, 1)
+			select {
+			case chunks <- result:
+			case <-ctx.Done():
+				return
+			}
+			chunkStart, chunkEnd := start, end
+			task := func() {
+				logs, err := e.getLogsSplit(ctx, query, chunkStart, chunkEnd, &chunkSize)
+				result <- logChunk{logs: logs, err: err}
+			}
+			if err := gopool.Submit(task); err != nil {
+				go task()
+			}
+
+			if end == to {
+				return
+			}
+			start = end + 1
+		}
+	}()
+	return it
+}
+
+// getLogsSplit 查询 [from, to], 范围过大时减半并按顺序查询两段
+func (e *Web3Client) getLogsSplit(ctx context.Context, query FilterQuery, from uint64, to uint64, chunkSize *uint64) ([]types.Log, error) {
+	logs, err := e.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: query.Addresses,
+		Topics:    query.Topics,
+	})
+	if err == nil || !isRangeError(err) {
+		return logs, err
+	}
+	if from == to {
+		return nil, fmt.Errorf("eth_getLogs block %d: %w", from, err)
+	}
+
+	size := (to - from + 1) / 2
+	for {
+		current := atomic.LoadUint64(chunkSize)
+		if current <= size || atomic.CompareAndSwapUint64(chunkSize, current, size) {
+			break
+		}
+	}
+	mid := from + size - 1
+	left, err := e.getLogsSplit(ctx, query, from, mid, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.getLogsSplit(ctx, query, mid+1, to, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
@@ -0,0 +1,143 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/filters"
+	"github.com/snail-plus/eth-pkg/tx/txtest"
+	"testing"
+	"time"
+)
+
+// limitedGetLogs 模拟限制区块范围的节点, 每个区块返回一条日志, 范围超过 limit 或包含 failBlock 时返回 -32005
+func limitedGetLogs(limit uint64, failBlock uint64) txtest.MockHandler {
+	return func(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+		var criteria filters.FilterCriteria
+		if err := json.Unmarshal(params[0], &criteria); err != nil {
+			return nil, err
+		}
+		from, to := criteria.FromBlock.Uint64(), criteria.ToBlock.Uint64()
+		if to-from+1 > limit || (failBlock > 0 && from <= failBlock && failBlock <= to) {
+			return nil, &txtest.MockError{Code: limitExceededErrorCode, Message: "query returned more than 10000 results"}
+		}
+		logs := []types.Log{}
+		for number := from; number <= to; number++ {
+			logs = append(logs, types.Log{Address: criteria.Addresses[0], Topics: []common.Hash{}, Data: []byte{}, BlockNumber: number})
+		}
+		return logs, nil
+	}
+}
+
+func TestGetLogsRange(t *testing.T) {
+	node := txtest.NewMockNode(t)
+	node.Handle("eth_getLogs", limitedGetLogs(10, 0))
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL, WithLogRangeChunkSize(32), WithLogRangeConcurrency(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	token := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	it := client.GetLogsRange(context.Background(), FilterQuery{Addresses: []common.Address{token}}, 5, 104)
+	defer it.Close()
+
+	next := uint64(5)
+	for it.Next() {
+		if ethLog := it.Log(); ethLog.BlockNumber != next || ethLog.Address != token {
+			t.Fatalf("unexpected log %+v, expected block %d", ethLog, next)
+		}
+		next++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if next != 105 {
+		t.Fatalf("expected logs up to block 104, got %d", next-1)
+	}
+	// 分段减半后后续分段直接使用更小的范围, 请求数远少于每段都从 32 开始拆分
+	if count := node.CallCount("eth_getLogs"); count > 30 {
+		t.Fatalf("too many eth_getLogs calls %d", count)
+	}
+}
+
+func TestGetLogsRangeError(t *testing.T) {
+	node := txtest.NewMockNode(t)
+	node.Handle("eth_getLogs", limitedGetLogs(100, 42))
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL, WithLogRangeChunkSize(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	token := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	it := client.GetLogsRange(context.Background(), FilterQuery{Addresses: []common.Address{token}}, 0, 99)
+	defer it.Close()
+
+	// 出错分段 [32, 47] 之前的日志正常返回
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if count != 32 {
+		t.Fatalf("expected 32 logs before failing chunk, got %d", count)
+	}
+	if err := it.Err(); err == nil || !isRangeError(err) {
+		t.Fatalf("expected range error, got %v", err)
+	}
+}
+
+func TestGetLogsRangeLimitError(t *testing.T) {
+	token := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	ranged := limitedGetLogs(10, 0)
+
+	// 限流同样返回 -32005, 应该重试而不是拆分
+	node := txtest.NewMockNode(t)
+	limited := true
+	node.Handle("eth_getLogs", func(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+		if limited {
+			limited = false
+			return nil, &txtest.MockError{Code: limitExceededErrorCode, Message: "project ID request rate exceeded"}
+		}
+		return ranged(ctx, params)
+	})
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL, WithRetryPolicy(policy), WithLogRangeChunkSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	logs, err := client.getLogsSplit(context.Background(), FilterQuery{Addresses: []common.Address{token}}, 0, 9, new(uint64))
+	if err != nil || len(logs) != 10 {
+		t.Fatalf("unexpected result %d %v", len(logs), err)
+	}
+	if count := node.CallCount("eth_getLogs"); count != 2 {
+		t.Fatalf("rate limit error should be retried without splitting, got %d calls", count)
+	}
+
+	// data 中带有建议区块范围的 -32005 需要拆分
+	node = txtest.NewMockNode(t)
+	node.Handle("eth_getLogs", func(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+		var criteria filters.FilterCriteria
+		if err := json.Unmarshal(params[0], &criteria); err != nil {
+			return nil, err
+		}
+		if criteria.ToBlock.Uint64()-criteria.FromBlock.Uint64() >= 5 {
+			data := map[string]interface{}{"from": "0x0", "to": "0x4", "limit": 10000}
+			return nil, &txtest.MockError{Code: limitExceededErrorCode, Message: "query exceeds limit", Data: data}
+		}
+		return ranged(ctx, params)
+	})
+	client, err = NewWeb3ClientWithOptions(context.Background(), node.URL, WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	logs, err = client.getLogsSplit(context.Background(), FilterQuery{Addresses: []common.Address{token}}, 0, 9, new(uint64))
+	if err != nil || len(logs) != 10 {
+		t.Fatalf("unexpected result %d %v", len(logs), err)
+	}
+}
@@ -0,0 +1,230 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"log"
+	"math/big"
+	"time"
+)
+
+const (
+	defaultLogStreamPollInterval = time.Second
+	defaultMaxReorgDepth         = 64
+	defaultLogStreamBufferSize   = 5000
+)
+
+// ErrReorgTooDeep 重组深度超过 MaxReorgDepth, 无法确定需要撤销的日志
+var ErrReorgTooDeep = errors.New("reorg deeper than max reorg depth")
+
+// LogStreamConfig 日志流配置
+type LogStreamConfig struct {
+	// 日志所在区块达到该确认数 (包含所在区块) 后才输出, 小于等于 1 表示打包即输出
+	Confirmations uint64
+	PollInterval  time.Duration
+	// 保留的区块数, 超过该深度的重组以 ErrReorgTooDeep 终止
+	MaxReorgDepth uint64
+	BufferSize    int
+}
+
+// streamBlock 日志流已处理的主链区块
+type streamBlock struct {
+	number    uint64
+	hash      common.Hash
+	logs      []types.Log
+	delivered bool
+}
+
+type logStream struct {
+	client *Web3Client
+	query  FilterQuery
+	config LogStreamConfig
+	out    chan types.Log
+
+	// 已处理的主链区块, 高度递增且相邻区块通过 parentHash 相连
+	blocks []*streamBlock
+	next   uint64
+	// 是否丢弃过超过 MaxReorgDepth 的区块
+	pruned bool
+}
+
+// EthLogStream 按区块哈希跟踪主链的日志流. 区块被重组时对已输出的日志按相反顺序输出 Removed 为 true 的副本,
+// 再输出新主链上的日志. query 只使用 Addresses Topics 和 FromBlock ToBlock, FromBlock 为 0 时从下一个区块开始,
+// ToBlock 大于 0 时输出到该区块后正常结束
+func (e *Web3Client) EthLogStream(ctx context.Context, query FilterQuery, config LogStreamConfig) (*LogSubscription, error) {
+	if query.BlockHash != nil {
+		return nil, errors.New("log stream does not support BlockHash")
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultLogStreamPollInterval
+	}
+	if config.MaxReorgDepth == 0 {
+		config.MaxReorgDepth = defaultMaxReorgDepth
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultLogStreamBufferSize
+	}
+
+	s := &logStream{
+		client: e,
+		query:  query,
+		config: config,
+		out:    make(chan types.Log, config.BufferSize),
+	}
+	if query.FromBlock > 0 {
+		s.next = uint64(query.FromBlock)
+	} else {
+		head, err := e.BlockNumber(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.next = head + 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &FilterSubscription{
+		ctx:    ctx,
+		err:    make(chan error, 1),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go s.run(ctx, sub)
+	return &LogSubscription{FilterSubscription: sub, ch: s.out}, nil
+}
+
+func (s *logStream) run(ctx context.Context, sub *FilterSubscription) {
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer func() {
+		ticker.Stop()
+		close(s.out)
+		close(sub.err)
+		close(sub.done)
+	}()
+
+	for {
+		finished, err := s.poll(ctx)
+		if finished || ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if errors.Is(err, ErrReorgTooDeep) {
+				sub.err <- err
+				return
+			}
+			// 节点暂时不可用或区块尚未同步完成, 下次轮询时重试
+			log.Printf("log stream error: %s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll 处理到最新区块, 输出已达到确认数的日志. 到达 ToBlock 后返回 true
+func (s *logStream) poll(ctx context.Context) (bool, error) {
+	head, err := s.client.BlockNumber(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for s.next <= head {
+		header, hash, err := s.client.headerByNumber(ctx, new(big.Int).SetUint64(s.next))
+		if err != nil {
+			return false, err
+		}
+
+		if len(s.blocks) > 0 {
+			last := s.blocks[len(s.blocks)-1]
+			if header.ParentHash != last.hash {
+				// last 已不在主链上, 撤销后重新获取该高度的区块
+				if err := s.revert(ctx, last); err != nil {
+					return false, err
+				}
+				continue
+			}
+		}
+
+		logs, err := s.client.FilterLogs(ctx, ethereum.FilterQuery{
+			BlockHash: &hash,
+			Addresses: s.query.Addresses,
+			Topics:    s.query.Topics,
+		})
+		if err != nil {
+			// 区块可能刚被重组, 下次轮询重新获取
+			return false, err
+		}
+		s.blocks = append(s.blocks, &streamBlock{number: s.next, hash: hash, logs: logs})
+		s.next++
+
+		// 追赶历史区块时逐个输出, 避免在内存中积压
+		if finished, err := s.deliver(ctx, head); finished || err != nil {
+			return finished, err
+		}
+	}
+	return s.deliver(ctx, head)
+}
+
+// deliver 输出已达到确认数的区块中的日志, 到达 ToBlock 后返回 true
+func (s *logStream) deliver(ctx context.Context, head uint64) (bool, error) {
+	for _, block := range s.blocks {
+		if block.delivered || block.number+s.config.Confirmations > head+1 {
+			continue
+		}
+		if s.query.ToBlock > 0 && block.number > uint64(s.query.ToBlock) {
+			return true, nil
+		}
+		for _, item := range block.logs {
+			if err := s.send(ctx, item); err != nil {
+				return false, err
+			}
+		}
+		block.delivered = true
+		if s.query.ToBlock > 0 && block.number == uint64(s.query.ToBlock) {
+			return true, nil
+		}
+	}
+
+	// 只保留 MaxReorgDepth 个区块, 更早的区块视为不可逆
+	if overflow := len(s.blocks) - int(s.config.MaxReorgDepth); overflow > 0 && s.blocks[overflow-1].delivered {
+		s.blocks = append(s.blocks[:0], s.blocks[overflow:]...)
+		s.pruned = true
+	}
+	return false, nil
+}
+
+// revert 从已处理的区块中移除 block, 已输出的日志以 Removed 为 true 按相反顺序再次输出
+func (s *logStream) revert(ctx context.Context, block *streamBlock) error {
+	if len(s.blocks) == 1 && s.pruned {
+		return fmt.Errorf("%w: block %d", ErrReorgTooDeep, block.number)
+	}
+	s.blocks = s.blocks[:len(s.blocks)-1]
+	s.next = block.number
+
+	if !block.delivered {
+		return nil
+	}
+	for i := len(block.logs) - 1; i >= 0; i-- {
+		removed := block.logs[i]
+		removed.Removed = true
+		if err := s.send(ctx, removed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *logStream) send(ctx context.Context, item types.Log) error {
+	select {
+	case s.out <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,135 @@
+package tx
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/snail-plus/eth-pkg/tx/txtest"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// sendTransfer 签名并发送 token 转账, 不等待回执, 分叉上的交易在重组前查不到回执
+func sendTransfer(t *testing.T, sim *txtest.SimChain, token common.Address, to common.Address, amount int64) *types.Transaction {
+	t.Helper()
+	data := append(common.Hex2Bytes("a9059cbb"), common.LeftPadBytes(to.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(big.NewInt(amount).Bytes(), 32)...)
+	tx, err := sim.SignTx(sim.Accounts[0], &token, data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.SendTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func nextStreamLog(t *testing.T, sub *LogSubscription) types.Log {
+	t.Helper()
+	select {
+	case ethLog, ok := <-sub.Chan():
+		if !ok {
+			t.Fatal("log stream closed")
+		}
+		return ethLog
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for log")
+	}
+	return types.Log{}
+}
+
+func expectNoStreamLog(t *testing.T, sub *LogSubscription) {
+	t.Helper()
+	select {
+	case ethLog := <-sub.Chan():
+		t.Fatalf("unexpected log %+v", ethLog)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEthLogStreamReorg(t *testing.T) {
+	sim := txtest.NewSimChain(t)
+	owner, receiver := sim.Accounts[0], sim.Accounts[1]
+	token := sim.DeployErc20(owner, "Test Token", "TT", 18, big.NewInt(1000000))
+	client, err := NewWeb3ClientWithOptions(context.Background(), sim.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	sub, err := client.EthLogStream(context.Background(), FilterQuery{Addresses: []common.Address{token}}, LogStreamConfig{PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	parent := sim.Head()
+	orphaned := sendTransfer(t, sim, token, receiver.Address, 1)
+	if ethLog := nextStreamLog(t, sub); ethLog.TxHash != orphaned.Hash() || ethLog.Removed {
+		t.Fatalf("unexpected log %+v", ethLog)
+	}
+
+	// 从 parent 分叉出更长的链, 原区块中的日志被撤销, 新主链上的日志随后输出
+	if err := sim.Fork(parent.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	canonical := sendTransfer(t, sim, token, receiver.Address, 2)
+	sim.Mine()
+	if head := sim.Head(); head.NumberU64() != parent.NumberU64()+2 {
+		t.Fatalf("reorg did not happen, head %d", head.NumberU64())
+	}
+
+	if ethLog := nextStreamLog(t, sub); ethLog.TxHash != orphaned.Hash() || !ethLog.Removed {
+		t.Fatalf("expected removed log, got %+v", ethLog)
+	}
+	if ethLog := nextStreamLog(t, sub); ethLog.TxHash != canonical.Hash() || ethLog.Removed {
+		t.Fatalf("expected canonical log, got %+v", ethLog)
+	}
+	expectNoStreamLog(t, sub)
+}
+
+func TestEthLogStreamConfirmations(t *testing.T) {
+	sim := txtest.NewSimChain(t)
+	owner, receiver := sim.Accounts[0], sim.Accounts[1]
+	token := sim.DeployErc20(owner, "Test Token", "TT", 18, big.NewInt(1000000))
+	client, err := NewWeb3ClientWithOptions(context.Background(), sim.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	start := sim.Head().NumberU64()
+	query := FilterQuery{Addresses: []common.Address{token}, ToBlock: rpc.BlockNumber(start + 4)}
+	sub, err := client.EthLogStream(context.Background(), query, LogStreamConfig{Confirmations: 3, PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	// 确认前发生的重组不会产生 Removed 日志
+	parent := sim.Head()
+	sendTransfer(t, sim, token, receiver.Address, 1)
+	expectNoStreamLog(t, sub)
+	if err := sim.Fork(parent.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	canonical := sendTransfer(t, sim, token, receiver.Address, 2)
+	sim.Mine()
+	expectNoStreamLog(t, sub)
+
+	sim.Mine()
+	if ethLog := nextStreamLog(t, sub); ethLog.TxHash != canonical.Hash() || ethLog.Removed {
+		t.Fatalf("unexpected log %+v", ethLog)
+	}
+
+	// 到达 ToBlock 后正常结束
+	sim.MineBlocks(4)
+	if _, ok := <-sub.Chan(); ok {
+		t.Fatal("expected closed stream")
+	}
+	if err := <-sub.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -16,6 +16,17 @@ type TransactionManager interface {
 	GetPrivateKey() string
 }
 
+// TypedTransactionManager 可以指定交易类型的 TransactionManager, NewDefaultTransactionManager 返回的实现支持
+//
+//	if typed, ok := manager.(TypedTransactionManager); ok {
+//		typed.ExecuteTransactionInfo(TransactionInfo{To: to, Type: TxTypeDynamicFee, AccessList: accessList}, nil, 0)
+//	}
+type TypedTransactionManager interface {
+	TransactionManager
+	// 交易类型及 EIP-1559 手续费由 txInfo 指定, txInfo.PrivateKeyStr 会被忽略
+	ExecuteTransactionInfo(txInfo TransactionInfo, gasPrice *big.Int, gasLimit uint64) (string, error)
+}
+
 type FastRawTransactionManager struct {
 	nonce               uint64
 	refreshNonceTime    int64
@@ -52,7 +63,19 @@ func NewDefaultTransactionManager(web3Client *Web3Client,
 	return txManager
 }
 
+// ExecuteTransaction 链支持 EIP-1559 时发送 DynamicFeeTx, gasPrice 作为 GasFeeCap, 否则发送 LegacyTx
 func (f *FastRawTransactionManager) ExecuteTransaction(to string, data []byte, value *big.Int,
+	gasPrice *big.Int, gasLimit uint64) (string, error) {
+	txInfo := TransactionInfo{
+		To:    to,
+		Data:  data,
+		Value: value,
+		Type:  TxTypeAuto,
+	}
+	return f.ExecuteTransactionInfo(txInfo, gasPrice, gasLimit)
+}
+
+func (f *FastRawTransactionManager) ExecuteTransactionInfo(txInfo TransactionInfo,
 	gasPrice *big.Int, gasLimit uint64) (string, error) {
 	ctx := context.Background()
 	addressStr, err := secure.PrivateKeyToAddressStr(f.privateKeyStr)
@@ -65,13 +88,7 @@ func (f *FastRawTransactionManager) ExecuteTransaction(to string, data []byte, v
 		return "", err
 	}
 
-	txInfo := TransactionInfo{
-		To:            to,
-		Data:          data,
-		PrivateKeyStr: f.privateKeyStr,
-		Value:         value,
-	}
-
+	txInfo.PrivateKeyStr = f.privateKeyStr
 	signTx, err := f.web3Client.SignNewTxInfo(txInfo, nonce, gasPrice, gasLimit)
 	if err != nil {
 		return "", err
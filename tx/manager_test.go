@@ -0,0 +1,71 @@
+package tx
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/snail-plus/eth-pkg/tx/txtest"
+	"math/big"
+	"testing"
+)
+
+var _ TypedTransactionManager = (*FastRawTransactionManager)(nil)
+
+func TestFastRawTransactionManager(t *testing.T) {
+	ctx := context.Background()
+	sim := txtest.NewSimChain(t)
+	client, err := NewWeb3ClientWithOptions(ctx, sim.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	sender := sim.Accounts[0]
+	manager := NewDefaultTransactionManager(client, sender.PrivateKey)
+	if manager.GetPrivateKey() != sender.PrivateKey {
+		t.Fatal("unexpected private key")
+	}
+
+	gasPrice, err := client.GetGasPrice(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	for i := 0; i < 3; i++ {
+		hash, err := manager.ExecuteTransaction(to.Hex(), nil, big.NewInt(int64(i+1)), gasPrice, 21000)
+		if err != nil {
+			t.Fatalf("transaction %d: %v", i, err)
+		}
+
+		receipt, err := client.TransactionReceipt(ctx, hash)
+		if err != nil || receipt.Status != types.ReceiptStatusSuccessful {
+			t.Fatalf("unexpected receipt %+v %v", receipt, err)
+		}
+		tx, _, err := client.TransactionByHash(ctx, hash)
+		if err != nil || tx.Nonce() != uint64(i) {
+			t.Fatalf("unexpected nonce %v %v", tx, err)
+		}
+		// 模拟链支持 EIP-1559, gasPrice 作为 feeCap
+		if tx.Type() != types.DynamicFeeTxType || tx.GasFeeCap().Cmp(gasPrice) != 0 {
+			t.Fatalf("expected dynamic fee tx with feeCap %s, got type %d feeCap %s", gasPrice, tx.Type(), tx.GasFeeCap())
+		}
+	}
+
+	// 通过 TypedTransactionManager 指定交易类型
+	typed, ok := manager.(TypedTransactionManager)
+	if !ok {
+		t.Fatal("default manager should support typed transactions")
+	}
+	hash, err := typed.ExecuteTransactionInfo(TransactionInfo{To: to.Hex(), Value: big.NewInt(4)}, gasPrice, 21000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx, _, err := client.TransactionByHash(ctx, hash); err != nil || tx.Type() != types.LegacyTxType {
+		t.Fatalf("expected legacy tx, got %v %v", tx, err)
+	}
+
+	balance, err := client.BalanceAt(ctx, to, nil)
+	if err != nil || balance.Int64() != 10 {
+		t.Fatalf("unexpected balance %v %v", balance, err)
+	}
+}
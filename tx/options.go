@@ -0,0 +1,318 @@
+package tx
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	defaultDialTimeout = 10 * time.Second
+)
+
+// ErrWsHeaderUnsupported websocket 连接无法携带自定义 header, 只支持 basic auth
+var ErrWsHeaderUnsupported = errors.New("custom headers are not supported for websocket endpoints")
+
+// ErrHTTPOptionUnsupported 自定义 header 和 http.Client 只能用于 http(s) 节点
+var ErrHTTPOptionUnsupported = errors.New("http options are not supported for this endpoint")
+
+type clientOptions struct {
+	dialTimeout time.Duration
+	headers     http.Header
+	chainId     *big.Int
+	// 签名前校验节点 chainId
+	expectedChainId *big.Int
+	httpClient      *http.Client
+	lazy            bool
+	// 多节点时的健康检查间隔, 0 表示不检查
+	healthCheckInterval time.Duration
+	retryPolicy         RetryPolicy
+	// 限流配置, nil 表示不限流
+	rateLimit          *RateLimit
+	endpointRateLimits map[string]RateLimit
+	methodRateLimits   map[string]RateLimit
+	methodPriorities   map[string]Priority
+	maxBatchSize       int
+	// 请求合并窗口, 0 表示不合并
+	coalesceWindow time.Duration
+	// 响应缓存容量, 0 表示不缓存
+	cacheSize          int
+	cacheFinalityDepth uint64
+	headPollInterval   time.Duration
+	// gas 预估的安全系数和上限, 上限为 0 表示不限制
+	gasEstimateMultiplier float64
+	gasLimitCap           uint64
+	// WaitMined 等轮询回执的间隔
+	receiptPollInterval time.Duration
+	// filter 轮询失败和重新安装的退避策略
+	filterRetryPolicy RetryPolicy
+	// GetLogsRange 的初始分段大小和并发数
+	logRangeChunkSize   uint64
+	logRangeConcurrency int
+	// 不为 nil 时通过进程内连接访问该服务, 不再按 url 拨号
+	inProcServer *rpc.Server
+}
+
+// Option 配置 Web3Client
+type Option func(*clientOptions)
+
+func defaultClientOptions() *clientOptions {
+	return &clientOptions{
+		dialTimeout: defaultDialTimeout,
+		headers:     make(http.Header),
+		// 单节点时不会启动健康检查
+		healthCheckInterval: defaultHealthCheckInterval,
+		retryPolicy:         DefaultRetryPolicy,
+		endpointRateLimits:  make(map[string]RateLimit),
+		methodRateLimits:    make(map[string]RateLimit),
+		methodPriorities:    make(map[string]Priority),
+		maxBatchSize:        defaultMaxBatchSize,
+		cacheFinalityDepth:  defaultCacheFinalityDepth,
+		headPollInterval:    defaultHeadPollInterval,
+
+		gasEstimateMultiplier: defaultGasEstimateMultiplier,
+		receiptPollInterval:   defaultReceiptPollInterval,
+		filterRetryPolicy:     DefaultFilterRetryPolicy,
+		logRangeChunkSize:     defaultLogRangeChunkSize,
+		logRangeConcurrency:   defaultLogRangeConcurrency,
+	}
+}
+
+// WithDialTimeout 建立连接以及连接时查询 chainId 的超时时间
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithHeader 每个 HTTP 请求都携带的自定义 header. websocket 节点无法携带自定义 header, 连接时返回 ErrWsHeaderUnsupported,
+// ipc 等其他协议返回 ErrHTTPOptionUnsupported
+func WithHeader(key, value string) Option {
+	return func(o *clientOptions) {
+		o.headers.Set(key, value)
+	}
+}
+
+// WithBasicAuth 设置 HTTP basic auth, websocket 节点写入 url
+func WithBasicAuth(username, password string) Option {
+	return func(o *clientOptions) {
+		auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		o.headers.Set("Authorization", "Basic "+auth)
+	}
+}
+
+// WithChainId 签名使用的 chainId, 节点的 eth_chainId 不一致时返回 ErrChainIdMismatch
+func WithChainId(chainId *big.Int) Option {
+	return func(o *clientOptions) {
+		o.chainId = chainId
+	}
+}
+
+// WithExpectedChainId 节点的 eth_chainId 不一致时连接返回 ErrChainIdMismatch
+func WithExpectedChainId(chainId *big.Int) Option {
+	return func(o *clientOptions) {
+		o.expectedChainId = chainId
+	}
+}
+
+// WithHTTPClient http(s) 节点使用的 http.Client, 其他协议返回 ErrHTTPOptionUnsupported
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *clientOptions) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithLazyConnect 第一次请求时才连接节点
+func WithLazyConnect() Option {
+	return func(o *clientOptions) {
+		o.lazy = true
+	}
+}
+
+// WithHealthCheckInterval 多节点时轮询各节点最新区块的间隔, 0 表示不检查
+func WithHealthCheckInterval(interval time.Duration) Option {
+	return func(o *clientOptions) {
+		o.healthCheckInterval = interval
+	}
+}
+
+// WithRetryPolicy 所有 RPC 调用的重试策略, NoRetryPolicy 表示不重试
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *clientOptions) {
+		o.retryPolicy = policy
+	}
+}
+
+// WithRateLimit 限制每个节点每秒的请求数
+func WithRateLimit(rate float64, burst int) Option {
+	return func(o *clientOptions) {
+		o.rateLimit = &RateLimit{Rate: rate, Burst: burst}
+	}
+}
+
+// WithEndpointRateLimit 单独设置某个节点的限流
+func WithEndpointRateLimit(nodeUrl string, rate float64, burst int) Option {
+	return func(o *clientOptions) {
+		o.endpointRateLimits[nodeUrl] = RateLimit{Rate: rate, Burst: burst}
+	}
+}
+
+// WithMethodRateLimit 限制每个节点上某个方法每秒的请求数
+func WithMethodRateLimit(method string, rate float64, burst int) Option {
+	return func(o *clientOptions) {
+		o.methodRateLimits[method] = RateLimit{Rate: rate, Burst: burst}
+	}
+}
+
+// WithMethodPriority 设置方法的优先级
+func WithMethodPriority(method string, priority Priority) Option {
+	return func(o *clientOptions) {
+		o.methodPriorities[method] = priority
+	}
+}
+
+// WithMaxBatchSize 一个 JSON-RPC batch 的最大请求数, 超出时拆分成多个 batch
+func WithMaxBatchSize(size int) Option {
+	return func(o *clientOptions) {
+		o.maxBatchSize = size
+	}
+}
+
+// WithCoalescing 合并进行中的相同读请求, window 内的不同读请求合并成一个 batch
+func WithCoalescing(window time.Duration) Option {
+	return func(o *clientOptions) {
+		o.coalesceWindow = window
+	}
+}
+
+// WithCache 缓存容量, 不可变的结果放入 LRU, latest 的结果缓存到下一个区块
+func WithCache(size int) Option {
+	return func(o *clientOptions) {
+		o.cacheSize = size
+	}
+}
+
+// WithCacheFinalityDepth 区块深度达到 depth 后其结果视为不可变
+func WithCacheFinalityDepth(depth uint64) Option {
+	return func(o *clientOptions) {
+		o.cacheFinalityDepth = depth
+	}
+}
+
+// WithHeadPollInterval 缓存轮询最新区块的间隔, 新区块和重组时清除 latest 的结果.
+// 0 表示不轮询, 此时不缓存 latest 的结果
+func WithHeadPollInterval(interval time.Duration) Option {
+	return func(o *clientOptions) {
+		o.headPollInterval = interval
+	}
+}
+
+// WithGasEstimateMultiplier eth_estimateGas 结果的安全系数
+func WithGasEstimateMultiplier(multiplier float64) Option {
+	return func(o *clientOptions) {
+		o.gasEstimateMultiplier = multiplier
+	}
+}
+
+// WithGasLimitCap gas limit 上限, 预估超过上限时返回 ErrGasLimitExceedsCap
+func WithGasLimitCap(gasCap uint64) Option {
+	return func(o *clientOptions) {
+		o.gasLimitCap = gasCap
+	}
+}
+
+// WithReceiptPollInterval WaitMined WaitConfirmed 和 TxTracker 轮询回执的间隔
+func WithReceiptPollInterval(interval time.Duration) Option {
+	return func(o *clientOptions) {
+		o.receiptPollInterval = interval
+	}
+}
+
+// WithFilterRetryPolicy log filter 和 pending filter 轮询失败以及重新安装时的退避策略,
+// 连续重新安装 MaxAttempts 次失败后订阅结束
+func WithFilterRetryPolicy(policy RetryPolicy) Option {
+	return func(o *clientOptions) {
+		o.filterRetryPolicy = policy
+	}
+}
+
+// WithLogRangeChunkSize GetLogsRange 每次 eth_getLogs 查询的初始区块数
+func WithLogRangeChunkSize(size uint64) Option {
+	return func(o *clientOptions) {
+		o.logRangeChunkSize = size
+	}
+}
+
+// WithLogRangeConcurrency GetLogsRange 并发查询的分段数
+func WithLogRangeConcurrency(concurrency int) Option {
+	return func(o *clientOptions) {
+		o.logRangeConcurrency = concurrency
+	}
+}
+
+// withInProcServer 通过进程内连接访问 server, 不按 url 拨号, 供 ForkBackend.Client 使用
+func withInProcServer(server *rpc.Server) Option {
+	return func(o *clientOptions) {
+		o.inProcServer = server
+	}
+}
+
+func dialRpcClient(ctx context.Context, nodeUrl string, o *clientOptions) (*rpc.Client, error) {
+	if o.inProcServer != nil {
+		return rpc.DialInProc(o.inProcServer), nil
+	}
+
+	u, err := url.Parse(nodeUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		httpClient := o.httpClient
+		if httpClient == nil {
+			httpClient = new(http.Client)
+		}
+		rpcClient, err := rpc.DialHTTPWithClient(nodeUrl, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		for key := range o.headers {
+			rpcClient.SetHeader(key, o.headers.Get(key))
+		}
+		return rpcClient, nil
+	case "ws", "wss":
+		if o.httpClient != nil {
+			return nil, fmt.Errorf("%w: http client on %s", ErrHTTPOptionUnsupported, u.Scheme)
+		}
+		username, password, hasAuth := basicAuth(o.headers)
+		for key := range o.headers {
+			if key == "Authorization" && hasAuth {
+				continue
+			}
+			// 静默丢弃 header 会让需要 api key 的节点在握手时才失败, 这里直接报错
+			return nil, fmt.Errorf("%w: %s", ErrWsHeaderUnsupported, key)
+		}
+		if u.User == nil && hasAuth {
+			u.User = url.UserPassword(username, password)
+		}
+		return rpc.DialWebsocket(ctx, u.String(), "")
+	default:
+		// ipc 等协议不会使用这些配置, 与 websocket 一样直接报错
+		if len(o.headers) > 0 || o.httpClient != nil {
+			return nil, fmt.Errorf("%w: %s", ErrHTTPOptionUnsupported, nodeUrl)
+		}
+		return rpc.DialContext(ctx, nodeUrl)
+	}
+}
+
+func basicAuth(headers http.Header) (string, string, bool) {
+	req := http.Request{Header: headers}
+	return req.BasicAuth()
+}
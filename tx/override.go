@@ -0,0 +1,128 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"strings"
+)
+
+// BlockTag 区块参数, 可以是 "latest" "pending" "earliest", 十六进制区块号或区块哈希
+type BlockTag string
+
+const (
+	BlockLatest   BlockTag = "latest"
+	BlockPending  BlockTag = "pending"
+	BlockEarliest BlockTag = "earliest"
+)
+
+// BlockNumberTag 指定区块号, nil 为 latest
+func BlockNumberTag(number *big.Int) BlockTag {
+	return BlockTag(toBlockNumArg(number))
+}
+
+// BlockHashTag 指定区块哈希 (EIP-1898)
+func BlockHashTag(hash common.Hash) BlockTag {
+	return BlockTag(hash.Hex())
+}
+
+func (t BlockTag) toArg() interface{} {
+	if t == "" {
+		return string(BlockLatest)
+	}
+	if str := string(t); len(str) == 2+2*common.HashLength && strings.HasPrefix(str, "0x") {
+		return map[string]interface{}{"blockHash": common.HexToHash(str)}
+	}
+	return string(t)
+}
+
+// OverrideAccount 调用前覆盖账户状态, nil 的字段保持原状态
+type OverrideAccount struct {
+	Nonce   *uint64
+	Code    []byte
+	Balance *big.Int
+	// State 替换账户的全部存储, StateDiff 只修改指定的槽, 两者不能同时设置
+	State     map[common.Hash]common.Hash
+	StateDiff map[common.Hash]common.Hash
+}
+
+// StateOverride eth_call debug_traceCall 的状态覆盖
+type StateOverride map[common.Address]OverrideAccount
+
+func (o StateOverride) toArg() interface{} {
+	if len(o) == 0 {
+		return nil
+	}
+
+	arg := make(map[common.Address]map[string]interface{}, len(o))
+	for address, account := range o {
+		item := map[string]interface{}{}
+		if account.Nonce != nil {
+			item["nonce"] = hexutil.Uint64(*account.Nonce)
+		}
+		if account.Code != nil {
+			item["code"] = hexutil.Bytes(account.Code)
+		}
+		if account.Balance != nil {
+			item["balance"] = (*hexutil.Big)(account.Balance)
+		}
+		if account.State != nil {
+			item["state"] = account.State
+		}
+		if account.StateDiff != nil {
+			item["stateDiff"] = account.StateDiff
+		}
+		arg[address] = item
+	}
+	return arg
+}
+
+// MappingSlot solidity mapping(address => ...) 中 key 对应的存储槽, slot 为 mapping 变量的槽位,
+// 例如 OpenZeppelin ERC20 的 _balances 槽位为 0
+func MappingSlot(key common.Address, slot uint64) common.Hash {
+	return crypto.Keccak256Hash(common.LeftPadBytes(key[:], 32), common.LeftPadBytes(new(big.Int).SetUint64(slot).Bytes(), 32))
+}
+
+// CallWithOverrides 在指定区块覆盖账户状态后执行 eth_call, 合约 revert 时返回 *RevertError
+func (e *Web3Client) CallWithOverrides(ctx context.Context, msg ethereum.CallMsg, block BlockTag, overrides StateOverride) ([]byte, error) {
+	args := []interface{}{toCallArg(msg), block.toArg()}
+	if override := overrides.toArg(); override != nil {
+		args = append(args, override)
+	}
+
+	raw, err := e.rawCall(ctx, "eth_call", args...)
+	if err != nil {
+		if isRevertError(err) {
+			revertErr := DecodeRevert(revertData(err))
+			revertErr.Message = err.Error()
+			return nil, revertErr
+		}
+		return nil, err
+	}
+
+	var result hexutil.Bytes
+	err = json.Unmarshal(raw, &result)
+	return result, err
+}
+
+// TraceCall 在指定区块覆盖账户状态后执行 debug_traceCall, 结果解析到 result, 例如 CallTracer 对应 *CallFrame
+func (e *Web3Client) TraceCall(ctx context.Context, msg ethereum.CallMsg, block BlockTag, overrides StateOverride,
+	config TraceConfig, result interface{}) error {
+	traceArg := config.toArg()
+	if override := overrides.toArg(); override != nil {
+		traceArg["stateOverrides"] = override
+	}
+
+	var raw json.RawMessage
+	err := e.call(ctx, "debug_traceCall", func(ep *endpoint) error {
+		return ep.rpcClient.CallContext(ctx, &raw, "debug_traceCall", toCallArg(msg), block.toArg(), traceArg)
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(nullRaw(raw), result)
+}
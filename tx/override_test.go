@@ -0,0 +1,67 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"math/big"
+	"testing"
+)
+
+func TestMappingSlot(t *testing.T) {
+	// keccak256(abi.encode(0x...01, 0))
+	slot := MappingSlot(common.HexToAddress("0x01"), 0)
+	if slot != common.HexToHash("0xada5013122d395ba3c54772283fb069b10426056ef8ca54750cb9bb552a59e7d") {
+		t.Fatalf("unexpected slot %s", slot.Hex())
+	}
+}
+
+func TestCallWithOverrides(t *testing.T) {
+	ctx := context.Background()
+	node := newTestNode(t, 1, "1")
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallet := common.HexToAddress("0x7b4452dd6c38597fa9364ac8905c27ea44425832")
+	nonce := uint64(3)
+	overrides := StateOverride{
+		wallet: {
+			Nonce:     &nonce,
+			Balance:   big.NewInt(1000),
+			StateDiff: map[common.Hash]common.Hash{MappingSlot(wallet, 0): common.HexToHash("0x64")},
+		},
+	}
+
+	result, err := client.CallWithOverrides(ctx, ethereum.CallMsg{To: &wallet}, BlockPending, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if new(big.Int).SetBytes(result).Int64() != 1000 {
+		t.Fatalf("override not applied: %x", result)
+	}
+
+	_, err = client.CallWithOverrides(ctx, ethereum.CallMsg{To: &wallet, Data: hexutil.MustDecode("0xdead")}, BlockLatest, nil)
+	var revertErr *RevertError
+	if !errors.As(err, &revertErr) || revertErr.Reason != "insufficient output amount" {
+		t.Fatalf("expected revert error, got %v", err)
+	}
+
+	var trace struct {
+		Block          interface{}                               `json:"block"`
+		Tracer         string                                    `json:"tracer"`
+		StateOverrides map[common.Address]map[string]interface{} `json:"stateOverrides"`
+	}
+	blockHash := common.HexToHash("0xabcd")
+	err = client.TraceCall(ctx, ethereum.CallMsg{To: &wallet}, BlockHashTag(blockHash), overrides, TraceConfig{Tracer: "{result: function() {}}"}, &trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := trace.Block.(map[string]interface{})
+	if block["blockHash"] != blockHash.Hex() || trace.Tracer == "" || trace.StateOverrides[wallet]["nonce"] != "0x3" {
+		t.Fatalf("unexpected trace call params %+v", trace)
+	}
+}
@@ -0,0 +1,400 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/rpc"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthCheckInterval = 15 * time.Second
+)
+
+// ErrNoEndpoint 没有可用节点
+var ErrNoEndpoint = errors.New("no endpoint available")
+
+// NewWeb3PoolClient 多节点客户端, 读请求路由到最健康的节点并在节点故障时自动切换, 交易并行广播到所有节点.
+// filter 安装在单个节点上, 该节点故障时切换到最健康的节点重新安装, 日志 filter 会补齐切换期间的日志
+func NewWeb3PoolClient(ctx context.Context, nodeUrls []string, opts ...Option) (*Web3Client, error) {
+	if len(nodeUrls) == 0 {
+		return nil, ErrNoEndpoint
+	}
+
+	options := defaultClientOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	client := &Web3Client{
+		options: options,
+		closeCh: make(chan struct{}),
+	}
+	for _, nodeUrl := range nodeUrls {
+		client.endpoints = append(client.endpoints, newEndpoint(nodeUrl, options))
+	}
+	if options.coalesceWindow > 0 {
+		client.coalescer = newCoalescer(client, options.coalesceWindow)
+	}
+	if options.cacheSize > 0 {
+		client.cache = newResponseCache(options.cacheSize, options.cacheFinalityDepth, options.headPollInterval > 0)
+	}
+
+	if !options.lazy {
+		if err := client.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(client.endpoints) > 1 && options.healthCheckInterval > 0 {
+		go client.healthCheck(options.healthCheckInterval)
+	}
+	if client.cache != nil && options.headPollInterval > 0 {
+		go client.watchHead(options.headPollInterval)
+	}
+	return client, nil
+}
+
+// connect 并行连接所有未连接的节点, 至少一个成功即可, 其余节点在请求时重试
+func (e *Web3Client) connect(ctx context.Context) error {
+	errs := make([]error, len(e.endpoints))
+	var wg sync.WaitGroup
+	for i, ep := range e.endpoints {
+		wg.Add(1)
+		go func(i int, ep *endpoint) {
+			defer wg.Done()
+			errs[i] = e.ready(ctx, ep)
+		}(i, ep)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return errs[0]
+}
+
+// ready 确保节点已连接且 chainId 与客户端一致
+func (e *Web3Client) ready(ctx context.Context, ep *endpoint) error {
+	if err := e.establishChainId(ctx); err != nil {
+		return err
+	}
+	if err := ep.connect(ctx); err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.chainId.Cmp(ep.chainId) != 0 {
+		return fmt.Errorf("endpoint %s: %w: expected %s, node reports %s", ep.url, ErrChainIdMismatch, e.chainId, ep.chainId)
+	}
+	if e.networkId == nil {
+		e.networkId = ep.networkId
+	}
+	return nil
+}
+
+// establishChainId 确定客户端的 chainId. 配置了 chainId 时直接使用, 每个节点连接时与之校验;
+// 否则连接所有节点, 可用节点的 chainId 必须一致, 不一致时返回 ErrChainIdMismatch 而不是信任最先连接的节点
+func (e *Web3Client) establishChainId(ctx context.Context) error {
+	e.mutex.Lock()
+	established := e.chainId != nil
+	e.mutex.Unlock()
+	if established {
+		return nil
+	}
+
+	e.establishMutex.Lock()
+	defer e.establishMutex.Unlock()
+	e.mutex.Lock()
+	established = e.chainId != nil
+	e.mutex.Unlock()
+	if established {
+		return nil
+	}
+
+	chainId := e.options.expectedChainId
+	if chainId == nil {
+		chainId = e.options.chainId
+	}
+	if chainId != nil {
+		e.mutex.Lock()
+		e.chainId = new(big.Int).Set(chainId)
+		e.mutex.Unlock()
+		return nil
+	}
+
+	errs := make([]error, len(e.endpoints))
+	var wg sync.WaitGroup
+	for i, ep := range e.endpoints {
+		wg.Add(1)
+		go func(i int, ep *endpoint) {
+			defer wg.Done()
+			errs[i] = ep.connect(ctx)
+		}(i, ep)
+	}
+	wg.Wait()
+
+	var agreed *endpoint
+	var reports []string
+	disagree := false
+	for i, ep := range e.endpoints {
+		if errs[i] != nil {
+			continue
+		}
+		reports = append(reports, fmt.Sprintf("%s=%s", ep.url, ep.chainId))
+		if agreed == nil {
+			agreed = ep
+		} else if agreed.chainId.Cmp(ep.chainId) != 0 {
+			disagree = true
+		}
+	}
+	if agreed == nil {
+		return errs[0]
+	}
+	if disagree {
+		return fmt.Errorf("%w: endpoints report %s", ErrChainIdMismatch, strings.Join(reports, ", "))
+	}
+
+	e.mutex.Lock()
+	e.chainId = agreed.chainId
+	e.networkId = agreed.networkId
+	e.mutex.Unlock()
+	return nil
+}
+
+func (e *Web3Client) headBlock() uint64 {
+	var head uint64
+	for _, ep := range e.endpoints {
+		ep.statMutex.RLock()
+		if ep.headBlock > head {
+			head = ep.headBlock
+		}
+		ep.statMutex.RUnlock()
+	}
+	return head
+}
+
+// sortedEndpoints 按健康度排序, 单节点时直接返回
+func (e *Web3Client) sortedEndpoints() []*endpoint {
+	if len(e.endpoints) == 1 {
+		return e.endpoints
+	}
+
+	head := e.headBlock()
+	scores := make(map[*endpoint]float64, len(e.endpoints))
+	for _, ep := range e.endpoints {
+		scores[ep] = ep.score(head)
+	}
+
+	endpoints := make([]*endpoint, len(e.endpoints))
+	copy(endpoints, e.endpoints)
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return scores[endpoints[i]] < scores[endpoints[j]]
+	})
+	return endpoints
+}
+
+// bestEndpoint 返回最健康的可用节点
+func (e *Web3Client) bestEndpoint(ctx context.Context) (*endpoint, error) {
+	var lastErr error = ErrNoEndpoint
+	for _, ep := range e.sortedEndpoints() {
+		if err := e.ready(ctx, ep); err != nil {
+			ep.record(0, true)
+			lastErr = err
+			continue
+		}
+		return ep, nil
+	}
+	return nil, lastErr
+}
+
+// call 在最健康的节点上执行请求, 节点故障时按健康度依次切换到其他节点, 仍失败时按重试策略重试
+func (e *Web3Client) call(ctx context.Context, method string, fn func(ep *endpoint) error) error {
+	return e.options.retryPolicy.retry(ctx, method, func() error {
+		return e.callOnce(ctx, method, []string{method}, fn)
+	})
+}
+
+// callBatch 同 call, batch 中的每个请求按各自的方法限流
+func (e *Web3Client) callBatch(ctx context.Context, methods []string, fn func(ep *endpoint) error) error {
+	return e.options.retryPolicy.retry(ctx, "batch", func() error {
+		return e.callOnce(ctx, "batch", methods, fn)
+	})
+}
+
+func (e *Web3Client) callOnce(ctx context.Context, method string, limited []string, fn func(ep *endpoint) error) error {
+	var lastErr error = ErrNoEndpoint
+	for _, ep := range e.sortedEndpoints() {
+		if err := e.ready(ctx, ep); err != nil {
+			ep.record(0, true)
+			lastErr = err
+			if ctx.Err() != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := ep.limiter.wait(ctx, limited...); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		err := fn(ep)
+		failed := e.isFailure(err)
+		ep.record(time.Since(start), failed)
+		if !failed || ctx.Err() != nil {
+			return err
+		}
+
+		if len(e.endpoints) > 1 {
+			log.Printf("%s failed on %s, failover: %s", method, ep.url, err.Error())
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+// filterFailover 返回 filter 的节点切换函数. 轮询的节点错误计入当前节点的健康度, 有更健康的节点时返回其连接
+func (e *Web3Client) filterFailover(ep *endpoint) func(ctx context.Context) *rpc.Client {
+	if len(e.endpoints) == 1 {
+		return nil
+	}
+	current := ep
+	return func(ctx context.Context) *rpc.Client {
+		current.record(0, true)
+		best, err := e.bestEndpoint(ctx)
+		if err != nil || best == current {
+			return nil
+		}
+		log.Printf("filter failover from %s to %s", current.url, best.url)
+		current = best
+		return best.rpcClient
+	}
+}
+
+// isFailure 节点自身的错误以及可重试的临时错误计入节点错误率并触发切换
+func (e *Web3Client) isFailure(err error) bool {
+	return err != nil && (isEndpointError(err) || e.options.retryPolicy.retryable(err))
+}
+
+// broadcast 在所有节点上并行执行请求, 返回第一个成功的结果, 全部失败时返回第一个节点的错误
+func (e *Web3Client) broadcast(ctx context.Context, method string, fn func(ep *endpoint) error) error {
+	if len(e.endpoints) == 1 {
+		return e.call(ctx, method, fn)
+	}
+
+	return e.options.retryPolicy.retry(ctx, method, func() error {
+		return e.broadcastOnce(ctx, method, fn)
+	})
+}
+
+func (e *Web3Client) broadcastOnce(ctx context.Context, method string, fn func(ep *endpoint) error) error {
+	errCh := make(chan error, len(e.endpoints))
+	for _, ep := range e.endpoints {
+		go func(ep *endpoint) {
+			if err := e.ready(ctx, ep); err != nil {
+				ep.record(0, true)
+				errCh <- err
+				return
+			}
+
+			if err := ep.limiter.wait(ctx, method); err != nil {
+				errCh <- err
+				return
+			}
+
+			start := time.Now()
+			err := fn(ep)
+			ep.record(time.Since(start), e.isFailure(err))
+			if err != nil {
+				log.Printf("%s failed on %s: %s", method, ep.url, err.Error())
+			}
+			errCh <- err
+		}(ep)
+	}
+
+	var firstErr error
+	for range e.endpoints {
+		err := <-errCh
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// healthCheck 定时获取各节点最新区块, 用于计算区块落后程度
+func (e *Web3Client) healthCheck(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.closeCh:
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, ep := range e.endpoints {
+			wg.Add(1)
+			go func(ep *endpoint) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				defer cancel()
+
+				if err := e.ready(ctx, ep); err != nil {
+					ep.record(0, true)
+					return
+				}
+
+				if err := ep.limiter.wait(ContextWithPriority(ctx, PriorityLow), "eth_blockNumber"); err != nil {
+					return
+				}
+
+				start := time.Now()
+				number, err := ep.ethClient.BlockNumber(ctx)
+				ep.record(time.Since(start), e.isFailure(err))
+				if err == nil {
+					ep.setHeadBlock(number)
+					if e.cache != nil {
+						e.cache.advanceHead(number)
+					}
+				}
+			}(ep)
+		}
+		wg.Wait()
+	}
+}
+
+// EndpointStats 返回各节点的健康状态
+func (e *Web3Client) EndpointStats() []EndpointStats {
+	head := e.headBlock()
+	stats := make([]EndpointStats, 0, len(e.endpoints))
+	for _, ep := range e.endpoints {
+		stats = append(stats, ep.stats(head))
+	}
+	return stats
+}
+
+// Close 停止健康检查并关闭所有节点连接
+func (e *Web3Client) Close() {
+	e.closeOnce.Do(func() {
+		close(e.closeCh)
+		for _, ep := range e.endpoints {
+			ep.close()
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package tx
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Priority 请求优先级, 限流时高优先级的请求先执行
+type Priority int
+
+const (
+	// PriorityLow 批量查询, 例如 mempool 交易查询
+	PriorityLow Priority = iota
+	PriorityNormal
+	// PriorityHigh 发送交易, 从不等待限流 (消耗的令牌由低优先级请求偿还)
+	PriorityHigh
+
+	numPriorities = int(PriorityHigh) + 1
+)
+
+var defaultMethodPriorities = map[string]Priority{
+	"eth_sendRawTransaction":   PriorityHigh,
+	"eth_sendTransaction":      PriorityHigh,
+	"eth_getTransactionByHash": PriorityLow,
+	"txpool_content":           PriorityLow,
+	"parity_allTransactions":   PriorityLow,
+}
+
+// RateLimit 令牌桶配置, Rate 为每秒请求数, Burst 为桶容量
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type priorityKey struct{}
+
+// ContextWithPriority 覆盖该 ctx 下所有请求的优先级
+func ContextWithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+func requestPriority(ctx context.Context, method string, options *clientOptions) Priority {
+	if priority, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return priority
+	}
+	if priority, ok := options.methodPriorities[method]; ok {
+		return priority
+	}
+	if priority, ok := defaultMethodPriorities[method]; ok {
+		return priority
+	}
+	return PriorityNormal
+}
+
+// tokenBucket 支持优先级的令牌桶, 有高优先级请求等待时低优先级请求让行
+type tokenBucket struct {
+	mutex   sync.Mutex
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	waiting [numPriorities]int
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   limit.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+func (b *tokenBucket) higherWaiting(priority Priority) bool {
+	for p := int(priority) + 1; p < numPriorities; p++ {
+		if b.waiting[p] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// wait 获取一个令牌, 返回是否发生了等待
+func (b *tokenBucket) wait(ctx context.Context, priority Priority) (bool, error) {
+	waited := false
+	for {
+		b.mutex.Lock()
+		b.refill(time.Now())
+		if priority >= PriorityHigh {
+			b.tokens--
+			b.mutex.Unlock()
+			return waited, nil
+		}
+
+		if b.tokens >= 1 && !b.higherWaiting(priority) {
+			b.tokens--
+			b.mutex.Unlock()
+			return waited, nil
+		}
+
+		delay := time.Millisecond
+		if b.tokens < 1 && b.rate > 0 {
+			if d := time.Duration((1 - b.tokens) / b.rate * float64(time.Second)); d > delay {
+				delay = d
+			}
+		}
+		b.waiting[priority]++
+		b.mutex.Unlock()
+
+		waited = true
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		b.mutex.Lock()
+		b.waiting[priority]--
+		b.mutex.Unlock()
+
+		if err := ctx.Err(); err != nil {
+			return waited, err
+		}
+	}
+}
+
+// endpointLimiter 单个节点的限流, 先按方法限流再按节点总量限流
+type endpointLimiter struct {
+	endpoint *tokenBucket
+	methods  map[string]*tokenBucket
+	options  *clientOptions
+	limited  uint64
+}
+
+func newEndpointLimiter(url string, options *clientOptions) *endpointLimiter {
+	limiter := &endpointLimiter{
+		methods: make(map[string]*tokenBucket),
+		options: options,
+	}
+
+	if limit, ok := options.endpointRateLimits[url]; ok {
+		limiter.endpoint = newTokenBucket(limit)
+	} else if options.rateLimit != nil {
+		limiter.endpoint = newTokenBucket(*options.rateLimit)
+	}
+
+	for method, limit := range options.methodRateLimits {
+		limiter.methods[method] = newTokenBucket(limit)
+	}
+	return limiter
+}
+
+// wait 为每个方法各获取一个令牌, batch 请求传入其中所有请求的方法
+func (l *endpointLimiter) wait(ctx context.Context, methods ...string) error {
+	for _, method := range methods {
+		priority := requestPriority(ctx, method, l.options)
+
+		buckets := []*tokenBucket{l.methods[method], l.endpoint}
+		for _, bucket := range buckets {
+			if bucket == nil {
+				continue
+			}
+
+			waited, err := bucket.wait(ctx, priority)
+			if waited {
+				atomic.AddUint64(&l.limited, 1)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package tx
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketPriority(t *testing.T) {
+	ctx := context.Background()
+	bucket := newTokenBucket(RateLimit{Rate: 20, Burst: 1})
+
+	if waited, _ := bucket.wait(ctx, PriorityLow); waited {
+		t.Fatal("first request should use the burst")
+	}
+
+	start := time.Now()
+	if waited, _ := bucket.wait(ctx, PriorityHigh); waited || time.Since(start) > 10*time.Millisecond {
+		t.Fatal("high priority requests should never wait")
+	}
+
+	start = time.Now()
+	if waited, _ := bucket.wait(ctx, PriorityLow); !waited || time.Since(start) < 50*time.Millisecond {
+		t.Fatal("low priority request should wait for the debt to be repaid")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := bucket.wait(ctx, PriorityNormal); err == nil {
+		t.Fatal("expected context error while waiting")
+	}
+}
+
+func TestRequestPriority(t *testing.T) {
+	options := defaultClientOptions()
+	WithMethodPriority("eth_call", PriorityHigh)(options)
+	ctx := context.Background()
+
+	if requestPriority(ctx, "eth_sendRawTransaction", options) != PriorityHigh {
+		t.Fatal("sends should be high priority")
+	}
+	if requestPriority(ctx, "eth_getTransactionByHash", options) != PriorityLow {
+		t.Fatal("tx lookups should be low priority")
+	}
+	if requestPriority(ctx, "eth_call", options) != PriorityHigh {
+		t.Fatal("method priority override ignored")
+	}
+	if requestPriority(ContextWithPriority(ctx, PriorityLow), "eth_sendRawTransaction", options) != PriorityLow {
+		t.Fatal("context priority override ignored")
+	}
+}
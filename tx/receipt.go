@@ -0,0 +1,165 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+	"time"
+)
+
+const (
+	defaultReceiptPollInterval = 3 * time.Second
+)
+
+// ErrReorged 交易所在区块已不在主链上
+var ErrReorged = errors.New("transaction reorged out of canonical chain")
+
+// Receipt 交易回执及 go-ethereum Receipt 中没有的 effectiveGasPrice
+type Receipt struct {
+	*types.Receipt
+	EffectiveGasPrice *big.Int
+}
+
+func (e *Web3Client) BlockNumber(ctx context.Context) (uint64, error) {
+	raw, err := e.rawCall(ctx, "eth_blockNumber")
+	if err != nil {
+		return 0, err
+	}
+
+	var number hexutil.Uint64
+	err = json.Unmarshal(raw, &number)
+	return uint64(number), err
+}
+
+// TransactionReceipt 交易还未打包时返回 ethereum.NotFound
+func (e *Web3Client) TransactionReceipt(ctx context.Context, hashStr string) (*Receipt, error) {
+	raw, err := e.rawCall(ctx, "eth_getTransactionReceipt", common.HexToHash(hashStr))
+	if err != nil {
+		return nil, err
+	}
+
+	var receipt *types.Receipt
+	if err := json.Unmarshal(raw, &receipt); err != nil {
+		return nil, err
+	}
+	if receipt == nil {
+		return nil, ethereum.NotFound
+	}
+
+	var extra struct {
+		EffectiveGasPrice *hexutil.Big `json:"effectiveGasPrice"`
+	}
+	if err := json.Unmarshal(raw, &extra); err != nil {
+		return nil, err
+	}
+	return &Receipt{Receipt: receipt, EffectiveGasPrice: (*big.Int)(extra.EffectiveGasPrice)}, nil
+}
+
+func (e *Web3Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	header, _, err := e.headerByNumber(ctx, number)
+	return header, err
+}
+
+// headerByNumber 同时返回节点给出的区块哈希, 部分链的区块哈希不能由 header 计算
+func (e *Web3Client) headerByNumber(ctx context.Context, number *big.Int) (*types.Header, common.Hash, error) {
+	raw, err := e.rawCall(ctx, "eth_getBlockByNumber", toBlockNumArg(number), false)
+	if err != nil {
+		return nil, common.Hash{}, err
+	}
+
+	var header *types.Header
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, common.Hash{}, err
+	}
+	if header == nil {
+		return nil, common.Hash{}, ethereum.NotFound
+	}
+
+	var block struct {
+		Hash common.Hash `json:"hash"`
+	}
+	if err := json.Unmarshal(raw, &block); err != nil {
+		return nil, common.Hash{}, err
+	}
+	return header, block.Hash, nil
+}
+
+// blockHashByNumber 主链上指定高度的区块哈希
+func (e *Web3Client) blockHashByNumber(ctx context.Context, number *big.Int) (common.Hash, error) {
+	raw, err := e.rawCall(ctx, "eth_getBlockByNumber", toBlockNumArg(number), false)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	var block *struct {
+		Hash common.Hash `json:"hash"`
+	}
+	if err := json.Unmarshal(raw, &block); err != nil {
+		return common.Hash{}, err
+	}
+	if block == nil {
+		return common.Hash{}, ethereum.NotFound
+	}
+	return block.Hash, nil
+}
+
+// WaitMined 轮询直到交易被打包
+func (e *Web3Client) WaitMined(ctx context.Context, hashStr string) (*Receipt, error) {
+	return e.WaitConfirmed(ctx, hashStr, 0)
+}
+
+// WaitConfirmed 轮询直到交易所在区块之后有 confirmations 个区块 (包含所在区块),
+// 期间发生重组会继续等待交易重新被打包
+func (e *Web3Client) WaitConfirmed(ctx context.Context, hashStr string, confirmations uint64) (*Receipt, error) {
+	ticker := time.NewTicker(e.options.receiptPollInterval)
+	defer ticker.Stop()
+
+	for {
+		receipt, err := e.confirmedReceipt(ctx, hashStr, confirmations)
+		if err == nil && receipt != nil {
+			return receipt, nil
+		}
+		if err != nil && !errors.Is(err, ethereum.NotFound) && !errors.Is(err, ErrReorged) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// confirmedReceipt 已达到确认数时返回回执, 还未达到时返回 nil
+func (e *Web3Client) confirmedReceipt(ctx context.Context, hashStr string, confirmations uint64) (*Receipt, error) {
+	receipt, err := e.TransactionReceipt(ctx, hashStr)
+	if err != nil {
+		return nil, err
+	}
+	if confirmations <= 1 {
+		return receipt, nil
+	}
+
+	head, err := e.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if head+1 < receipt.BlockNumber.Uint64()+confirmations {
+		return nil, nil
+	}
+
+	canonical, err := e.blockHashByNumber(ctx, receipt.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if canonical != receipt.BlockHash {
+		return nil, ErrReorged
+	}
+	return receipt, nil
+}
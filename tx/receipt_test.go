@@ -0,0 +1,154 @@
+package tx
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestWaitConfirmed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	node := newTestNode(t, 1, "1")
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL, WithReceiptPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := common.HexToHash("0x01")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		node.eth.setReceipt(hash, 100)
+		time.Sleep(50 * time.Millisecond)
+		node.eth.mutex.Lock()
+		node.eth.head = 102
+		node.eth.mutex.Unlock()
+	}()
+
+	receipt, err := client.WaitMined(ctx, hash.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.BlockNumber.Uint64() != 100 || receipt.EffectiveGasPrice.Int64() != 1000000000 {
+		t.Fatalf("unexpected receipt: block %s effectiveGasPrice %s", receipt.BlockNumber, receipt.EffectiveGasPrice)
+	}
+
+	receipt, err = client.WaitConfirmed(ctx, hash.Hex(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head, _ := client.BlockNumber(ctx); head != 102 {
+		t.Fatalf("confirmed before enough blocks, head %d", head)
+	}
+}
+
+func TestTxTracker(t *testing.T) {
+	ctx := context.Background()
+	node := newTestNode(t, 1, "1")
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracker := client.NewTxTracker(TrackerConfig{
+		Confirmations: 2,
+		PollInterval:  10 * time.Millisecond,
+		DropTimeout:   50 * time.Millisecond,
+	})
+	defer tracker.Stop()
+
+	dropped := common.HexToHash("0x02")
+	tracker.Track(dropped.Hex())
+
+	mined := common.HexToHash("0x03")
+	blockHash := node.eth.setReceipt(mined, 100)
+	tracker.Track(mined.Hex())
+
+	// 两笔交易的更新交替到达, 按哈希分别排队
+	received := make(map[common.Hash][]TxUpdate)
+	next := func(hash common.Hash) TxUpdate {
+		for {
+			if queue := received[hash]; len(queue) > 0 {
+				received[hash] = queue[1:]
+				return queue[0]
+			}
+			select {
+			case update := <-tracker.Updates():
+				received[update.Hash] = append(received[update.Hash], update)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timeout waiting update of %s", hash.Hex())
+			}
+		}
+	}
+
+	update := next(mined)
+	if update.Status != TxMined || update.BlockHash != blockHash || update.GasUsed != 21000 || !update.Success {
+		t.Fatalf("unexpected mined update: %+v", update)
+	}
+
+	// 区块 100 被替换
+	node.eth.mutex.Lock()
+	node.eth.extra = []byte("reorg")
+	node.eth.head = 101
+	node.eth.mutex.Unlock()
+	if update = next(mined); update.Status != TxReorged {
+		t.Fatalf("expected reorged, got %s", update.Status)
+	}
+
+	blockHash = node.eth.setReceipt(mined, 101)
+	if update = next(mined); update.Status != TxMined || update.BlockHash != blockHash {
+		t.Fatalf("expected mined again, got %+v", update)
+	}
+	node.eth.mutex.Lock()
+	node.eth.head = 102
+	node.eth.mutex.Unlock()
+	if update = next(mined); update.Status != TxConfirmed || update.BlockNumber != 101 {
+		t.Fatalf("expected confirmed, got %+v", update)
+	}
+
+	if update = next(dropped); update.Status != TxDropped {
+		t.Fatalf("expected dropped, got %s", update.Status)
+	}
+}
+
+func TestTxTrackerSlowReceipt(t *testing.T) {
+	node := newTestNode(t, 1, "1")
+	client, err := NewWeb3ClientWithOptions(context.Background(), node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interval := 300 * time.Millisecond
+	tracker := client.NewTxTracker(TrackerConfig{PollInterval: interval})
+	defer tracker.Stop()
+
+	// 回执查询超时的交易不能拖慢其他交易
+	node.eth.mutex.Lock()
+	node.eth.receiptDelays = make(map[common.Hash]time.Duration)
+	for i := int64(1); i <= 3; i++ {
+		slow := common.BigToHash(big.NewInt(i))
+		node.eth.receiptDelays[slow] = 2 * interval
+		tracker.Track(slow.Hex())
+	}
+	node.eth.mutex.Unlock()
+
+	fast := common.HexToHash("0xff")
+	node.eth.setReceipt(fast, 100)
+	start := time.Now()
+	tracker.Track(fast.Hex())
+
+	select {
+	case update := <-tracker.Updates():
+		if update.Hash != fast || update.Status != TxMined {
+			t.Fatalf("unexpected update %+v", update)
+		}
+		if elapsed := time.Since(start); elapsed > interval*11/6 {
+			t.Fatalf("fast tx delayed by slow receipts: %s", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for fast tx")
+	}
+}
@@ -0,0 +1,174 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum/rpc"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy RPC 请求重试策略, 读请求和幂等的写请求都会按此策略重试
+type RetryPolicy struct {
+	// 最大尝试次数 (包含第一次), 小于等于 1 表示不重试
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// 随机抖动比例 0 ~ 1, 避免多个请求同时重试
+	Jitter float64
+	// 自定义可重试错误判断, 为 nil 时使用 IsRetryableError
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy 默认重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// NoRetryPolicy 不重试
+var NoRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+var (
+	// 可以重试的 HTTP 状态码: 限流和网关错误
+	retryableStatusCodes = map[int]bool{
+		http.StatusTooManyRequests:    true,
+		http.StatusBadGateway:         true,
+		http.StatusServiceUnavailable: true,
+		http.StatusGatewayTimeout:     true,
+	}
+
+	// 可以重试的 JSON-RPC 错误码: Infura 的 -32005 (限流, 范围过大除外) 以及 Alchemy 等在 JSON-RPC 中返回的 429
+	retryableErrorCodes = map[int]bool{
+		limitExceededErrorCode: true,
+		429:                    true,
+	}
+
+	// 节点在 -32000 等通用错误码中返回的临时错误信息, 只匹配 JSON-RPC 错误:
+	// geth 的 "header not found" "unknown block", Infura 的 "project ID request rate exceeded" "request rate limited"
+	retryableMessages = []string{
+		"header not found",
+		"unknown block",
+		"request rate exceeded",
+		"request rate limited",
+		"rate limit exceeded",
+		"too many requests",
+	}
+
+	// 非幂等的方法, 重复发送会产生不同结果, 不会重试
+	nonIdempotentMethods = map[string]bool{
+		"eth_sendTransaction":      true,
+		"personal_sendTransaction": true,
+		"eth_sign":                 true,
+		"personal_sign":            true,
+	}
+)
+
+// revertErrorCode geth 返回 revert 时的错误码
+const revertErrorCode = 3
+
+// IsRetryableError 超时 连接重置 限流 网关错误以及 "header not found" 等临时错误可以重试, revert nonce too low 等确定性错误不重试.
+// 按错误类型 HTTP 状态码和 JSON-RPC 错误码判断, 不在整个错误文本中查找子串, 避免 revert 数据或地址中的 "429" 被误判
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return retryableStatusCodes[httpErr.StatusCode]
+	}
+
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) || rpcErr.ErrorCode() == revertErrorCode {
+		return false
+	}
+	if retryableErrorCodes[rpcErr.ErrorCode()] {
+		return !isRangeError(err)
+	}
+	msg := strings.ToLower(rpcErr.Error())
+	for _, s := range retryableMessages {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownTransactionError 节点已经有这笔交易
+func isKnownTransactionError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
+
+func isIdempotent(method string) bool {
+	return !nonIdempotentMethods[method]
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryableError(err)
+}
+
+// backoff 第 attempt 次失败后的等待时间 (attempt 从 1 开始)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(backoff)
+}
+
+// retry 按策略执行 fn, 不可重试的错误或 ctx 结束时立即返回
+func (p RetryPolicy) retry(ctx context.Context, method string, fn func() error) error {
+	attempts := p.MaxAttempts
+	if attempts < 1 || !isIdempotent(method) {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= attempts || !p.retryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/snail-plus/eth-pkg/tx/txtest"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type testRpcError struct {
+	msg string
+}
+
+func (e testRpcError) Error() string  { return e.msg }
+func (e testRpcError) ErrorCode() int { return -32000 }
+
+func TestIsRetryableError(t *testing.T) {
+	revertData := "0x08c379a0" + strings.Repeat("0", 56) + "429"
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{rpc.HTTPError{StatusCode: 429, Status: "429 Too Many Requests"}, true},
+		{rpc.HTTPError{StatusCode: 503, Status: "503 Service Unavailable"}, true},
+		{rpc.HTTPError{StatusCode: 400, Status: "400 Bad Request", Body: []byte("timeout")}, false},
+		{testRpcError{"header not found"}, true},
+		{testRpcError{"project ID request rate exceeded"}, true},
+		{&txtest.MockError{Code: limitExceededErrorCode, Message: "daily request count exceeded"}, true},
+		{&txtest.MockError{Code: limitExceededErrorCode, Message: "query returned more than 10000 results"}, false},
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{fmt.Errorf("post: %w", io.ErrUnexpectedEOF), true},
+		{context.DeadlineExceeded, true},
+		{context.Canceled, false},
+		{testRpcError{"nonce too low"}, false},
+		{testRpcError{"execution reverted: TransferHelper"}, false},
+		{testRpcError{"already known"}, false},
+		{testRpcError{"invalid argument 0: hex string too long"}, false},
+		// 文本中的 429 timeout eof 不代表临时错误
+		{&txtest.MockError{Code: revertErrorCode, Message: "execution reverted: timeout", Data: revertData}, false},
+		{testRpcError{"invalid address 0x429eof0000000000000000000000000000000000"}, false},
+		{errors.New("unexpected 429 in response"), false},
+	}
+
+	for _, c := range cases {
+		if IsRetryableError(c.err) != c.retryable {
+			t.Errorf("IsRetryableError(%q) should be %v", c.err, c.retryable)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}
+	ctx := context.Background()
+
+	attempts := 0
+	err := policy.retry(ctx, "eth_blockNumber", func() error {
+		attempts++
+		return testRpcError{"header not found"}
+	})
+	if err == nil || attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d (%v)", attempts, err)
+	}
+
+	attempts = 0
+	_ = policy.retry(ctx, "eth_call", func() error {
+		attempts++
+		return testRpcError{"execution reverted"}
+	})
+	if attempts != 1 {
+		t.Fatalf("reverts should not be retried, got %d attempts", attempts)
+	}
+
+	attempts = 0
+	_ = policy.retry(ctx, "eth_sendTransaction", func() error {
+		attempts++
+		return errors.New("timeout")
+	})
+	if attempts != 1 {
+		t.Fatalf("non idempotent methods should not be retried, got %d attempts", attempts)
+	}
+}
@@ -0,0 +1,205 @@
+package tx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/snail-plus/eth-pkg/contract"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+var (
+	// Error(string)
+	errorSelector = crypto.Keccak256([]byte("Error(string)"))[:4]
+	// Panic(uint256)
+	panicSelector = crypto.Keccak256([]byte("Panic(uint256)"))[:4]
+
+	// https://docs.soliditylang.org/en/latest/control-structures.html#panic-via-assert-and-error-via-require
+	panicReasons = map[uint64]string{
+		0x00: "generic panic",
+		0x01: "assert(false)",
+		0x11: "arithmetic underflow or overflow",
+		0x12: "division or modulo by zero",
+		0x21: "enum overflow",
+		0x22: "invalid encoded storage byte array accessed",
+		0x31: "out-of-bounds array access; popping on an empty array",
+		0x32: "out-of-bounds access of an array or bytesN",
+		0x41: "out of memory",
+		0x51: "uninitialized function",
+	}
+
+	revertErrorsMutex sync.RWMutex
+	// 自定义 error 的 selector -> 定义
+	revertErrors = map[[4]byte]abi.Error{}
+)
+
+func init() {
+	for _, abiStr := range []string{contract.Erc20ABI, contract.Erc721ABI, contract.Erc1155ABI,
+		contract.UniswapFactoryABI, contract.UniswapPairABI, contract.UniswapRouterABI} {
+		if err := RegisterRevertABI(abiStr); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterRevertABI 注册合约 ABI 中的自定义 error, DecodeRevert 解析时使用, contract 包中的 ABI 默认已注册
+func RegisterRevertABI(abiStr string) error {
+	parsed, err := abi.JSON(strings.NewReader(abiStr))
+	if err != nil {
+		return err
+	}
+
+	revertErrorsMutex.Lock()
+	defer revertErrorsMutex.Unlock()
+	for _, abiErr := range parsed.Errors {
+		var selector [4]byte
+		copy(selector[:], abiErr.ID[:4])
+		revertErrors[selector] = abiErr
+	}
+	return nil
+}
+
+// RevertError 交易执行失败的原因, Reason PanicCode ErrorName 根据 revert 数据类型设置其中之一
+type RevertError struct {
+	TxHash common.Hash
+	// Error(string) 的信息
+	Reason string
+	// Panic(uint256) 的错误码
+	PanicCode *big.Int
+	// 自定义 error 的名称及参数
+	ErrorName string
+	ErrorArgs []interface{}
+	// 原始 revert 数据, 无法解析时只有该字段
+	Data []byte
+	// 节点返回的错误信息
+	Message string
+}
+
+func (e *RevertError) Error() string {
+	switch {
+	case e.Reason != "":
+		return fmt.Sprintf("execution reverted: %s", e.Reason)
+	case e.PanicCode != nil:
+		reason, ok := panicReasons[e.PanicCode.Uint64()]
+		if !ok || !e.PanicCode.IsUint64() {
+			reason = "unknown panic"
+		}
+		return fmt.Sprintf("execution reverted: panic 0x%x (%s)", e.PanicCode, reason)
+	case e.ErrorName != "":
+		return fmt.Sprintf("execution reverted: %s%v", e.ErrorName, e.ErrorArgs)
+	case e.Message != "":
+		return e.Message
+	}
+	return "execution reverted"
+}
+
+// DecodeRevert 解析 revert 数据, 支持 Error(string) Panic(uint256) 以及已注册的自定义 error
+func DecodeRevert(data []byte) *RevertError {
+	revertErr := &RevertError{Data: data}
+	if len(data) < 4 {
+		return revertErr
+	}
+
+	selector := data[:4]
+	switch {
+	case bytes.Equal(selector, errorSelector):
+		if reason, err := abi.UnpackRevert(data); err == nil {
+			revertErr.Reason = reason
+		}
+	case bytes.Equal(selector, panicSelector):
+		if len(data) == 4+32 {
+			revertErr.PanicCode = new(big.Int).SetBytes(data[4:])
+		}
+	default:
+		var id [4]byte
+		copy(id[:], selector)
+		revertErrorsMutex.RLock()
+		abiErr, ok := revertErrors[id]
+		revertErrorsMutex.RUnlock()
+		if !ok {
+			break
+		}
+		if args, err := abiErr.Inputs.Unpack(data[4:]); err == nil {
+			revertErr.ErrorName = abiErr.Name
+			revertErr.ErrorArgs = args
+		}
+	}
+	return revertErr
+}
+
+// RevertReason 在失败交易所在区块的父区块上用 eth_call 重放交易得到 revert 原因,
+// 交易执行成功时返回 nil, 交易未打包时返回 ethereum.NotFound
+func (e *Web3Client) RevertReason(ctx context.Context, hashStr string) (*RevertError, error) {
+	receipt, err := e.TransactionReceipt(ctx, hashStr)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		return nil, nil
+	}
+	return e.replayRevert(ctx, receipt)
+}
+
+// replayRevert 父区块的状态不包含同一区块中排在前面的交易, 重放不一定会失败, 此时只能根据 gas 判断是否 out of gas
+func (e *Web3Client) replayRevert(ctx context.Context, receipt *Receipt) (*RevertError, error) {
+	raw, err := e.rawCall(ctx, "eth_getTransactionByHash", receipt.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	var rpcTx *rpcTransaction
+	if err := json.Unmarshal(raw, &rpcTx); err != nil {
+		return nil, err
+	}
+	if rpcTx == nil || rpcTx.tx == nil {
+		return nil, ethereum.NotFound
+	}
+	tx := rpcTx.tx
+
+	// 节点返回的 from 不依赖客户端的 chainId 配置, 缺失时才恢复签名者
+	var from common.Address
+	if rpcTx.From != nil {
+		from = *rpcTx.From
+	} else if from, err = types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err != nil {
+		return nil, err
+	}
+
+	msg := ethereum.CallMsg{
+		From:  from,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}
+	parent := new(big.Int).Sub(receipt.BlockNumber, big.NewInt(1))
+	_, err = e.CallContract(ctx, msg, parent)
+	if err != nil && !isRevertError(err) {
+		return nil, err
+	}
+
+	revertErr := DecodeRevert(revertData(err))
+	revertErr.TxHash = receipt.TxHash
+	if err != nil {
+		revertErr.Message = err.Error()
+	} else if receipt.GasUsed >= tx.Gas() {
+		revertErr.Message = "out of gas"
+	}
+	return revertErr, nil
+}
+
+// isRevertError eth_call 执行失败 (revert invalid opcode out of gas 等), 而不是请求本身失败
+func isRevertError(err error) bool {
+	if revertData(err) != nil {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "execution reverted") || strings.Contains(msg, "invalid opcode") ||
+		strings.Contains(msg, "out of gas") || strings.Contains(msg, "vm execution error")
+}
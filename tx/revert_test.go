@@ -0,0 +1,85 @@
+package tx
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"testing"
+)
+
+func TestDecodeRevert(t *testing.T) {
+	revertErr := DecodeRevert(hexutil.MustDecode(testRevertData))
+	if revertErr.Reason != "insufficient output amount" {
+		t.Fatalf("unexpected reason %q", revertErr.Reason)
+	}
+
+	// Panic(0x11)
+	data := append(append([]byte{}, panicSelector...), common.LeftPadBytes([]byte{0x11}, 32)...)
+	revertErr = DecodeRevert(data)
+	if revertErr.PanicCode == nil || revertErr.PanicCode.Int64() != 0x11 {
+		t.Fatalf("unexpected panic code %v", revertErr.PanicCode)
+	}
+	if revertErr.Error() != "execution reverted: panic 0x11 (arithmetic underflow or overflow)" {
+		t.Fatalf("unexpected message %q", revertErr.Error())
+	}
+
+	abiStr := `[{"inputs":[{"internalType":"uint256","name":"available","type":"uint256"},{"internalType":"uint256","name":"required","type":"uint256"}],"name":"InsufficientBalance","type":"error"}]`
+	if err := RegisterRevertABI(abiStr); err != nil {
+		t.Fatal(err)
+	}
+	data = append(crypto.Keccak256([]byte("InsufficientBalance(uint256,uint256)"))[:4],
+		append(common.LeftPadBytes([]byte{1}, 32), common.LeftPadBytes([]byte{2}, 32)...)...)
+	revertErr = DecodeRevert(data)
+	if revertErr.ErrorName != "InsufficientBalance" || len(revertErr.ErrorArgs) != 2 ||
+		revertErr.ErrorArgs[1].(*big.Int).Int64() != 2 {
+		t.Fatalf("unexpected custom error %s %v", revertErr.ErrorName, revertErr.ErrorArgs)
+	}
+
+	revertErr = DecodeRevert([]byte{1, 2, 3, 4})
+	if revertErr.Reason != "" || revertErr.PanicCode != nil || revertErr.ErrorName != "" || len(revertErr.Data) != 4 {
+		t.Fatalf("unknown selector should only keep data: %+v", revertErr)
+	}
+}
+
+func TestRevertReason(t *testing.T) {
+	ctx := context.Background()
+	node := newTestNode(t, 1, "1")
+	// 交易的 chainId 与节点不一致时仍可以通过交易的 from 重放
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	to := common.HexToAddress("0x7b4452dd6c38597fa9364ac8905c27ea44425832")
+	tx, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(56)), &types.LegacyTx{
+		To:       &to,
+		Gas:      100000,
+		GasPrice: big.NewInt(5),
+		Data:     hexutil.MustDecode("0xdead"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node.eth.addTransaction(tx)
+	node.eth.setReceipt(tx.Hash(), 100)
+
+	revertErr, err := client.RevertReason(ctx, tx.Hash().Hex())
+	if err != nil || revertErr != nil {
+		t.Fatalf("successful tx should not have revert reason: %v %v", revertErr, err)
+	}
+
+	node.eth.mutex.Lock()
+	node.eth.receipts[tx.Hash()]["status"] = "0x0"
+	node.eth.mutex.Unlock()
+	revertErr, err = client.RevertReason(ctx, tx.Hash().Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revertErr.TxHash != tx.Hash() || revertErr.Reason != "insufficient output amount" {
+		t.Fatalf("unexpected revert error %+v", revertErr)
+	}
+}
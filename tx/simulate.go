@@ -0,0 +1,233 @@
+package tx
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"math/big"
+)
+
+// BundleTx 待模拟的交易, Tx 为已签名交易, 未签名时使用 Msg
+type BundleTx struct {
+	Tx  *types.Transaction
+	Msg ethereum.CallMsg
+}
+
+// SimulatedTx 单笔交易的模拟结果
+type SimulatedTx struct {
+	Index int
+	// 未签名交易为空
+	Hash    common.Hash
+	From    common.Address
+	GasUsed uint64
+	// 回滚的调用产生的日志不包含在内
+	Logs []*types.Log
+	// 余额变化, 不包含 gas 费用
+	BalanceDeltas map[common.Address]*big.Int
+	// 交易失败时不为 nil
+	Revert *RevertError
+	Trace  *CallFrame
+}
+
+// BundleResult 交易组的模拟结果
+type BundleResult struct {
+	Txs           []*SimulatedTx
+	GasUsed       uint64
+	BalanceDeltas map[common.Address]*big.Int
+	// 第一笔失败的交易, 没有失败时为 -1
+	FirstRevert int
+}
+
+// SimulateBundle 在 block 状态 (一般为 BlockPending) 上依次执行交易, 每笔交易通过 debug_traceCall 执行,
+// 前面交易修改的状态以 state override 的方式传给后面的交易, 失败的交易不影响后续交易的状态.
+// 需要节点支持 prestateTracer 的 diffMode, 交易不检查 nonce 且不扣除 gas 费用
+func (e *Web3Client) SimulateBundle(ctx context.Context, txs []BundleTx, block BlockTag, overrides StateOverride) (*BundleResult, error) {
+	state := make(StateOverride, len(overrides))
+	for address, account := range overrides {
+		state[address] = account
+	}
+
+	result := &BundleResult{
+		BalanceDeltas: make(map[common.Address]*big.Int),
+		FirstRevert:   -1,
+	}
+	for i, bundleTx := range txs {
+		simulated, diff, err := e.simulateTx(ctx, i, bundleTx, block, state)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Txs = append(result.Txs, simulated)
+		result.GasUsed += simulated.GasUsed
+		if simulated.Revert != nil {
+			if result.FirstRevert < 0 {
+				result.FirstRevert = i
+			}
+			continue
+		}
+
+		state.apply(diff)
+		for address, delta := range simulated.BalanceDeltas {
+			if total, ok := result.BalanceDeltas[address]; ok {
+				total.Add(total, delta)
+			} else {
+				result.BalanceDeltas[address] = new(big.Int).Set(delta)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (e *Web3Client) simulateTx(ctx context.Context, index int, bundleTx BundleTx, block BlockTag,
+	state StateOverride) (*SimulatedTx, *PrestateDiff, error) {
+	simulated := &SimulatedTx{Index: index, BalanceDeltas: make(map[common.Address]*big.Int)}
+
+	msg := bundleTx.Msg
+	if tx := bundleTx.Tx; tx != nil {
+		// 按交易自身的 chainId 恢复发送者, 与客户端的 chainId 配置无关
+		from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg = ethereum.CallMsg{
+			From:  from,
+			To:    tx.To(),
+			Gas:   tx.Gas(),
+			Value: tx.Value(),
+			Data:  tx.Data(),
+		}
+		simulated.Hash = tx.Hash()
+	}
+	simulated.From = msg.From
+
+	var frame *CallFrame
+	config := TraceConfig{Tracer: CallTracer, TracerConfig: map[string]interface{}{"withLog": true}}
+	if err := e.TraceCall(ctx, msg, block, state, config, &frame); err != nil {
+		return nil, nil, err
+	}
+	if frame == nil {
+		return nil, nil, ethereum.NotFound
+	}
+	simulated.Trace = frame
+	simulated.GasUsed = frame.GasUsed
+	if simulated.Revert = frame.Revert(); simulated.Revert != nil {
+		simulated.Revert.TxHash = simulated.Hash
+		return simulated, nil, nil
+	}
+	simulated.Logs = frameLogs(frame, index, simulated.Hash, nil)
+
+	var diff *PrestateDiff
+	config = TraceConfig{Tracer: PrestateTracer, TracerConfig: map[string]interface{}{"diffMode": true}}
+	if err := e.TraceCall(ctx, msg, block, state, config, &diff); err != nil {
+		return nil, nil, err
+	}
+	if diff == nil {
+		diff = &PrestateDiff{}
+	}
+	// 没有 pre 的账户在交易中创建, 没有 post 的账户被删除, 缺失的余额都按 0 计算.
+	// post 中有账户但没有余额表示余额未变
+	for address, post := range diff.Post {
+		if post.Balance == nil {
+			continue
+		}
+		delta := new(big.Int).Set(post.Balance)
+		if pre := diff.Pre[address]; pre != nil && pre.Balance != nil {
+			delta.Sub(delta, pre.Balance)
+		}
+		if delta.Sign() != 0 {
+			simulated.BalanceDeltas[address] = delta
+		}
+	}
+	for address, pre := range diff.Pre {
+		if _, ok := diff.Post[address]; !ok && pre.Balance != nil && pre.Balance.Sign() != 0 {
+			simulated.BalanceDeltas[address] = new(big.Int).Neg(pre.Balance)
+		}
+	}
+	return simulated, diff, nil
+}
+
+// frameLogs 按执行顺序收集调用树中的日志, 日志的 Position 为其之前已发起的子调用数, 跳过失败的调用
+func frameLogs(frame *CallFrame, txIndex int, txHash common.Hash, logs []*types.Log) []*types.Log {
+	if frame.Error != "" {
+		return logs
+	}
+	next := 0
+	// position 为 -1 时输出剩余全部日志
+	appendLogs := func(position int) {
+		for ; next < len(frame.Logs) && (position < 0 || int(frame.Logs[next].Position) <= position); next++ {
+			l := frame.Logs[next]
+			logs = append(logs, &types.Log{
+				Address: l.Address,
+				Topics:  l.Topics,
+				Data:    l.Data,
+				TxHash:  txHash,
+				TxIndex: uint(txIndex),
+				Index:   uint(len(logs)),
+			})
+		}
+	}
+	for i := range frame.Calls {
+		appendLogs(i)
+		logs = frameLogs(&frame.Calls[i], txIndex, txHash, logs)
+	}
+	appendLogs(-1)
+	return logs
+}
+
+// apply 把交易执行后的状态合并到 override: 只出现在 pre 中的账户已被删除, 只出现在 pre 中的 slot 已被置零
+func (o StateOverride) apply(diff *PrestateDiff) {
+	for address := range diff.Pre {
+		if _, ok := diff.Post[address]; !ok {
+			var nonce uint64
+			o[address] = OverrideAccount{
+				Nonce:   &nonce,
+				Code:    []byte{},
+				Balance: new(big.Int),
+				State:   map[common.Hash]common.Hash{},
+			}
+		}
+	}
+	for address, account := range diff.Post {
+		override := o[address]
+		if account.Balance != nil {
+			override.Balance = account.Balance
+		}
+		if account.Nonce != 0 {
+			nonce := account.Nonce
+			override.Nonce = &nonce
+		}
+		if account.Code != nil {
+			override.Code = account.Code
+		}
+
+		changed := make(map[common.Hash]common.Hash, len(account.Storage))
+		if pre := diff.Pre[address]; pre != nil {
+			for slot := range pre.Storage {
+				changed[slot] = common.Hash{}
+			}
+		}
+		for slot, value := range account.Storage {
+			changed[slot] = value
+		}
+		if len(changed) > 0 {
+			storage := override.StateDiff
+			if override.State != nil {
+				storage = override.State
+			}
+			merged := make(map[common.Hash]common.Hash, len(storage)+len(changed))
+			for slot, value := range storage {
+				merged[slot] = value
+			}
+			for slot, value := range changed {
+				merged[slot] = value
+			}
+			if override.State != nil {
+				override.State = merged
+			} else {
+				override.StateDiff = merged
+			}
+		}
+		o[address] = override
+	}
+}
@@ -0,0 +1,119 @@
+package tx
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"testing"
+)
+
+func TestSimulateBundle(t *testing.T) {
+	ctx := context.Background()
+	node := newTestNode(t, 1, "1")
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0x02")
+	// 按交易自身的 chainId 恢复发送者, 不受客户端 chainId 的限制
+	signed, err := types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(56)), &types.LegacyTx{
+		To:       &to,
+		Gas:      21000,
+		GasPrice: big.NewInt(5),
+		Value:    big.NewInt(600),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txs := []BundleTx{
+		{Tx: signed},
+		{Msg: ethereum.CallMsg{From: from, To: &to, Data: hexutil.MustDecode("0xdead")}},
+		{Msg: ethereum.CallMsg{From: from, To: &to, Value: big.NewInt(300)}},
+	}
+	result, err := client.SimulateBundle(ctx, txs, BlockPending, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := result.Txs[0]
+	if first.Hash != signed.Hash() || first.From != from || first.GasUsed != 21000 || first.Revert != nil ||
+		first.BalanceDeltas[from].Int64() != -600 {
+		t.Fatalf("unexpected first tx %+v", first)
+	}
+	if len(first.Logs) != 1 || first.Logs[0].Address != to || first.Logs[0].TxHash != signed.Hash() {
+		t.Fatalf("reverted sub call logs should be skipped: %+v", first.Logs)
+	}
+	if result.FirstRevert != 1 || result.Txs[1].Revert.Reason != "insufficient output amount" {
+		t.Fatalf("unexpected revert %+v", result.Txs[1].Revert)
+	}
+
+	// 第三笔交易在第一笔之后的余额 400 上执行
+	third := result.Txs[2]
+	if third.BalanceDeltas[from].Int64() != -300 || result.BalanceDeltas[from].Int64() != -900 {
+		t.Fatalf("state not carried between txs: %v %v", third.BalanceDeltas, result.BalanceDeltas)
+	}
+	// 收款账户在 bundle 中创建, 没有 pre 状态时按余额 0 计算
+	if first.BalanceDeltas[to].Int64() != 600 || third.BalanceDeltas[to].Int64() != 300 || result.BalanceDeltas[to].Int64() != 900 {
+		t.Fatalf("unexpected recipient deltas: %v %v %v", first.BalanceDeltas, third.BalanceDeltas, result.BalanceDeltas)
+	}
+	if result.GasUsed != 21000*2+0x6000 {
+		t.Fatalf("unexpected total gas %d", result.GasUsed)
+	}
+
+	txs[2].Msg.Value = big.NewInt(500)
+	if _, err := client.SimulateBundle(ctx, txs, BlockPending, nil); err == nil {
+		t.Fatal("expected insufficient funds after first tx")
+	}
+}
+
+func TestSimulateBundleStorage(t *testing.T) {
+	ctx := context.Background()
+	node := newTestNode(t, 1, "1")
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from := common.HexToAddress("0x01")
+	token := testTokenAddress
+	transfer := func(amount int64) BundleTx {
+		return BundleTx{Msg: ethereum.CallMsg{From: from, To: &token, Data: common.BigToHash(big.NewInt(amount)).Bytes()}}
+	}
+
+	// 第一笔交易转出全部余额, slot 置零后只出现在 pre 中, 第二笔交易应因余额不足而 revert
+	result, err := client.SimulateBundle(ctx, []BundleTx{transfer(1000), transfer(1)}, BlockPending, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Txs[0].Revert != nil || result.FirstRevert != 1 {
+		t.Fatalf("zeroed slot not carried to next tx: first revert %d", result.FirstRevert)
+	}
+
+	// 日志按执行顺序排列: 调用前的日志, 子调用的日志, 调用后的日志
+	logs := result.Txs[0].Logs
+	if len(logs) != 3 {
+		t.Fatalf("unexpected logs %+v", logs)
+	}
+	for i, l := range logs {
+		if l.Index != uint(i) || l.Data[0] != byte(i+1) {
+			t.Fatalf("log %d out of order: %+v", i, l)
+		}
+	}
+
+	// pre 中有而 post 中没有的账户已被删除
+	deleted := common.HexToAddress("0x72")
+	state := StateOverride{deleted: {Balance: big.NewInt(5), StateDiff: map[common.Hash]common.Hash{{1}: {2}}}}
+	state.apply(&PrestateDiff{Pre: PrestateResult{deleted: {Balance: big.NewInt(5)}}, Post: PrestateResult{}})
+	if account := state[deleted]; account.Balance.Sign() != 0 || *account.Nonce != 0 || account.Code == nil ||
+		account.State == nil || len(account.State) != 0 {
+		t.Fatalf("deleted account not cleared %+v", account)
+	}
+}
@@ -0,0 +1,257 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 节点内置的 tracer
+const (
+	CallTracer     = "callTracer"
+	PrestateTracer = "prestateTracer"
+	FourByteTracer = "4byteTracer"
+)
+
+// TraceConfig debug_traceTransaction 的参数, Tracer 为内置 tracer 名称或 JS tracer 代码, 为空时使用 struct logger
+type TraceConfig struct {
+	Tracer string
+	// tracer 自身的配置, 例如 callTracer 的 {"onlyTopCall": true}
+	TracerConfig interface{}
+	// 节点执行 tracer 的超时时间, 0 表示使用节点默认值 (5s)
+	Timeout time.Duration
+	// 状态不在节点中时最多重新执行的区块数
+	Reexec *uint64
+}
+
+func (c TraceConfig) toArg() map[string]interface{} {
+	arg := map[string]interface{}{}
+	if c.Tracer != "" {
+		arg["tracer"] = c.Tracer
+	}
+	if c.TracerConfig != nil {
+		arg["tracerConfig"] = c.TracerConfig
+	}
+	if c.Timeout > 0 {
+		arg["timeout"] = c.Timeout.String()
+	}
+	if c.Reexec != nil {
+		arg["reexec"] = *c.Reexec
+	}
+	return arg
+}
+
+// CallFrame callTracer 的调用树
+type CallFrame struct {
+	Type    string
+	From    common.Address
+	To      common.Address
+	Value   *big.Int
+	Gas     uint64
+	GasUsed uint64
+	Input   []byte
+	Output  []byte
+	Error   string
+	Logs    []CallLog
+	Calls   []CallFrame
+}
+
+// CallLog callTracer 开启 withLog 时调用产生的日志
+type CallLog struct {
+	Address common.Address
+	Topics  []common.Hash
+	Data    []byte
+	// Position 日志之前当前调用已发起的子调用数, 用于和子调用的日志按执行顺序排列
+	Position uint
+}
+
+func (f *CallFrame) UnmarshalJSON(input []byte) error {
+	var dec struct {
+		Type    string          `json:"type"`
+		From    common.Address  `json:"from"`
+		To      common.Address  `json:"to"`
+		Value   *hexutil.Big    `json:"value"`
+		Gas     *hexutil.Uint64 `json:"gas"`
+		GasUsed *hexutil.Uint64 `json:"gasUsed"`
+		Input   hexutil.Bytes   `json:"input"`
+		Output  hexutil.Bytes   `json:"output"`
+		Error   string          `json:"error"`
+		Logs    []struct {
+			Address  common.Address `json:"address"`
+			Topics   []common.Hash  `json:"topics"`
+			Data     hexutil.Bytes  `json:"data"`
+			Position hexutil.Uint   `json:"position"`
+		} `json:"logs"`
+		Calls []CallFrame `json:"calls"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+
+	*f = CallFrame{
+		Type:   dec.Type,
+		From:   dec.From,
+		To:     dec.To,
+		Value:  (*big.Int)(dec.Value),
+		Input:  dec.Input,
+		Output: dec.Output,
+		Error:  dec.Error,
+		Calls:  dec.Calls,
+	}
+	if dec.Gas != nil {
+		f.Gas = uint64(*dec.Gas)
+	}
+	if dec.GasUsed != nil {
+		f.GasUsed = uint64(*dec.GasUsed)
+	}
+	for _, l := range dec.Logs {
+		f.Logs = append(f.Logs, CallLog{Address: l.Address, Topics: l.Topics, Data: l.Data, Position: uint(l.Position)})
+	}
+	return nil
+}
+
+// Revert 调用失败时解析 revert 数据, 调用成功时返回 nil
+func (f *CallFrame) Revert() *RevertError {
+	if f.Error == "" {
+		return nil
+	}
+	revertErr := DecodeRevert(f.Output)
+	revertErr.Message = f.Error
+	return revertErr
+}
+
+// AccountState prestateTracer 中的账户状态, diff 模式下未变化的字段为零值
+type AccountState struct {
+	Balance *big.Int
+	Nonce   uint64
+	Code    []byte
+	Storage map[common.Hash]common.Hash
+}
+
+func (s *AccountState) UnmarshalJSON(input []byte) error {
+	var dec struct {
+		Balance *hexutil.Big                `json:"balance"`
+		Nonce   uint64                      `json:"nonce"`
+		Code    hexutil.Bytes               `json:"code"`
+		Storage map[common.Hash]common.Hash `json:"storage"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+
+	*s = AccountState{
+		Balance: (*big.Int)(dec.Balance),
+		Nonce:   dec.Nonce,
+		Code:    dec.Code,
+		Storage: dec.Storage,
+	}
+	return nil
+}
+
+// PrestateResult 交易执行前涉及的账户状态
+type PrestateResult map[common.Address]*AccountState
+
+// PrestateDiff prestateTracer diffMode 的结果, 只包含交易修改过的账户和字段
+type PrestateDiff struct {
+	Pre  PrestateResult `json:"pre"`
+	Post PrestateResult `json:"post"`
+}
+
+// SelectorCount 4byteTracer 的结果, 相同 selector 不同 calldata 长度分开统计
+type SelectorCount struct {
+	Selector [4]byte
+	// 不包含 selector 的 calldata 长度
+	DataSize int
+	Count    int
+}
+
+// TraceTransactionWithConfig 使用指定 tracer 执行 debug_traceTransaction, 结果解析到 result
+func (e *Web3Client) TraceTransactionWithConfig(ctx context.Context, hashStr string, config TraceConfig, result interface{}) error {
+	var raw json.RawMessage
+	err := e.call(ctx, "debug_traceTransaction", func(ep *endpoint) error {
+		return ep.rpcClient.CallContext(ctx, &raw, "debug_traceTransaction", common.HexToHash(hashStr), config.toArg())
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(nullRaw(raw), result)
+}
+
+// TraceTransactionCalls callTracer 调用树, config.Tracer 会被忽略
+func (e *Web3Client) TraceTransactionCalls(ctx context.Context, hashStr string, config TraceConfig) (*CallFrame, error) {
+	config.Tracer = CallTracer
+	var frame *CallFrame
+	if err := e.TraceTransactionWithConfig(ctx, hashStr, config, &frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// TraceTransactionPrestate prestateTracer 交易执行前涉及的账户状态, config.Tracer 会被忽略
+func (e *Web3Client) TraceTransactionPrestate(ctx context.Context, hashStr string, config TraceConfig) (PrestateResult, error) {
+	config.Tracer = PrestateTracer
+	var result PrestateResult
+	if err := e.TraceTransactionWithConfig(ctx, hashStr, config, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TraceTransactionPrestateDiff prestateTracer diffMode 交易前后的状态变化, 需要节点支持 tracerConfig
+func (e *Web3Client) TraceTransactionPrestateDiff(ctx context.Context, hashStr string, config TraceConfig) (*PrestateDiff, error) {
+	config.Tracer = PrestateTracer
+	config.TracerConfig = map[string]interface{}{"diffMode": true}
+	var diff *PrestateDiff
+	if err := e.TraceTransactionWithConfig(ctx, hashStr, config, &diff); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// TraceTransactionFourByte 4byteTracer 各 selector 的调用次数, 按 selector 和 calldata 长度排序
+func (e *Web3Client) TraceTransactionFourByte(ctx context.Context, hashStr string, config TraceConfig) ([]SelectorCount, error) {
+	config.Tracer = FourByteTracer
+	var result map[string]int
+	if err := e.TraceTransactionWithConfig(ctx, hashStr, config, &result); err != nil {
+		return nil, err
+	}
+	return parseSelectorCounts(result)
+}
+
+// parseSelectorCounts 解析 "0x27dc297e-128": 1 格式的结果
+func parseSelectorCounts(result map[string]int) ([]SelectorCount, error) {
+	counts := make([]SelectorCount, 0, len(result))
+	for key, count := range result {
+		i := strings.LastIndex(key, "-")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid 4byte key %q", key)
+		}
+		selector, err := hexutil.Decode(key[:i])
+		if err != nil || len(selector) != 4 {
+			return nil, fmt.Errorf("invalid 4byte selector %q", key)
+		}
+		size, err := strconv.Atoi(key[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid 4byte size %q", key)
+		}
+
+		item := SelectorCount{DataSize: size, Count: count}
+		copy(item.Selector[:], selector)
+		counts = append(counts, item)
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if c := strings.Compare(string(counts[i].Selector[:]), string(counts[j].Selector[:])); c != 0 {
+			return c < 0
+		}
+		return counts[i].DataSize < counts[j].DataSize
+	})
+	return counts, nil
+}
@@ -0,0 +1,193 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testDebugService struct{}
+
+// testTokenAddress 的调用按 data 中的数量转出 from 的 token 余额, 余额保存在 slot common.BytesToHash(from), 默认 1000
+var testTokenAddress = common.HexToAddress("0x70")
+
+func (s *testDebugService) TraceTransaction(hash common.Hash, config map[string]interface{}) (json.RawMessage, error) {
+	if config["timeout"] != nil && config["timeout"] != "2s" {
+		return nil, errors.New("unexpected timeout")
+	}
+
+	switch config["tracer"] {
+	case CallTracer:
+		return json.RawMessage(`{"type":"CALL","from":"0x0000000000000000000000000000000000000001","to":"0x0000000000000000000000000000000000000002",` +
+			`"value":"0x10","gas":"0x186a0","gasUsed":"0x5208","input":"0xdead","output":"` + testRevertData + `","error":"execution reverted",` +
+			`"calls":[{"type":"STATICCALL","from":"0x0000000000000000000000000000000000000002","to":"0x0000000000000000000000000000000000000003","gas":"0x100","gasUsed":"0x10","input":"0x70a08231","output":"0x"}]}`), nil
+	case PrestateTracer:
+		if tracerConfig, ok := config["tracerConfig"].(map[string]interface{}); ok && tracerConfig["diffMode"] == true {
+			return json.RawMessage(`{"pre":{"0x0000000000000000000000000000000000000001":{"balance":"0x10","nonce":1}},` +
+				`"post":{"0x0000000000000000000000000000000000000001":{"balance":"0x5","nonce":2}}}`), nil
+		}
+		return json.RawMessage(`{"0x0000000000000000000000000000000000000002":{"balance":"0x0","nonce":0,"code":"0x6080",` +
+			`"storage":{"0x0000000000000000000000000000000000000000000000000000000000000001":"0x0000000000000000000000000000000000000000000000000000000000000002"}}}`), nil
+	case FourByteTracer:
+		return json.RawMessage(`{"0x70a08231-32":2,"0x27dc297e-128":1,"0x27dc297e-64":1}`), nil
+	}
+	return json.RawMessage(`{"gas":21000,"failed":false,"returnValue":"","structLogs":[]}`), nil
+}
+
+// TraceCall 内置 tracer 模拟转账: from 的余额 (默认 1000) 减去 value, data 为 0xdead 时 revert, 其他 tracer 返回请求参数
+func (s *testDebugService) TraceCall(args map[string]interface{}, block interface{}, config map[string]interface{}) (json.RawMessage, error) {
+	from, _ := args["from"].(string)
+	value := big.NewInt(0)
+	if str, ok := args["value"].(string); ok {
+		value = hexutil.MustDecodeBig(str)
+	}
+	balance := big.NewInt(1000)
+	overrides, _ := config["stateOverrides"].(map[string]interface{})
+	if account, ok := overrides[strings.ToLower(from)].(map[string]interface{}); ok {
+		if str, ok := account["balance"].(string); ok {
+			balance = hexutil.MustDecodeBig(str)
+		}
+	}
+
+	if to, _ := args["to"].(string); common.HexToAddress(to) == testTokenAddress {
+		return traceTokenTransfer(from, args, config)
+	}
+
+	switch config["tracer"] {
+	case CallTracer:
+		if data, _ := args["data"].(string); strings.HasPrefix(data, "0xdead") {
+			return json.Marshal(map[string]interface{}{"type": "CALL", "from": from, "gasUsed": "0x6000",
+				"output": testRevertData, "error": "execution reverted"})
+		}
+		if balance.Cmp(value) < 0 {
+			return nil, errors.New("insufficient funds for transfer")
+		}
+		return json.Marshal(map[string]interface{}{"type": "CALL", "from": from, "gasUsed": "0x5208",
+			"logs":  []map[string]interface{}{{"address": args["to"], "topics": []string{}, "data": "0x01"}},
+			"calls": []map[string]interface{}{{"type": "CALL", "error": "execution reverted", "logs": []map[string]interface{}{{"address": from}}}}})
+	case PrestateTracer:
+		pre := map[string]interface{}{from: map[string]interface{}{"balance": hexutil.EncodeBig(balance)}}
+		post := map[string]interface{}{from: map[string]interface{}{"balance": hexutil.EncodeBig(new(big.Int).Sub(balance, value))}}
+		// 收款账户不在覆盖状态中时视为新账户, 只出现在 post 中
+		if to, _ := args["to"].(string); to != "" && value.Sign() > 0 {
+			received := new(big.Int).Set(value)
+			if account, ok := overrides[strings.ToLower(to)].(map[string]interface{}); ok {
+				if str, ok := account["balance"].(string); ok {
+					pre[to] = map[string]interface{}{"balance": str}
+					received.Add(received, hexutil.MustDecodeBig(str))
+				}
+			}
+			post[to] = map[string]interface{}{"balance": hexutil.EncodeBig(received)}
+		}
+		return json.Marshal(map[string]interface{}{"pre": pre, "post": post})
+	}
+	return json.Marshal(map[string]interface{}{"block": block, "tracer": config["tracer"], "stateOverrides": config["stateOverrides"]})
+}
+
+// traceTokenTransfer 模拟 token 转账: 转账前后各有一条日志, 中间调用 0x71 产生一条日志, 余额不足时 revert
+func traceTokenTransfer(from string, args map[string]interface{}, config map[string]interface{}) (json.RawMessage, error) {
+	data, _ := args["data"].(string)
+	amount := new(big.Int).SetBytes(hexutil.MustDecode(data))
+	slot := common.BytesToHash(common.HexToAddress(from).Bytes())
+	balance := big.NewInt(1000)
+	if overrides, ok := config["stateOverrides"].(map[string]interface{}); ok {
+		if account, ok := overrides[strings.ToLower(testTokenAddress.Hex())].(map[string]interface{}); ok {
+			for _, field := range []string{"state", "stateDiff"} {
+				if storage, ok := account[field].(map[string]interface{}); ok {
+					if value, ok := storage[slot.Hex()].(string); ok {
+						balance = common.HexToHash(value).Big()
+					}
+				}
+			}
+		}
+	}
+
+	switch config["tracer"] {
+	case CallTracer:
+		if balance.Cmp(amount) < 0 {
+			return json.Marshal(map[string]interface{}{"type": "CALL", "from": from, "gasUsed": "0x6000",
+				"output": testRevertData, "error": "execution reverted"})
+		}
+		return json.Marshal(map[string]interface{}{"type": "CALL", "from": from, "gasUsed": "0x8000",
+			"logs": []map[string]interface{}{
+				{"address": testTokenAddress, "topics": []string{}, "data": "0x01", "position": "0x0"},
+				{"address": testTokenAddress, "topics": []string{}, "data": "0x03", "position": "0x1"},
+			},
+			"calls": []map[string]interface{}{{"type": "CALL", "to": common.HexToAddress("0x71"),
+				"logs": []map[string]interface{}{{"address": common.HexToAddress("0x71"), "topics": []string{}, "data": "0x02", "position": "0x0"}}}}})
+	case PrestateTracer:
+		post := map[string]interface{}{}
+		if remain := new(big.Int).Sub(balance, amount); remain.Sign() > 0 {
+			post[slot.Hex()] = common.BigToHash(remain)
+		}
+		return json.Marshal(map[string]interface{}{
+			"pre":  map[string]interface{}{testTokenAddress.Hex(): map[string]interface{}{"storage": map[string]interface{}{slot.Hex(): common.BigToHash(balance)}}},
+			"post": map[string]interface{}{testTokenAddress.Hex(): map[string]interface{}{"storage": post}},
+		})
+	}
+	return nil, errors.New("unsupported tracer")
+}
+
+func TestTraceTransaction(t *testing.T) {
+	ctx := context.Background()
+	node := newTestNode(t, 1, "1")
+	client, err := NewWeb3ClientWithOptions(ctx, node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := common.HexToHash("0x01").Hex()
+	config := TraceConfig{Timeout: 2 * time.Second}
+
+	frame, err := client.TraceTransactionCalls(ctx, hash, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Type != "CALL" || frame.Gas != 100000 || frame.GasUsed != 21000 || frame.Value.Int64() != 16 ||
+		len(frame.Calls) != 1 || frame.Calls[0].To != common.HexToAddress("0x03") || frame.Calls[0].Value != nil {
+		t.Fatalf("unexpected call frame %+v", frame)
+	}
+	if revertErr := frame.Revert(); revertErr == nil || revertErr.Reason != "insufficient output amount" {
+		t.Fatalf("unexpected revert %v", revertErr)
+	}
+	if frame.Calls[0].Revert() != nil {
+		t.Fatal("successful call should not revert")
+	}
+
+	prestate, err := client.TraceTransactionPrestate(ctx, hash, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := prestate[common.HexToAddress("0x02")]
+	if account == nil || len(account.Code) != 2 || account.Storage[common.HexToHash("0x01")] != common.HexToHash("0x02") {
+		t.Fatalf("unexpected prestate %+v", account)
+	}
+
+	diff, err := client.TraceTransactionPrestateDiff(ctx, hash, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post := diff.Post[common.HexToAddress("0x01")]; post == nil || post.Nonce != 2 || post.Balance.Int64() != 5 {
+		t.Fatalf("unexpected diff %+v", diff)
+	}
+
+	counts, err := client.TraceTransactionFourByte(ctx, hash, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 3 || counts[0].DataSize != 64 || counts[1].DataSize != 128 || counts[2].Count != 2 {
+		t.Fatalf("unexpected selector counts %+v", counts)
+	}
+
+	var custom struct {
+		Gas uint64 `json:"gas"`
+	}
+	if err := client.TraceTransactionWithConfig(ctx, hash, TraceConfig{}, &custom); err != nil || custom.Gas != 21000 {
+		t.Fatalf("unexpected struct log result %+v %v", custom, err)
+	}
+}
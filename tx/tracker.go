@@ -0,0 +1,297 @@
+package tx
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDropTimeout        = 5 * time.Minute
+	defaultTrackerBufferSize  = 100
+	defaultTrackerConcurrency = 8
+)
+
+// TxStatus 交易生命周期状态
+type TxStatus int
+
+const (
+	TxPending TxStatus = iota
+	TxMined
+	TxConfirmed
+	// TxReorged 打包交易的区块被重组, 交易回到 pending 状态继续跟踪
+	TxReorged
+	// TxDropped 交易在 DropTimeout 内一直不在节点中
+	TxDropped
+)
+
+func (s TxStatus) String() string {
+	switch s {
+	case TxPending:
+		return "pending"
+	case TxMined:
+		return "mined"
+	case TxConfirmed:
+		return "confirmed"
+	case TxReorged:
+		return "reorged"
+	case TxDropped:
+		return "dropped"
+	}
+	return "unknown"
+}
+
+// TxUpdate 交易状态变化
+type TxUpdate struct {
+	Hash              common.Hash
+	Status            TxStatus
+	BlockNumber       uint64
+	BlockHash         common.Hash
+	GasUsed           uint64
+	EffectiveGasPrice *big.Int
+	Success           bool
+	// 交易执行失败时重放得到的 revert 原因
+	Revert  *RevertError
+	Receipt *Receipt
+}
+
+// TrackerConfig 交易跟踪配置
+type TrackerConfig struct {
+	// 达到该确认数 (包含所在区块) 后交易状态为 confirmed 并停止跟踪, 小于等于 1 表示打包即确认
+	Confirmations uint64
+	PollInterval  time.Duration
+	DropTimeout   time.Duration
+	// 设置后状态变化通过回调通知, 否则通过 Updates() 返回的 chan 通知
+	OnUpdate   func(update TxUpdate)
+	BufferSize int
+	// 同时查询的交易数, 单个交易查询缓慢时不会阻塞其他交易
+	Concurrency int
+}
+
+type trackedTx struct {
+	hash     common.Hash
+	status   TxStatus
+	receipt  *Receipt
+	lastSeen time.Time
+}
+
+// TxTracker 跟踪交易 pending -> mined -> confirmed/reorged/dropped
+type TxTracker struct {
+	client  *Web3Client
+	config  TrackerConfig
+	mutex   sync.Mutex
+	txs     map[common.Hash]*trackedTx
+	updates chan TxUpdate
+	// 并发查询时保证 OnUpdate 不会被并发调用
+	notifyMutex sync.Mutex
+	stopCh      chan struct{}
+	stopOnce    sync.Once
+	wg          sync.WaitGroup
+}
+
+func (e *Web3Client) NewTxTracker(config TrackerConfig) *TxTracker {
+	if config.PollInterval <= 0 {
+		config.PollInterval = e.options.receiptPollInterval
+	}
+	if config.DropTimeout <= 0 {
+		config.DropTimeout = defaultDropTimeout
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultTrackerBufferSize
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaultTrackerConcurrency
+	}
+
+	tracker := &TxTracker{
+		client:  e,
+		config:  config,
+		txs:     make(map[common.Hash]*trackedTx),
+		updates: make(chan TxUpdate, config.BufferSize),
+		stopCh:  make(chan struct{}),
+	}
+
+	tracker.wg.Add(1)
+	go tracker.run()
+	return tracker
+}
+
+// Track 开始跟踪交易, 重复添加会被忽略
+func (t *TxTracker) Track(hashStr string) {
+	hash := common.HexToHash(hashStr)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, ok := t.txs[hash]; ok {
+		return
+	}
+	t.txs[hash] = &trackedTx{hash: hash, status: TxPending, lastSeen: time.Now()}
+}
+
+// Updates 未设置 OnUpdate 时通过该 chan 通知, Stop 后关闭
+func (t *TxTracker) Updates() <-chan TxUpdate {
+	return t.updates
+}
+
+// Stop 停止跟踪并关闭 Updates chan
+func (t *TxTracker) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopCh)
+		t.wg.Wait()
+		close(t.updates)
+	})
+}
+
+func (t *TxTracker) run() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		t.mutex.Lock()
+		txs := make([]*trackedTx, 0, len(t.txs))
+		for _, item := range t.txs {
+			txs = append(txs, item)
+		}
+		t.mutex.Unlock()
+
+		// 每轮等待所有查询结束, 同一交易不会被并发查询
+		sign := make(chan struct{}, t.config.Concurrency)
+		var wg sync.WaitGroup
+		for _, item := range txs {
+			sign <- struct{}{}
+			wg.Add(1)
+			go func(item *trackedTx) {
+				defer func() {
+					<-sign
+					wg.Done()
+				}()
+				ctx, cancel := context.WithTimeout(context.Background(), t.config.PollInterval)
+				defer cancel()
+				if err := t.poll(ctx, item); err != nil {
+					log.Printf("track tx %s error: %s", item.hash.Hex(), err.Error())
+				}
+			}(item)
+		}
+		wg.Wait()
+	}
+}
+
+func (t *TxTracker) poll(ctx context.Context, item *trackedTx) error {
+	if item.status == TxMined {
+		return t.pollMined(ctx, item)
+	}
+
+	receipt, err := t.client.TransactionReceipt(ctx, item.hash.Hex())
+	if errors.Is(err, ethereum.NotFound) {
+		return t.pollPending(ctx, item)
+	}
+	if err != nil {
+		return err
+	}
+
+	item.status = TxMined
+	item.receipt = receipt
+	update := t.newUpdate(item, TxMined)
+	if receipt.Status == types.ReceiptStatusFailed {
+		revertErr, err := t.client.replayRevert(ctx, receipt)
+		if err != nil {
+			log.Printf("get revert reason of %s error: %s", item.hash.Hex(), err.Error())
+		}
+		update.Revert = revertErr
+	}
+	t.notify(update)
+	return t.pollMined(ctx, item)
+}
+
+// pollPending 交易不在节点中超过 DropTimeout 视为 dropped
+func (t *TxTracker) pollPending(ctx context.Context, item *trackedTx) error {
+	_, _, err := t.client.transactionByHash(ctx, item.hash)
+	if err == nil {
+		item.lastSeen = time.Now()
+		return nil
+	}
+	if !errors.Is(err, ethereum.NotFound) {
+		return err
+	}
+
+	if time.Since(item.lastSeen) >= t.config.DropTimeout {
+		t.remove(item)
+		t.notify(t.newUpdate(item, TxDropped))
+	}
+	return nil
+}
+
+func (t *TxTracker) pollMined(ctx context.Context, item *trackedTx) error {
+	receipt, err := t.client.confirmedReceipt(ctx, item.hash.Hex(), t.config.Confirmations)
+	if errors.Is(err, ethereum.NotFound) || errors.Is(err, ErrReorged) {
+		update := t.newUpdate(item, TxReorged)
+		item.status = TxPending
+		item.receipt = nil
+		item.lastSeen = time.Now()
+		t.notify(update)
+		return nil
+	}
+	if err != nil || receipt == nil {
+		return err
+	}
+
+	if receipt.BlockHash != item.receipt.BlockHash {
+		// 重组后被打包进了另一个区块
+		item.receipt = receipt
+		t.notify(t.newUpdate(item, TxReorged))
+	}
+
+	t.remove(item)
+	t.notify(t.newUpdate(item, TxConfirmed))
+	return nil
+}
+
+func (t *TxTracker) remove(item *trackedTx) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.txs, item.hash)
+}
+
+func (t *TxTracker) newUpdate(item *trackedTx, status TxStatus) TxUpdate {
+	update := TxUpdate{
+		Hash:    item.hash,
+		Status:  status,
+		Receipt: item.receipt,
+	}
+	if receipt := item.receipt; receipt != nil {
+		update.BlockNumber = receipt.BlockNumber.Uint64()
+		update.BlockHash = receipt.BlockHash
+		update.GasUsed = receipt.GasUsed
+		update.EffectiveGasPrice = receipt.EffectiveGasPrice
+		update.Success = receipt.Status == types.ReceiptStatusSuccessful
+	}
+	return update
+}
+
+func (t *TxTracker) notify(update TxUpdate) {
+	t.notifyMutex.Lock()
+	defer t.notifyMutex.Unlock()
+	if t.config.OnUpdate != nil {
+		t.config.OnUpdate(update)
+		return
+	}
+
+	select {
+	case t.updates <- update:
+	case <-t.stopCh:
+	}
+}
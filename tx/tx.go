@@ -13,6 +13,15 @@ type TransactionInfo struct {
 	//WalletAddress string
 	PrivateKeyStr string
 	Value         *big.Int
+
+	// 交易类型, 默认 LegacyTx, TxTypeAuto 根据最新区块是否有 baseFee 自动选择
+	Type TxType
+	// EIP-1559 手续费, 为 nil 时自动计算
+	GasFeeCap  *big.Int
+	GasTipCap  *big.Int
+	AccessList types.AccessList
+	// SignNewTx 使用的 gas 上限, 为 0 时自动预估
+	GasLimit uint64
 }
 
 type RPCTransaction struct {
@@ -0,0 +1,233 @@
+package txtest
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+)
+
+// 测试合约暂时手工汇编: 构建环境拿不到 solc 和 Uniswap/OpenZeppelin 的编译产物,
+// 调用统一走 contract 包的 abigen 接口, 有了编译产物后应替换成 solc 生成的字节码并删除本文件
+//
+// assembler 生成测试合约字节码, 跳转目标统一用 PUSH2 占位, 最后回填
+type assembler struct {
+	code   []byte
+	labels map[string]int
+	fixups map[int]string
+}
+
+func newAssembler() *assembler {
+	return &assembler{
+		labels: make(map[string]int),
+		fixups: make(map[int]string),
+	}
+}
+
+func (a *assembler) op(ops ...vm.OpCode) *assembler {
+	for _, op := range ops {
+		a.code = append(a.code, byte(op))
+	}
+	return a
+}
+
+// push 压入整数或字节, 自动选择最短的 PUSHn
+func (a *assembler) push(value interface{}) *assembler {
+	var data []byte
+	switch v := value.(type) {
+	case int:
+		data = new(big.Int).SetInt64(int64(v)).Bytes()
+	case uint64:
+		data = new(big.Int).SetUint64(v).Bytes()
+	case *big.Int:
+		data = v.Bytes()
+	case common.Address:
+		data = v.Bytes()
+	case common.Hash:
+		data = v.Bytes()
+	case []byte:
+		data = v
+	default:
+		panic(fmt.Sprintf("unsupported push value %T", value))
+	}
+	if len(data) == 0 {
+		data = []byte{0}
+	}
+	if len(data) > 32 {
+		panic("push value exceeds 32 bytes")
+	}
+	a.code = append(a.code, byte(vm.PUSH1)+byte(len(data)-1))
+	a.code = append(a.code, data...)
+	return a
+}
+
+// pushWord 压入左对齐的 32 字节, 用于写入函数选择器
+func (a *assembler) pushWord(data []byte) *assembler {
+	return a.push(common.RightPadBytes(data, 32))
+}
+
+func (a *assembler) pushLabel(name string) *assembler {
+	a.code = append(a.code, byte(vm.PUSH2))
+	a.fixups[len(a.code)] = name
+	a.code = append(a.code, 0, 0)
+	return a
+}
+
+func (a *assembler) label(name string) *assembler {
+	a.mark(name)
+	return a.op(vm.JUMPDEST)
+}
+
+// mark 记录数据段位置, 不插入 JUMPDEST
+func (a *assembler) mark(name string) *assembler {
+	if _, ok := a.labels[name]; ok {
+		panic("duplicate label " + name)
+	}
+	a.labels[name] = len(a.code)
+	return a
+}
+
+func (a *assembler) jump(name string) *assembler {
+	return a.pushLabel(name).op(vm.JUMP)
+}
+
+func (a *assembler) jumpi(name string) *assembler {
+	return a.pushLabel(name).op(vm.JUMPI)
+}
+
+func (a *assembler) data(name string, data []byte) *assembler {
+	a.mark(name)
+	a.code = append(a.code, data...)
+	return a
+}
+
+// arg 读取第 index 个 32 字节调用参数
+func (a *assembler) arg(index int) *assembler {
+	return a.push(4 + 32*index).op(vm.CALLDATALOAD)
+}
+
+// mload 读取内存 offset 处的字
+func (a *assembler) mload(offset int) *assembler {
+	return a.push(offset).op(vm.MLOAD)
+}
+
+// mstore 把栈顶写入内存 offset
+func (a *assembler) mstore(offset int) *assembler {
+	return a.push(offset).op(vm.MSTORE)
+}
+
+// mappingSlot 计算 mapping(key => ...) 在 slot 的存储位置, key 取自内存 keyOffset, 结果留在栈顶
+func (a *assembler) mappingSlot(keyOffset int, slot int) *assembler {
+	a.mload(keyOffset).mstore(0)
+	a.push(slot).mstore(0x20)
+	return a.push(0x40).push(0).op(vm.KECCAK256)
+}
+
+// nestedMappingSlot 计算 mapping(a => mapping(b => ...)) 的存储位置
+func (a *assembler) nestedMappingSlot(outerOffset int, innerOffset int, slot int) *assembler {
+	a.mappingSlot(outerOffset, slot).mstore(0x20)
+	a.mload(innerOffset).mstore(0)
+	return a.push(0x40).push(0).op(vm.KECCAK256)
+}
+
+// returnTop 以 uint256 返回栈顶
+func (a *assembler) returnTop() *assembler {
+	a.mstore(0)
+	return a.push(0x20).push(0).op(vm.RETURN)
+}
+
+// returnData 返回编译期确定的数据
+func (a *assembler) returnData(data []byte) *assembler {
+	a.storeData(data)
+	return a.push(len(data)).push(0).op(vm.RETURN)
+}
+
+func (a *assembler) revertData(data []byte) *assembler {
+	a.storeData(data)
+	return a.push(len(data)).push(0).op(vm.REVERT)
+}
+
+// revertReason 以 Error(string) 格式回滚
+func (a *assembler) revertReason(reason string) *assembler {
+	return a.revertData(encodeRevert(reason))
+}
+
+func (a *assembler) storeData(data []byte) {
+	for offset := 0; offset < len(data); offset += 32 {
+		a.pushWord(data[offset:min(offset+32, len(data))]).mstore(offset)
+	}
+}
+
+// dispatch 按函数选择器跳转, 未匹配时回滚
+func (a *assembler) dispatch(functions ...string) *assembler {
+	a.push(0).op(vm.CALLDATALOAD).push(0xe0).op(vm.SHR)
+	for _, function := range functions {
+		a.op(vm.DUP1).push(selector(function)).op(vm.EQ).jumpi(function)
+	}
+	return a.push(0).op(vm.DUP1, vm.REVERT)
+}
+
+// bubbleRevert 外部调用失败时原样返回回滚数据
+func (a *assembler) bubbleRevert(name string) *assembler {
+	a.label(name)
+	a.op(vm.RETURNDATASIZE).push(0).push(0).op(vm.RETURNDATACOPY)
+	return a.op(vm.RETURNDATASIZE).push(0).op(vm.REVERT)
+}
+
+func (a *assembler) bytes() []byte {
+	code := make([]byte, len(a.code))
+	copy(code, a.code)
+	for pos, name := range a.fixups {
+		target, ok := a.labels[name]
+		if !ok {
+			panic("undefined label " + name)
+		}
+		code[pos] = byte(target >> 8)
+		code[pos+1] = byte(target)
+	}
+	return code
+}
+
+// initCode 生成部署代码: 先执行 constructor, 再把 runtime 复制到内存返回
+func initCode(constructor []byte, runtime []byte) []byte {
+	a := newAssembler()
+	a.code = append(a.code, constructor...)
+	// 尾部长度固定为 15 字节, runtime 紧跟其后
+	offset := len(a.code) + 15
+	a.code = append(a.code, byte(vm.PUSH2), byte(len(runtime)>>8), byte(len(runtime)))
+	a.code = append(a.code, byte(vm.PUSH2), byte(offset>>8), byte(offset))
+	a.code = append(a.code, byte(vm.PUSH1), 0, byte(vm.CODECOPY))
+	a.code = append(a.code, byte(vm.PUSH2), byte(len(runtime)>>8), byte(len(runtime)))
+	a.code = append(a.code, byte(vm.PUSH1), 0, byte(vm.RETURN))
+	return append(a.code, runtime...)
+}
+
+func selector(signature string) []byte {
+	return crypto.Keccak256([]byte(signature))[:4]
+}
+
+func eventTopic(signature string) common.Hash {
+	return crypto.Keccak256Hash([]byte(signature))
+}
+
+func encodeRevert(reason string) []byte {
+	stringType, _ := abi.NewType("string", "", nil)
+	data, _ := abi.Arguments{{Type: stringType}}.Pack(reason)
+	return append(selector("Error(string)"), data...)
+}
+
+// encodeString ABI 编码单个 string 返回值
+func encodeString(value string) []byte {
+	stringType, _ := abi.NewType("string", "", nil)
+	data, _ := abi.Arguments{{Type: stringType}}.Pack(value)
+	return data
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,118 @@
+package txtest
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"math/big"
+)
+
+// 测试 ERC20 的存储布局与 Solidity 一致, 便于用 tx.MappingSlot 计算余额位置
+const (
+	Erc20BalanceSlot   = 0
+	Erc20AllowanceSlot = 1
+	Erc20SupplySlot    = 2
+)
+
+var (
+	transferTopic = eventTopic("Transfer(address,address,uint256)")
+	approvalTopic = eventTopic("Approval(address,address,uint256)")
+)
+
+// erc20 内存布局: 0x80 from, 0xa0 to, 0xc0 amount
+const (
+	memFrom   = 0x80
+	memTo     = 0xa0
+	memAmount = 0xc0
+)
+
+// Erc20Code 返回测试 ERC20 的部署代码, 部署者获得全部初始发行量, 任何人都可以 mint
+func Erc20Code(name string, symbol string, decimals uint8, supply *big.Int) []byte {
+	ctor := newAssembler()
+	ctor.op(vm.CALLER).mstore(memTo)
+	ctor.push(supply).mstore(memAmount)
+	ctor.mload(memAmount).mappingSlot(memTo, Erc20BalanceSlot).op(vm.SSTORE)
+	ctor.mload(memAmount).push(Erc20SupplySlot).op(vm.SSTORE)
+	ctor.mload(memTo).push(0).push(transferTopic).push(0x20).push(memAmount).op(vm.LOG3)
+	return initCode(ctor.bytes(), erc20Runtime(name, symbol, decimals))
+}
+
+func erc20Runtime(name string, symbol string, decimals uint8) []byte {
+	a := newAssembler()
+	a.dispatch(
+		"name()", "symbol()", "decimals()", "totalSupply()", "balanceOf(address)",
+		"transfer(address,uint256)", "approve(address,uint256)", "allowance(address,address)",
+		"transferFrom(address,address,uint256)", "mint(address,uint256)",
+	)
+
+	a.label("name()").returnData(encodeString(name))
+	a.label("symbol()").returnData(encodeString(symbol))
+	a.label("decimals()").push(int(decimals)).returnTop()
+	a.label("totalSupply()").push(Erc20SupplySlot).op(vm.SLOAD).returnTop()
+
+	a.label("balanceOf(address)")
+	a.arg(0).mstore(memFrom)
+	a.mappingSlot(memFrom, Erc20BalanceSlot).op(vm.SLOAD).returnTop()
+
+	a.label("transfer(address,uint256)")
+	a.op(vm.CALLER).mstore(memFrom)
+	a.arg(0).mstore(memTo)
+	a.arg(1).mstore(memAmount)
+	erc20Transfer(a)
+	a.push(1).returnTop()
+
+	a.label("approve(address,uint256)")
+	a.op(vm.CALLER).mstore(memFrom)
+	a.arg(0).mstore(memTo)
+	a.arg(1).mstore(memAmount)
+	a.mload(memAmount).nestedMappingSlot(memFrom, memTo, Erc20AllowanceSlot).op(vm.SSTORE)
+	a.mload(memTo).mload(memFrom).push(approvalTopic).push(0x20).push(memAmount).op(vm.LOG3)
+	a.push(1).returnTop()
+
+	a.label("allowance(address,address)")
+	a.arg(0).mstore(memFrom)
+	a.arg(1).mstore(memTo)
+	a.nestedMappingSlot(memFrom, memTo, Erc20AllowanceSlot).op(vm.SLOAD).returnTop()
+
+	a.label("transferFrom(address,address,uint256)")
+	a.arg(0).mstore(memFrom)
+	a.op(vm.CALLER).mstore(memTo)
+	a.arg(2).mstore(memAmount)
+	// allowance[from][caller] -= amount
+	a.nestedMappingSlot(memFrom, memTo, Erc20AllowanceSlot)
+	a.op(vm.DUP1, vm.SLOAD).mload(memAmount)
+	a.op(vm.DUP2, vm.DUP2, vm.GT).jumpi("insufficientAllowance")
+	a.op(vm.SWAP1, vm.SUB, vm.SWAP1, vm.SSTORE)
+	a.arg(1).mstore(memTo)
+	erc20Transfer(a)
+	a.push(1).returnTop()
+
+	a.label("mint(address,uint256)")
+	a.arg(0).mstore(memTo)
+	a.arg(1).mstore(memAmount)
+	a.mappingSlot(memTo, Erc20BalanceSlot)
+	a.op(vm.DUP1, vm.SLOAD).mload(memAmount).op(vm.ADD, vm.SWAP1, vm.SSTORE)
+	a.push(Erc20SupplySlot).op(vm.SLOAD).mload(memAmount).op(vm.ADD).push(Erc20SupplySlot).op(vm.SSTORE)
+	a.mload(memTo).push(0).push(transferTopic).push(0x20).push(memAmount).op(vm.LOG3)
+	a.op(vm.STOP)
+
+	a.label("insufficientBalance").revertReason("ERC20: transfer amount exceeds balance")
+	a.label("insufficientAllowance").revertReason("ERC20: insufficient allowance")
+	return a.bytes()
+}
+
+// erc20Transfer 从内存读取 from to amount, 完成转账并记录 Transfer 事件
+func erc20Transfer(a *assembler) {
+	a.mappingSlot(memFrom, Erc20BalanceSlot)
+	a.op(vm.DUP1, vm.SLOAD).mload(memAmount)
+	a.op(vm.DUP2, vm.DUP2, vm.GT).jumpi("insufficientBalance")
+	a.op(vm.SWAP1, vm.SUB, vm.SWAP1, vm.SSTORE)
+
+	a.mappingSlot(memTo, Erc20BalanceSlot)
+	a.op(vm.DUP1, vm.SLOAD).mload(memAmount).op(vm.ADD, vm.SWAP1, vm.SSTORE)
+	a.mload(memTo).mload(memFrom).push(transferTopic).push(0x20).push(memAmount).op(vm.LOG3)
+}
+
+// Erc20BalanceKey 返回 owner 余额的存储位置
+func Erc20BalanceKey(owner common.Address) common.Hash {
+	return mappingKey(owner.Hash(), Erc20BalanceSlot)
+}
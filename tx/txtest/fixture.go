@@ -0,0 +1,457 @@
+package txtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// FixtureMode 录制或回放
+type FixtureMode int
+
+const (
+	// FixtureReplay 从 fixture 文件回放响应, 不访问节点
+	FixtureReplay FixtureMode = iota
+	// FixtureRecord 把请求转发给真实节点并记录, 测试结束时写入 fixture 文件
+	FixtureRecord
+)
+
+// FixtureError JSON-RPC 错误
+type FixtureError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// FixtureCall 一次 JSON-RPC 调用及其结果, batch 请求按单个调用分别记录
+type FixtureCall struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *FixtureError   `json:"error,omitempty"`
+}
+
+// FixtureMatcher 判断录制的调用 recorded 能否用于响应实际调用 actual
+type FixtureMatcher func(recorded FixtureCall, actual FixtureCall) bool
+
+// MatchMethod 只比较方法名
+func MatchMethod(recorded FixtureCall, actual FixtureCall) bool {
+	return recorded.Method == actual.Method
+}
+
+// MatchParams 比较方法名和参数, 参数按 JSON 语义比较, 忽略空白和字段顺序
+func MatchParams(recorded FixtureCall, actual FixtureCall) bool {
+	return recorded.Method == actual.Method && jsonEqual(recorded.Params, actual.Params)
+}
+
+// MatchParamsExcept 指定的方法只比较方法名, 其余方法比较参数, 适合参数中包含时间戳等易变字段的情况
+func MatchParamsExcept(methods ...string) FixtureMatcher {
+	return func(recorded FixtureCall, actual FixtureCall) bool {
+		for _, method := range methods {
+			if actual.Method == method {
+				return MatchMethod(recorded, actual)
+			}
+		}
+		return MatchParams(recorded, actual)
+	}
+}
+
+type fixtureOptions struct {
+	matcher    FixtureMatcher
+	strict     bool
+	sequential bool
+	upstream   http.RoundTripper
+}
+
+type FixtureOption func(*fixtureOptions)
+
+// WithMatcher 设置回放时的匹配规则, 默认 MatchParams
+func WithMatcher(matcher FixtureMatcher) FixtureOption {
+	return func(o *fixtureOptions) {
+		o.matcher = matcher
+	}
+}
+
+// WithStrict 严格模式: 没有匹配的调用, 重复使用已消费的调用以及测试结束时仍未使用的调用都会使测试失败
+func WithStrict() FixtureOption {
+	return func(o *fixtureOptions) {
+		o.strict = true
+	}
+}
+
+// WithSequential 按录制顺序回放, 实际调用必须与下一个未使用的调用匹配
+func WithSequential() FixtureOption {
+	return func(o *fixtureOptions) {
+		o.sequential = true
+	}
+}
+
+// WithUpstream 录制时实际发送请求的 RoundTripper, 默认 http.DefaultTransport
+func WithUpstream(upstream http.RoundTripper) FixtureOption {
+	return func(o *fixtureOptions) {
+		o.upstream = upstream
+	}
+}
+
+// FixtureTransport 录制 回放 JSON-RPC 的 http.RoundTripper, 通过 tx.WithHTTPClient(transport.Client()) 接入 Web3Client.
+// 只支持 HTTP, 不支持 WebSocket 订阅
+type FixtureTransport struct {
+	t       testing.TB
+	path    string
+	mode    FixtureMode
+	options *fixtureOptions
+
+	mutex sync.Mutex
+	calls []FixtureCall
+	used  []bool
+	next  int
+}
+
+// NewFixtureTransport 回放模式下立即加载 fixture 文件, 录制模式下测试结束时写入
+func NewFixtureTransport(t testing.TB, path string, mode FixtureMode, opts ...FixtureOption) *FixtureTransport {
+	t.Helper()
+
+	options := &fixtureOptions{
+		matcher:  MatchParams,
+		upstream: http.DefaultTransport,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	f := &FixtureTransport{
+		t:       t,
+		path:    path,
+		mode:    mode,
+		options: options,
+	}
+	switch mode {
+	case FixtureReplay:
+		calls, err := LoadFixture(path)
+		if err != nil {
+			t.Fatalf("load fixture: %v", err)
+		}
+		f.calls = calls
+		f.used = make([]bool, len(calls))
+		if options.strict {
+			t.Cleanup(f.verify)
+		}
+	case FixtureRecord:
+		t.Cleanup(func() {
+			if err := f.Save(); err != nil {
+				t.Errorf("save fixture: %v", err)
+			}
+		})
+	default:
+		t.Fatalf("unknown fixture mode %d", mode)
+	}
+	return f
+}
+
+// LoadFixture 读取 fixture 文件
+func LoadFixture(path string) ([]FixtureCall, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var calls []FixtureCall
+	if err := json.Unmarshal(data, &calls); err != nil {
+		return nil, fmt.Errorf("decode fixture %s: %w", path, err)
+	}
+	return calls, nil
+}
+
+// Client 返回使用该 transport 的 http.Client
+func (f *FixtureTransport) Client() *http.Client {
+	return &http.Client{Transport: f}
+}
+
+// Calls 返回已录制 (或已加载) 的调用
+func (f *FixtureTransport) Calls() []FixtureCall {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	calls := make([]FixtureCall, len(f.calls))
+	copy(calls, f.calls)
+	return calls
+}
+
+// Unused 返回回放模式下尚未被使用的调用
+func (f *FixtureTransport) Unused() []FixtureCall {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var unused []FixtureCall
+	for i, call := range f.calls {
+		if !f.used[i] {
+			unused = append(unused, call)
+		}
+	}
+	return unused
+}
+
+// Save 把录制的调用写入 fixture 文件, 测试结束时自动调用
+func (f *FixtureTransport) Save() error {
+	if f.mode != FixtureRecord {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(f.Calls(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.path, append(data, '\n'), 0644)
+}
+
+func (f *FixtureTransport) verify() {
+	for _, call := range f.Unused() {
+		f.t.Errorf("fixture call %s %s was never made", call.Method, call.Params)
+	}
+}
+
+// jsonrpcMessage JSON-RPC 请求或响应
+type jsonrpcMessage struct {
+	Version string          `json:"jsonrpc,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *FixtureError   `json:"error,omitempty"`
+}
+
+func (f *FixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if f.mode == FixtureRecord {
+		return f.record(req, body)
+	}
+	return f.replay(req, body)
+}
+
+func (f *FixtureTransport) record(req *http.Request, body []byte) (*http.Response, error) {
+	upstreamReq := req.Clone(req.Context())
+	upstreamReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	upstreamReq.ContentLength = int64(len(body))
+
+	resp, err := f.options.upstream.RoundTrip(upstreamReq)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	// 非 200 响应 (限流 鉴权失败等) 不是 JSON-RPC 结果, 不录制
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	requests, _, err := decodeMessages(body)
+	if err != nil {
+		return resp, nil
+	}
+	responses, _, err := decodeMessages(respBody)
+	if err != nil {
+		return resp, nil
+	}
+	byId := make(map[string]*jsonrpcMessage, len(responses))
+	for _, response := range responses {
+		byId[string(response.ID)] = response
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, request := range requests {
+		response, ok := byId[string(request.ID)]
+		if !ok {
+			continue
+		}
+		call := FixtureCall{
+			Method: request.Method,
+			Params: compactJson(request.Params),
+			Result: response.Result,
+			Error:  response.Error,
+		}
+		if call.Error == nil && len(call.Result) == 0 {
+			call.Result = json.RawMessage("null")
+		}
+		f.calls = append(f.calls, call)
+	}
+	return resp, nil
+}
+
+func (f *FixtureTransport) replay(req *http.Request, body []byte) (*http.Response, error) {
+	requests, batch, err := decodeMessages(body)
+	if err != nil {
+		return nil, fmt.Errorf("decode JSON-RPC request: %w", err)
+	}
+
+	responses := make([]*jsonrpcMessage, 0, len(requests))
+	for _, request := range requests {
+		// 没有 id 的是通知, 不需要响应
+		if len(request.ID) == 0 {
+			continue
+		}
+		response := &jsonrpcMessage{Version: "2.0", ID: request.ID}
+		call, err := f.match(FixtureCall{Method: request.Method, Params: compactJson(request.Params)})
+		if err != nil {
+			response.Error = &FixtureError{Code: -32601, Message: err.Error()}
+		} else {
+			response.Result = call.Result
+			response.Error = call.Error
+			if response.Error == nil && len(response.Result) == 0 {
+				response.Result = json.RawMessage("null")
+			}
+		}
+		responses = append(responses, response)
+	}
+
+	var respBody []byte
+	if batch {
+		respBody, err = json.Marshal(responses)
+	} else if len(responses) > 0 {
+		respBody, err = json.Marshal(responses[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+// match 查找第一个未使用的匹配调用. 非严格模式下匹配的调用都已使用时重复使用最后一个, 便于轮询类请求
+func (f *FixtureTransport) match(actual FixtureCall) (FixtureCall, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.options.sequential {
+		for f.next < len(f.calls) && f.used[f.next] {
+			f.next++
+		}
+		if f.next < len(f.calls) && f.options.matcher(f.calls[f.next], actual) {
+			f.used[f.next] = true
+			return f.calls[f.next], nil
+		}
+		return FixtureCall{}, f.unexpected(actual)
+	}
+
+	last := -1
+	for i, call := range f.calls {
+		if !f.options.matcher(call, actual) {
+			continue
+		}
+		if !f.used[i] {
+			f.used[i] = true
+			return call, nil
+		}
+		last = i
+	}
+	if last >= 0 && !f.options.strict {
+		return f.calls[last], nil
+	}
+	return FixtureCall{}, f.unexpected(actual)
+}
+
+func (f *FixtureTransport) unexpected(actual FixtureCall) error {
+	err := fmt.Errorf("txtest: no fixture for %s %s", actual.Method, actual.Params)
+	if f.options.strict {
+		f.t.Errorf("unexpected JSON-RPC call %s %s", actual.Method, actual.Params)
+	}
+	return err
+}
+
+// decodeMessages 解析单个或 batch 的 JSON-RPC 消息
+func decodeMessages(data []byte) ([]*jsonrpcMessage, bool, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, false, errors.New("empty body")
+	}
+	if data[0] == '[' {
+		var messages []*jsonrpcMessage
+		err := json.Unmarshal(data, &messages)
+		return messages, true, err
+	}
+	var message jsonrpcMessage
+	err := json.Unmarshal(data, &message)
+	return []*jsonrpcMessage{&message}, false, err
+}
+
+func compactJson(data json.RawMessage) json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return data
+	}
+	// 没有参数和空数组等价
+	if buf.String() == "[]" || buf.String() == "null" {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+func jsonEqual(a json.RawMessage, b json.RawMessage) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	return reflect.DeepEqual(normalizeJson(va), normalizeJson(vb))
+}
+
+// normalizeJson 十六进制字符串不区分大小写, 地址的校验和格式不影响匹配
+func normalizeJson(v interface{}) interface{} {
+	switch value := v.(type) {
+	case string:
+		if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+			return strings.ToLower(value)
+		}
+		return value
+	case []interface{}:
+		for i := range value {
+			value[i] = normalizeJson(value[i])
+		}
+		return value
+	case map[string]interface{}:
+		for key := range value {
+			value[key] = normalizeJson(value[key])
+		}
+		return value
+	}
+	return v
+}
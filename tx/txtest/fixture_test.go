@@ -0,0 +1,163 @@
+package txtest
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeT 收集 Errorf, 用于验证严格模式会使测试失败
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func recordFixture(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	sim := NewSimChain(t)
+	recorder := NewFixtureTransport(t, path, FixtureRecord)
+	client, err := rpc.DialHTTPWithClient(sim.URL, recorder.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var chainId hexutil.Big
+	if err := client.Call(&chainId, "eth_chainId"); err != nil {
+		t.Fatal(err)
+	}
+	batch := []rpc.BatchElem{
+		{Method: "eth_getBalance", Args: []interface{}{sim.Accounts[0].Address, "latest"}, Result: new(hexutil.Big)},
+		{Method: "eth_getBalance", Args: []interface{}{sim.Accounts[1].Address, "latest"}, Result: new(hexutil.Big)},
+		{Method: "eth_getCode", Args: []interface{}{sim.Accounts[0].Address, "latest"}, Result: new(hexutil.Bytes)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(nil, "eth_getTransactionByHash", "0x01"); err == nil {
+		t.Fatal("expected error for malformed hash")
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if calls := recorder.Calls(); len(calls) != 5 {
+		t.Fatalf("recorded %d calls, want 5", len(calls))
+	}
+	sim.Close()
+	return path
+}
+
+func TestFixtureRecordReplay(t *testing.T) {
+	path := recordFixture(t)
+	account0, account1 := NewAccount(0).Address, NewAccount(1).Address
+
+	replayer := NewFixtureTransport(t, path, FixtureReplay, WithStrict())
+	client, err := rpc.DialHTTPWithClient("http://fixture.invalid", replayer.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// 回放时 batch 拆分和顺序可以与录制时不同
+	var balance1 hexutil.Big
+	if err := client.Call(&balance1, "eth_getBalance", strings.ToLower(account1.Hex()), "latest"); err != nil {
+		t.Fatal(err)
+	}
+	var chainId hexutil.Big
+	var balance0 hexutil.Big
+	var code hexutil.Bytes
+	batch := []rpc.BatchElem{
+		{Method: "eth_getBalance", Args: []interface{}{account0, "latest"}, Result: &balance0},
+		{Method: "eth_chainId", Result: &chainId},
+		{Method: "eth_getCode", Args: []interface{}{account0, "latest"}, Result: &code},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	for _, elem := range batch {
+		if elem.Error != nil {
+			t.Fatalf("%s: %v", elem.Method, elem.Error)
+		}
+	}
+	if chainId.ToInt().Cmp(SimChainId) != 0 {
+		t.Fatalf("chain id %s, want %s", chainId.ToInt(), SimChainId)
+	}
+	if balance0.ToInt().Sign() == 0 || balance0.ToInt().Cmp(balance1.ToInt()) != 0 {
+		t.Fatalf("unexpected balances %s %s", balance0.ToInt(), balance1.ToInt())
+	}
+	if len(code) != 0 {
+		t.Fatalf("unexpected code %x", code)
+	}
+	if err := client.Call(nil, "eth_getTransactionByHash", "0x01"); err == nil {
+		t.Fatal("expected recorded error")
+	}
+	if unused := replayer.Unused(); len(unused) != 0 {
+		t.Fatalf("unused calls %v", unused)
+	}
+}
+
+func TestFixtureStrict(t *testing.T) {
+	path := recordFixture(t)
+
+	ft := &fakeT{TB: t}
+	replayer := NewFixtureTransport(ft, path, FixtureReplay, WithStrict(), WithMatcher(MatchMethod))
+	client, err := rpc.DialHTTPWithClient("http://fixture.invalid", replayer.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.Call(nil, "eth_blockNumber"); err == nil {
+		t.Fatal("expected error for unexpected call")
+	}
+	var chainId hexutil.Big
+	if err := client.Call(&chainId, "eth_chainId"); err != nil {
+		t.Fatal(err)
+	}
+	// 严格模式下不重复使用已消费的调用
+	if err := client.Call(&chainId, "eth_chainId"); err == nil {
+		t.Fatal("expected error for repeated call")
+	}
+	if len(ft.errors) != 2 {
+		t.Fatalf("got %d errors, want 2: %v", len(ft.errors), ft.errors)
+	}
+
+	// 未使用的调用在测试结束时报告
+	replayer.verify()
+	if len(ft.errors) != 2+4 {
+		t.Fatalf("got %d errors, want 6: %v", len(ft.errors), ft.errors)
+	}
+}
+
+func TestFixtureNonStrict(t *testing.T) {
+	path := recordFixture(t)
+
+	replayer := NewFixtureTransport(t, path, FixtureReplay, WithMatcher(MatchParamsExcept("eth_getBalance")))
+	client, err := rpc.DialHTTPWithClient("http://fixture.invalid", replayer.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// 非严格模式下重复调用复用最后一个匹配的结果
+	for i := 0; i < 3; i++ {
+		var chainId hexutil.Big
+		if err := client.Call(&chainId, "eth_chainId"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var balance hexutil.Big
+	if err := client.Call(&balance, "eth_getBalance", NewAccount(2).Address, "0x10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(nil, "eth_blockNumber"); err == nil || !strings.Contains(err.Error(), "no fixture") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package txtest
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/snail-plus/eth-pkg/contract"
+	"math/big"
+	"strings"
+)
+
+var (
+	erc20Abi          = mustParseAbi(contract.Erc20ABI)
+	uniswapPairAbi    = mustParseAbi(contract.UniswapPairABI)
+	uniswapFactoryAbi = mustParseAbi(contract.UniswapFactoryABI)
+)
+
+func mustParseAbi(abiStr string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(abiStr))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// DeployErc20 部署测试 ERC20, 初始发行量归 from 所有
+func (s *SimChain) DeployErc20(from *Account, name string, symbol string, decimals uint8, supply *big.Int) common.Address {
+	s.t.Helper()
+	return s.Deploy(from, Erc20Code(name, symbol, decimals, supply))
+}
+
+// Erc20Transfer 调用 token.transfer
+func (s *SimChain) Erc20Transfer(from *Account, token common.Address, to common.Address, amount *big.Int) {
+	s.t.Helper()
+	s.Transact(from, &token, s.pack(erc20Abi, "transfer", to, amount), nil)
+}
+
+// Erc20Approve 调用 token.approve
+func (s *SimChain) Erc20Approve(from *Account, token common.Address, spender common.Address, amount *big.Int) {
+	s.t.Helper()
+	s.Transact(from, &token, s.pack(erc20Abi, "approve", spender, amount), nil)
+}
+
+// Erc20BalanceOf 查询最新区块的代币余额
+func (s *SimChain) Erc20BalanceOf(token common.Address, owner common.Address) *big.Int {
+	s.t.Helper()
+	var balance *big.Int
+	s.call(erc20Abi, token, &balance, "balanceOf", owner)
+	return balance
+}
+
+// Uniswap 部署在本地链上的 UniswapV2 工厂和路由
+type Uniswap struct {
+	Factory common.Address
+	Router  common.Address
+
+	chain *SimChain
+}
+
+// DeployUniswap 部署工厂和路由
+func (s *SimChain) DeployUniswap(from *Account) *Uniswap {
+	s.t.Helper()
+	factory := s.Deploy(from, UniswapFactoryCode())
+	return &Uniswap{
+		Factory: factory,
+		Router:  s.Deploy(from, UniswapRouterCode(factory)),
+		chain:   s,
+	}
+}
+
+// CreatePair 创建交易对, 已存在时直接返回
+func (u *Uniswap) CreatePair(from *Account, tokenA common.Address, tokenB common.Address) common.Address {
+	u.chain.t.Helper()
+	if pair := u.GetPair(tokenA, tokenB); pair != (common.Address{}) {
+		return pair
+	}
+	u.chain.Transact(from, &u.Factory, u.chain.pack(uniswapFactoryAbi, "createPair", tokenA, tokenB), nil)
+	return u.GetPair(tokenA, tokenB)
+}
+
+// GetPair 查询交易对地址, 不存在时返回零地址
+func (u *Uniswap) GetPair(tokenA common.Address, tokenB common.Address) common.Address {
+	u.chain.t.Helper()
+	var pair common.Address
+	u.chain.call(uniswapFactoryAbi, u.Factory, &pair, "getPair", tokenA, tokenB)
+	return pair
+}
+
+// AddLiquidity 把两种代币转入交易对并同步储备量, 交易对不存在时先创建
+func (u *Uniswap) AddLiquidity(from *Account, tokenA common.Address, amountA *big.Int, tokenB common.Address, amountB *big.Int) common.Address {
+	u.chain.t.Helper()
+	pair := u.CreatePair(from, tokenA, tokenB)
+	u.chain.Erc20Transfer(from, tokenA, pair, amountA)
+	u.chain.Erc20Transfer(from, tokenB, pair, amountB)
+	u.chain.Transact(from, &pair, u.chain.pack(uniswapPairAbi, "sync"), nil)
+	return pair
+}
+
+// GetReserves 查询交易对储备量, 按 token0 token1 顺序返回
+func (u *Uniswap) GetReserves(pair common.Address) (*big.Int, *big.Int) {
+	u.chain.t.Helper()
+	output := u.chain.callOutput(uniswapPairAbi, pair, "getReserves")
+	return output[0].(*big.Int), output[1].(*big.Int)
+}
+
+func (s *SimChain) pack(contractAbi abi.ABI, method string, args ...interface{}) []byte {
+	s.t.Helper()
+	data, err := contractAbi.Pack(method, args...)
+	if err != nil {
+		s.t.Fatalf("pack %s: %v", method, err)
+	}
+	return data
+}
+
+func (s *SimChain) call(contractAbi abi.ABI, to common.Address, result interface{}, method string, args ...interface{}) {
+	s.t.Helper()
+	if err := contractAbi.UnpackIntoInterface(result, method, s.rawCall(contractAbi, to, method, args...)); err != nil {
+		s.t.Fatalf("unpack %s: %v", method, err)
+	}
+}
+
+func (s *SimChain) callOutput(contractAbi abi.ABI, to common.Address, method string, args ...interface{}) []interface{} {
+	s.t.Helper()
+	output, err := contractAbi.Unpack(method, s.rawCall(contractAbi, to, method, args...))
+	if err != nil {
+		s.t.Fatalf("unpack %s: %v", method, err)
+	}
+	return output
+}
+
+func (s *SimChain) rawCall(contractAbi abi.ABI, to common.Address, method string, args ...interface{}) []byte {
+	s.t.Helper()
+	data, err := s.backend.CallContract(context.Background(), ethereum.CallMsg{To: &to, Data: s.pack(contractAbi, method, args...)}, nil)
+	if err != nil {
+		s.t.Fatalf("call %s: %v", method, err)
+	}
+	return data
+}
@@ -0,0 +1,931 @@
+package txtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/filters"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode"
+)
+
+var subscriptionType = reflect.TypeOf((*rpc.Subscription)(nil))
+
+// MockHandler 处理一次 JSON-RPC 调用, params 为未解码的参数数组. 返回 MockError 可以指定错误码
+type MockHandler func(ctx context.Context, params []json.RawMessage) (interface{}, error)
+
+// MockResponse 脚本化的一次性响应, 按顺序消费, 优先于 SetError 和 Handle
+type MockResponse struct {
+	Result interface{}
+	Err    error
+	// 在 SetLatency 的基础上额外的延迟
+	Latency time.Duration
+}
+
+// MockError 带错误码和 data 的 JSON-RPC 错误, 其他 error 以 -32000 返回
+type MockError struct {
+	Code    int
+	Message string
+	Data    interface{}
+}
+
+func (e *MockError) Error() string {
+	return e.Message
+}
+
+func (e *MockError) ErrorCode() int {
+	return e.Code
+}
+
+func (e *MockError) ErrorData() interface{} {
+	return e.Data
+}
+
+// MockCall 节点收到的一次调用
+type MockCall struct {
+	Method string
+	Params json.RawMessage
+}
+
+const (
+	mockLogs                   = "logs"
+	mockNewHeads               = "newHeads"
+	mockNewPendingTransactions = "newPendingTransactions"
+)
+
+// mockFilter eth_newFilter 等安装的轮询 filter
+type mockFilter struct {
+	kind     string
+	criteria filters.FilterCriteria
+	hashes   []common.Hash
+	logs     []types.Log
+}
+
+// mockSubscription eth_subscribe 的订阅, 订阅响应发出后才开始推送
+type mockSubscription struct {
+	id       string
+	kind     string
+	criteria filters.FilterCriteria
+	conn     *mockConn
+	active   bool
+}
+
+type mockConn struct {
+	ws    *websocket.Conn
+	mutex sync.Mutex
+}
+
+func (c *mockConn) write(v interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.ws.WriteJSON(v)
+}
+
+type mockConnKey struct{}
+
+// MockNode 可编程的 JSON-RPC 节点, 通过 HTTP 和 WebSocket 提供 eth_* txpool_* parity_* 等方法.
+// 内置的方法维护 pending 交易池 日志 filter 和订阅, 其他方法 (例如 debug_*) 通过 Register Handle SetResult 或 Script 提供.
+// SimChain 以及各个包测试中的固定响应服务都通过 MockNode 对外提供, 共用同一套错误注入 延迟和调用记录
+type MockNode struct {
+	// HTTP JSON-RPC 地址
+	URL string
+	// WebSocket JSON-RPC 地址, 支持 eth_subscribe
+	WSURL string
+
+	t          testing.TB
+	httpServer *httptest.Server
+	upgrader   websocket.Upgrader
+
+	mutex         sync.Mutex
+	chainId       *big.Int
+	blockNumber   uint64
+	handlers      map[string]MockHandler
+	scripts       map[string][]MockResponse
+	errors        map[string]error
+	latency       map[string]time.Duration
+	calls         []MockCall
+	pending       []*types.Transaction
+	logs          []types.Log
+	filters       map[string]*mockFilter
+	subscriptions map[string]*mockSubscription
+	conns         map[*mockConn]struct{}
+	nextId        uint64
+	closed        bool
+
+	// Register 注册的服务, 通过进程内连接调用
+	server  *rpc.Server
+	backend *rpc.Client
+	// 收到的 HTTP 请求和 WebSocket 消息数, batch 计为一次
+	requests int64
+}
+
+// NewMockNode 启动 mock 节点, chainId 默认与 SimChainId 相同, 测试结束时自动关闭
+func NewMockNode(t testing.TB) *MockNode {
+	n := &MockNode{
+		t:             t,
+		upgrader:      websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }},
+		chainId:       new(big.Int).Set(SimChainId),
+		scripts:       make(map[string][]MockResponse),
+		errors:        make(map[string]error),
+		latency:       make(map[string]time.Duration),
+		filters:       make(map[string]*mockFilter),
+		subscriptions: make(map[string]*mockSubscription),
+		conns:         make(map[*mockConn]struct{}),
+	}
+	n.handlers = map[string]MockHandler{
+		"eth_chainId":                     n.ethChainId,
+		"net_version":                     n.netVersion,
+		"web3_clientVersion":              n.web3ClientVersion,
+		"eth_blockNumber":                 n.ethBlockNumber,
+		"eth_gasPrice":                    n.ethGasPrice,
+		"eth_maxPriorityFeePerGas":        n.ethGasPrice,
+		"eth_sendRawTransaction":          n.ethSendRawTransaction,
+		"eth_getTransactionByHash":        n.ethGetTransactionByHash,
+		"eth_getLogs":                     n.ethGetLogs,
+		"eth_newFilter":                   n.ethNewFilter,
+		"eth_newPendingTransactionFilter": n.ethNewPendingTransactionFilter,
+		"eth_newBlockFilter":              n.ethNewBlockFilter,
+		"eth_getFilterChanges":            n.ethGetFilterChanges,
+		"eth_uninstallFilter":             n.ethUninstallFilter,
+		"eth_subscribe":                   n.ethSubscribe,
+		"eth_unsubscribe":                 n.ethUnsubscribe,
+		"txpool_content":                  n.txPoolContent,
+		"txpool_status":                   n.txPoolStatus,
+		"parity_allTransactions":          n.parityAllTransactions,
+		"parity_pendingTransactions":      n.parityAllTransactions,
+	}
+
+	n.httpServer = httptest.NewServer(http.HandlerFunc(n.serveHTTP))
+	n.URL = n.httpServer.URL
+	n.WSURL = "ws" + strings.TrimPrefix(n.httpServer.URL, "http")
+	t.Cleanup(n.Close)
+	return n
+}
+
+// Close 关闭所有连接和 HTTP 服务, 可重复调用
+func (n *MockNode) Close() {
+	n.mutex.Lock()
+	if n.closed {
+		n.mutex.Unlock()
+		return
+	}
+	n.closed = true
+	n.mutex.Unlock()
+
+	n.DropConnections()
+	n.httpServer.CloseClientConnections()
+	n.httpServer.Close()
+	if n.server != nil {
+		n.backend.Close()
+		n.server.Stop()
+	}
+}
+
+// Register 把 service 的导出方法注册为 namespace_method, 规则与 go-ethereum rpc.Server 相同,
+// 覆盖同名的内置方法. 订阅方法不会注册, eth_subscribe 始终由 MockNode 处理
+func (n *MockNode) Register(namespace string, service interface{}) error {
+	n.mutex.Lock()
+	if n.server == nil {
+		n.server = rpc.NewServer()
+		n.backend = rpc.DialInProc(n.server)
+	}
+	server := n.server
+	n.mutex.Unlock()
+
+	if err := server.RegisterName(namespace, service); err != nil {
+		return err
+	}
+	serviceType := reflect.TypeOf(service)
+	for i := 0; i < serviceType.NumMethod(); i++ {
+		method := serviceType.Method(i)
+		if method.Type.NumOut() > 0 && method.Type.Out(0) == subscriptionType {
+			continue
+		}
+		name := []rune(method.Name)
+		name[0] = unicode.ToLower(name[0])
+		n.Handle(namespace+"_"+string(name), n.forward(namespace+"_"+string(name)))
+	}
+	return nil
+}
+
+// forward 通过进程内连接调用 Register 注册的方法, 保留错误码和错误数据
+func (n *MockNode) forward(method string) MockHandler {
+	return func(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+		args := make([]interface{}, len(params))
+		for i, param := range params {
+			args[i] = param
+		}
+		var result json.RawMessage
+		if err := n.backend.CallContext(ctx, &result, method, args...); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+}
+
+// Requests 返回收到的 HTTP 请求和 WebSocket 消息数, 一个 batch 计为一次
+func (n *MockNode) Requests() int64 {
+	return atomic.LoadInt64(&n.requests)
+}
+
+// Handle 设置方法的处理函数, 覆盖内置实现, handler 为 nil 时该方法不存在
+func (n *MockNode) Handle(method string, handler MockHandler) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if handler == nil {
+		delete(n.handlers, method)
+		return
+	}
+	n.handlers[method] = handler
+}
+
+// SetResult 方法始终返回 result, result 为 json.RawMessage 时原样输出
+func (n *MockNode) SetResult(method string, result interface{}) {
+	n.Handle(method, func(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+		return result, nil
+	})
+}
+
+// SetError 方法始终返回 err, err 为 nil 时恢复正常处理
+func (n *MockNode) SetError(method string, err error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if err == nil {
+		delete(n.errors, method)
+		return
+	}
+	n.errors[method] = err
+}
+
+// SetLatency 方法响应前的延迟, method 为空时作用于没有单独设置的所有方法
+func (n *MockNode) SetLatency(method string, latency time.Duration) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.latency[method] = latency
+}
+
+// Script 追加一次性响应, 用完后恢复正常处理
+func (n *MockNode) Script(method string, responses ...MockResponse) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.scripts[method] = append(n.scripts[method], responses...)
+}
+
+// SetChainId 修改 eth_chainId 和 net_version 的返回值
+func (n *MockNode) SetChainId(chainId *big.Int) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.chainId = new(big.Int).Set(chainId)
+}
+
+// SetBlockNumber 修改 eth_blockNumber 的返回值, 也是 eth_getLogs 中 latest 对应的区块
+func (n *MockNode) SetBlockNumber(number uint64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.blockNumber = number
+}
+
+// Calls 返回收到的调用, method 为空时返回全部
+func (n *MockNode) Calls(method string) []MockCall {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	var calls []MockCall
+	for _, call := range n.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// CallCount 返回方法被调用的次数
+func (n *MockNode) CallCount(method string) int {
+	return len(n.Calls(method))
+}
+
+// AddPendingTransactions 把交易加入交易池, 推送给 pending filter 和 newPendingTransactions 订阅
+func (n *MockNode) AddPendingTransactions(txs ...*types.Transaction) {
+	n.mutex.Lock()
+	n.pending = append(n.pending, txs...)
+	for _, filter := range n.filters {
+		if filter.kind == mockNewPendingTransactions {
+			for _, tx := range txs {
+				filter.hashes = append(filter.hashes, tx.Hash())
+			}
+		}
+	}
+	subscriptions := n.activeSubscriptions(mockNewPendingTransactions)
+	n.mutex.Unlock()
+
+	for _, sub := range subscriptions {
+		for _, tx := range txs {
+			n.notify(sub, tx.Hash())
+		}
+	}
+}
+
+// RemovePendingTransaction 从交易池移除交易, 之后 eth_getTransactionByHash 返回 null
+func (n *MockNode) RemovePendingTransaction(hash common.Hash) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for i, tx := range n.pending {
+		if tx.Hash() == hash {
+			n.pending = append(n.pending[:i:i], n.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// EmitLogs 推送日志给匹配的 log filter 和 logs 订阅, 并保留给 eth_getLogs 查询.
+// 日志所在区块超过当前区块号时区块号随之前进
+func (n *MockNode) EmitLogs(logs ...types.Log) {
+	logs = append([]types.Log(nil), logs...)
+	for i := range logs {
+		// 节点返回的日志 topics 和 data 不会是 null, 否则客户端解码失败
+		if logs[i].Topics == nil {
+			logs[i].Topics = []common.Hash{}
+		}
+		if logs[i].Data == nil {
+			logs[i].Data = []byte{}
+		}
+	}
+
+	n.mutex.Lock()
+	n.logs = append(n.logs, logs...)
+	for _, log := range logs {
+		if log.BlockNumber > n.blockNumber {
+			n.blockNumber = log.BlockNumber
+		}
+	}
+	for _, filter := range n.filters {
+		if filter.kind != mockLogs {
+			continue
+		}
+		for _, log := range logs {
+			if matchCriteria(&log, filter.criteria, filter.criteria.FromBlock, filter.criteria.ToBlock) {
+				filter.logs = append(filter.logs, log)
+			}
+		}
+	}
+	subscriptions := n.activeSubscriptions(mockLogs)
+	n.mutex.Unlock()
+
+	for _, sub := range subscriptions {
+		for _, log := range logs {
+			if matchCriteria(&log, sub.criteria, sub.criteria.FromBlock, sub.criteria.ToBlock) {
+				n.notify(sub, log)
+			}
+		}
+	}
+}
+
+// EmitHead 推送新区块给 block filter 和 newHeads 订阅, 并把区块号设置为 header.Number
+func (n *MockNode) EmitHead(header *types.Header) {
+	n.mutex.Lock()
+	n.blockNumber = header.Number.Uint64()
+	for _, filter := range n.filters {
+		if filter.kind == mockNewHeads {
+			filter.hashes = append(filter.hashes, header.Hash())
+		}
+	}
+	subscriptions := n.activeSubscriptions(mockNewHeads)
+	n.mutex.Unlock()
+
+	for _, sub := range subscriptions {
+		n.notify(sub, header)
+	}
+}
+
+// UninstallFilters 删除所有 filter, 模拟节点重启或 filter 过期, 之后 eth_getFilterChanges 返回 filter not found
+func (n *MockNode) UninstallFilters() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.filters = make(map[string]*mockFilter)
+}
+
+// DropConnections 断开所有 WebSocket 连接, 客户端的订阅会收到错误
+func (n *MockNode) DropConnections() {
+	n.mutex.Lock()
+	conns := make([]*mockConn, 0, len(n.conns))
+	for conn := range n.conns {
+		conns = append(conns, conn)
+	}
+	n.mutex.Unlock()
+
+	for _, conn := range conns {
+		n.dropConn(conn)
+	}
+}
+
+func (n *MockNode) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		n.serveWs(w, r)
+		return
+	}
+
+	atomic.AddInt64(&n.requests, 1)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	requests, batch, err := decodeMessages(body)
+	if err != nil {
+		n.writeHTTP(w, &jsonrpcMessage{Version: "2.0", ID: json.RawMessage("null"), Error: &FixtureError{Code: -32700, Message: err.Error()}})
+		return
+	}
+	responses := n.handleMessages(r.Context(), nil, requests)
+	if batch {
+		n.writeHTTP(w, responses)
+	} else if len(responses) > 0 {
+		n.writeHTTP(w, responses[0])
+	}
+}
+
+func (n *MockNode) writeHTTP(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		n.t.Logf("mock node write response: %v", err)
+	}
+}
+
+func (n *MockNode) serveWs(w http.ResponseWriter, r *http.Request) {
+	ws, err := n.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	conn := &mockConn{ws: ws}
+	n.mutex.Lock()
+	if n.closed {
+		n.mutex.Unlock()
+		ws.Close()
+		return
+	}
+	n.conns[conn] = struct{}{}
+	n.mutex.Unlock()
+	defer n.dropConn(conn)
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		// 并发处理, 延迟较大的调用不阻塞同一连接上的其他调用
+		go n.serveWsMessage(conn, data)
+	}
+}
+
+func (n *MockNode) serveWsMessage(conn *mockConn, data []byte) {
+	atomic.AddInt64(&n.requests, 1)
+	requests, batch, err := decodeMessages(data)
+	if err != nil {
+		conn.write(&jsonrpcMessage{Version: "2.0", ID: json.RawMessage("null"), Error: &FixtureError{Code: -32700, Message: err.Error()}})
+		return
+	}
+	responses := n.handleMessages(context.Background(), conn, requests)
+	if batch {
+		err = conn.write(responses)
+	} else if len(responses) > 0 {
+		err = conn.write(responses[0])
+	}
+	if err != nil {
+		return
+	}
+
+	// 订阅响应发出后再开始推送, 否则客户端会丢弃通知
+	for i, request := range requests {
+		if request.Method != "eth_subscribe" || i >= len(responses) || responses[i].Error != nil {
+			continue
+		}
+		var id string
+		if json.Unmarshal(responses[i].Result, &id) == nil {
+			n.mutex.Lock()
+			if sub, ok := n.subscriptions[id]; ok {
+				sub.active = true
+			}
+			n.mutex.Unlock()
+		}
+	}
+}
+
+func (n *MockNode) dropConn(conn *mockConn) {
+	n.mutex.Lock()
+	delete(n.conns, conn)
+	for id, sub := range n.subscriptions {
+		if sub.conn == conn {
+			delete(n.subscriptions, id)
+		}
+	}
+	n.mutex.Unlock()
+	conn.ws.Close()
+}
+
+func (n *MockNode) handleMessages(ctx context.Context, conn *mockConn, requests []*jsonrpcMessage) []*jsonrpcMessage {
+	ctx = context.WithValue(ctx, mockConnKey{}, conn)
+	responses := make([]*jsonrpcMessage, 0, len(requests))
+	for _, request := range requests {
+		response := &jsonrpcMessage{Version: "2.0", ID: request.ID}
+		result, err := n.dispatch(ctx, request.Method, request.Params)
+		if err == nil {
+			response.Result, err = json.Marshal(result)
+		}
+		if err != nil {
+			response.Result = nil
+			response.Error = toJsonError(err)
+		}
+		// 没有 id 的是通知, 不需要响应
+		if len(request.ID) > 0 {
+			responses = append(responses, response)
+		}
+	}
+	return responses
+}
+
+func (n *MockNode) dispatch(ctx context.Context, method string, rawParams json.RawMessage) (interface{}, error) {
+	n.mutex.Lock()
+	n.calls = append(n.calls, MockCall{Method: method, Params: rawParams})
+	latency, ok := n.latency[method]
+	if !ok {
+		latency = n.latency[""]
+	}
+	var script *MockResponse
+	if queue := n.scripts[method]; len(queue) > 0 {
+		script = &queue[0]
+		n.scripts[method] = queue[1:]
+		latency += script.Latency
+	}
+	injected := n.errors[method]
+	handler := n.handlers[method]
+	n.mutex.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	if script != nil {
+		return script.Result, script.Err
+	}
+	if injected != nil {
+		return nil, injected
+	}
+	if handler == nil {
+		return nil, &MockError{Code: -32601, Message: fmt.Sprintf("the method %s does not exist/is not available", method)}
+	}
+
+	var params []json.RawMessage
+	if len(rawParams) > 0 && string(rawParams) != "null" {
+		if err := json.Unmarshal(rawParams, &params); err != nil {
+			return nil, &MockError{Code: -32602, Message: fmt.Sprintf("invalid params: %v", err)}
+		}
+	}
+	return handler(ctx, params)
+}
+
+func toJsonError(err error) *FixtureError {
+	jsonErr := &FixtureError{Code: -32000, Message: err.Error()}
+	var rpcErr interface{ ErrorCode() int }
+	if errors.As(err, &rpcErr) {
+		jsonErr.Code = rpcErr.ErrorCode()
+	}
+	var dataErr interface{ ErrorData() interface{} }
+	if errors.As(err, &dataErr) && dataErr.ErrorData() != nil {
+		jsonErr.Data, _ = json.Marshal(dataErr.ErrorData())
+	}
+	return jsonErr
+}
+
+func (n *MockNode) activeSubscriptions(kind string) []*mockSubscription {
+	var subscriptions []*mockSubscription
+	for _, sub := range n.subscriptions {
+		if sub.kind == kind && sub.active {
+			subscriptions = append(subscriptions, sub)
+		}
+	}
+	return subscriptions
+}
+
+func (n *MockNode) notify(sub *mockSubscription, result interface{}) {
+	params, err := json.Marshal(map[string]interface{}{"subscription": sub.id, "result": result})
+	if err != nil {
+		n.t.Errorf("marshal notification: %v", err)
+		return
+	}
+	sub.conn.write(&jsonrpcMessage{Version: "2.0", Method: "eth_subscription", Params: params})
+}
+
+func (n *MockNode) newId() string {
+	n.nextId++
+	return hexutil.EncodeUint64(n.nextId)
+}
+
+// decodeParam 解码第 index 个参数, 参数不存在时保持 v 不变
+func decodeParam(params []json.RawMessage, index int, v interface{}) error {
+	if index >= len(params) {
+		return nil
+	}
+	if err := json.Unmarshal(params[index], v); err != nil {
+		return &MockError{Code: -32602, Message: fmt.Sprintf("invalid argument %d: %v", index, err)}
+	}
+	return nil
+}
+
+func (n *MockNode) ethChainId(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return (*hexutil.Big)(n.chainId), nil
+}
+
+func (n *MockNode) netVersion(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.chainId.String(), nil
+}
+
+func (n *MockNode) web3ClientVersion(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	return "txtest/mocknode", nil
+}
+
+func (n *MockNode) ethBlockNumber(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return hexutil.Uint64(n.blockNumber), nil
+}
+
+func (n *MockNode) ethGasPrice(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	return (*hexutil.Big)(simTipCap), nil
+}
+
+func (n *MockNode) ethSendRawTransaction(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var input hexutil.Bytes
+	if err := decodeParam(params, 0, &input); err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return nil, err
+	}
+	n.AddPendingTransactions(tx)
+	return tx.Hash(), nil
+}
+
+func (n *MockNode) ethGetTransactionByHash(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var hash common.Hash
+	if err := decodeParam(params, 0, &hash); err != nil {
+		return nil, err
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for _, tx := range n.pending {
+		if tx.Hash() == hash {
+			return marshalRpcTx(types.LatestSignerForChainID(tx.ChainId()), tx, nil, 0, 0)
+		}
+	}
+	return nil, nil
+}
+
+func (n *MockNode) ethGetLogs(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var criteria filters.FilterCriteria
+	if err := decodeParam(params, 0, &criteria); err != nil {
+		return nil, err
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	// eth_getLogs 的 latest pending 以及缺省值都是当前区块
+	resolve := func(number *big.Int) *big.Int {
+		if number == nil || number.Sign() < 0 {
+			return new(big.Int).SetUint64(n.blockNumber)
+		}
+		return number
+	}
+	from, to := resolve(criteria.FromBlock), resolve(criteria.ToBlock)
+	if criteria.BlockHash != nil {
+		from, to = nil, nil
+	}
+	logs := []types.Log{}
+	for _, log := range n.logs {
+		if matchCriteria(&log, criteria, from, to) {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+func (n *MockNode) installFilter(filter *mockFilter) string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	id := n.newId()
+	n.filters[id] = filter
+	return id
+}
+
+func (n *MockNode) ethNewFilter(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var criteria filters.FilterCriteria
+	if err := decodeParam(params, 0, &criteria); err != nil {
+		return nil, err
+	}
+	return n.installFilter(&mockFilter{kind: mockLogs, criteria: criteria}), nil
+}
+
+func (n *MockNode) ethNewPendingTransactionFilter(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	return n.installFilter(&mockFilter{kind: mockNewPendingTransactions}), nil
+}
+
+func (n *MockNode) ethNewBlockFilter(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	return n.installFilter(&mockFilter{kind: mockNewHeads}), nil
+}
+
+func (n *MockNode) ethGetFilterChanges(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var id string
+	if err := decodeParam(params, 0, &id); err != nil {
+		return nil, err
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	filter, ok := n.filters[id]
+	if !ok {
+		return nil, errors.New("filter not found")
+	}
+	if filter.kind == mockLogs {
+		logs := filter.logs
+		filter.logs = nil
+		if logs == nil {
+			logs = []types.Log{}
+		}
+		return logs, nil
+	}
+	hashes := filter.hashes
+	filter.hashes = nil
+	if hashes == nil {
+		hashes = []common.Hash{}
+	}
+	return hashes, nil
+}
+
+func (n *MockNode) ethUninstallFilter(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var id string
+	if err := decodeParam(params, 0, &id); err != nil {
+		return nil, err
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	_, ok := n.filters[id]
+	delete(n.filters, id)
+	return ok, nil
+}
+
+func (n *MockNode) ethSubscribe(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	conn, _ := ctx.Value(mockConnKey{}).(*mockConn)
+	if conn == nil {
+		return nil, errors.New("notifications not supported")
+	}
+	var kind string
+	if err := decodeParam(params, 0, &kind); err != nil {
+		return nil, err
+	}
+	sub := &mockSubscription{kind: kind, conn: conn}
+	switch kind {
+	case mockLogs:
+		if err := decodeParam(params, 1, &sub.criteria); err != nil {
+			return nil, err
+		}
+	case mockNewHeads, mockNewPendingTransactions:
+	default:
+		return nil, fmt.Errorf("no %q subscription in eth namespace", kind)
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	sub.id = n.newId()
+	n.subscriptions[sub.id] = sub
+	return sub.id, nil
+}
+
+func (n *MockNode) ethUnsubscribe(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	var id string
+	if err := decodeParam(params, 0, &id); err != nil {
+		return nil, err
+	}
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	_, ok := n.subscriptions[id]
+	delete(n.subscriptions, id)
+	return ok, nil
+}
+
+func (n *MockNode) pendingFields() ([]map[string]interface{}, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	fields := make([]map[string]interface{}, 0, len(n.pending))
+	for _, tx := range n.pending {
+		txFields, err := marshalRpcTx(types.LatestSignerForChainID(tx.ChainId()), tx, nil, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, txFields)
+	}
+	return fields, nil
+}
+
+// txPoolContent 交易池中的交易都作为 pending 返回
+func (n *MockNode) txPoolContent(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	fields, err := n.pendingFields()
+	if err != nil {
+		return nil, err
+	}
+	content := map[string]map[string]map[string]map[string]interface{}{
+		"pending": make(map[string]map[string]map[string]interface{}),
+		"queued":  make(map[string]map[string]map[string]interface{}),
+	}
+	for _, txFields := range fields {
+		from := txFields["from"].(common.Address).Hex()
+		account, ok := content["pending"][from]
+		if !ok {
+			account = make(map[string]map[string]interface{})
+			content["pending"][from] = account
+		}
+		nonce, err := hexutil.DecodeUint64(txFields["nonce"].(string))
+		if err != nil {
+			return nil, err
+		}
+		account[fmt.Sprintf("%d", nonce)] = txFields
+	}
+	return content, nil
+}
+
+func (n *MockNode) txPoolStatus(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return map[string]hexutil.Uint{"pending": hexutil.Uint(len(n.pending)), "queued": 0}, nil
+}
+
+func (n *MockNode) parityAllTransactions(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	return n.pendingFields()
+}
+
+// matchCriteria 按 geth 的规则匹配日志, from to 为 nil 或负数时不限制
+func matchCriteria(log *types.Log, criteria filters.FilterCriteria, from *big.Int, to *big.Int) bool {
+	if criteria.BlockHash != nil && log.BlockHash != *criteria.BlockHash {
+		return false
+	}
+	if from != nil && from.Sign() >= 0 && from.Uint64() > log.BlockNumber {
+		return false
+	}
+	if to != nil && to.Sign() >= 0 && to.Uint64() < log.BlockNumber {
+		return false
+	}
+	if len(criteria.Addresses) > 0 {
+		found := false
+		for _, address := range criteria.Addresses {
+			if address == log.Address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(criteria.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, sub := range criteria.Topics {
+		if len(sub) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range sub {
+			if topic == log.Topics[i] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,179 @@
+package txtest
+
+import (
+	"context"
+	"errors"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestMockNodeScript(t *testing.T) {
+	node := NewMockNode(t)
+	client, err := rpc.Dial(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	node.SetResult("debug_traceTransaction", map[string]string{"type": "CALL"})
+	var trace map[string]string
+	if err := client.CallContext(ctx, &trace, "debug_traceTransaction", common.Hash{}); err != nil || trace["type"] != "CALL" {
+		t.Fatalf("unexpected trace %v %v", trace, err)
+	}
+
+	// 脚本响应按顺序消费, 之后恢复内置实现
+	node.Script("eth_blockNumber",
+		MockResponse{Err: &MockError{Code: 3, Message: "execution reverted", Data: "0x01"}},
+		MockResponse{Result: "0x10"},
+	)
+	node.SetBlockNumber(5)
+	var number hexutil.Uint64
+	err = client.CallContext(ctx, &number, "eth_blockNumber")
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) || dataErr.ErrorData() != "0x01" {
+		t.Fatalf("expected scripted error, got %v", err)
+	}
+	for _, want := range []hexutil.Uint64{16, 5} {
+		if err := client.CallContext(ctx, &number, "eth_blockNumber"); err != nil || number != want {
+			t.Fatalf("block number %d %v, want %d", number, err, want)
+		}
+	}
+
+	node.SetError("eth_gasPrice", errors.New("rate limited"))
+	if err := client.CallContext(ctx, nil, "eth_gasPrice"); err == nil || err.Error() != "rate limited" {
+		t.Fatalf("expected injected error, got %v", err)
+	}
+	node.SetError("eth_gasPrice", nil)
+	if err := client.CallContext(ctx, nil, "eth_gasPrice"); err != nil {
+		t.Fatal(err)
+	}
+
+	node.SetLatency("eth_chainId", time.Second)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := client.CallContext(timeoutCtx, nil, "eth_chainId"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	var rpcErr rpc.Error
+	if err := client.CallContext(ctx, nil, "parity_nodeKind"); !errors.As(err, &rpcErr) || rpcErr.ErrorCode() != -32601 {
+		t.Fatalf("expected method not found, got %v", err)
+	}
+	if count := node.CallCount("eth_blockNumber"); count != 3 {
+		t.Fatalf("eth_blockNumber called %d times", count)
+	}
+}
+
+func TestMockNodeStreams(t *testing.T) {
+	node := NewMockNode(t)
+	ctx := context.Background()
+	rpcClient, err := rpc.Dial(node.WSURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rpcClient.Close()
+	client := ethclient.NewClient(rpcClient)
+
+	token := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	transfer := common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	query := ethereum.FilterQuery{Addresses: []common.Address{token}, Topics: [][]common.Hash{{transfer}}}
+	logs := make(chan types.Log, 10)
+	sub, err := client.SubscribeFilterLogs(ctx, query, logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	node.EmitLogs(
+		types.Log{Address: common.HexToAddress("0x01"), Topics: []common.Hash{transfer}, BlockNumber: 1},
+		types.Log{Address: token, Topics: []common.Hash{transfer}, BlockNumber: 2, Index: 1},
+	)
+	select {
+	case log := <-logs:
+		if log.Address != token || log.Index != 1 {
+			t.Fatalf("unexpected log %+v", log)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for log")
+	}
+
+	history, err := client.FilterLogs(ctx, ethereum.FilterQuery{FromBlock: big.NewInt(0), Addresses: []common.Address{token}})
+	if err != nil || len(history) != 1 || history[0].BlockNumber != 2 {
+		t.Fatalf("unexpected eth_getLogs result %v %v", history, err)
+	}
+
+	// filter 被删除后返回 filter not found
+	var filterId string
+	if err := rpcClient.CallContext(ctx, &filterId, "eth_newPendingTransactionFilter"); err != nil {
+		t.Fatal(err)
+	}
+	node.UninstallFilters()
+	if err := rpcClient.CallContext(ctx, nil, "eth_getFilterChanges", filterId); err == nil || err.Error() != "filter not found" {
+		t.Fatalf("expected filter not found, got %v", err)
+	}
+
+	node.DropConnections()
+	select {
+	case err := <-sub.Err():
+		if err == nil {
+			t.Fatal("expected subscription error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not dropped")
+	}
+}
+
+type testRegisterService struct{}
+
+func (s *testRegisterService) BlockNumber() hexutil.Uint64 {
+	return 42
+}
+
+func (s *testRegisterService) Call(data hexutil.Bytes) (hexutil.Bytes, error) {
+	if len(data) == 0 {
+		return nil, &MockError{Code: 3, Message: "execution reverted", Data: "0x02"}
+	}
+	return data, nil
+}
+
+func TestMockNodeRegister(t *testing.T) {
+	node := NewMockNode(t)
+	if err := node.Register("eth", &testRegisterService{}); err != nil {
+		t.Fatal(err)
+	}
+	client, err := rpc.Dial(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	// 注册的方法覆盖内置实现, 错误码和错误数据原样返回
+	var number hexutil.Uint64
+	if err := client.CallContext(ctx, &number, "eth_blockNumber"); err != nil || number != 42 {
+		t.Fatalf("unexpected block number %d %v", number, err)
+	}
+	var result hexutil.Bytes
+	err = client.CallContext(ctx, &result, "eth_call", hexutil.Bytes{})
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) || dataErr.ErrorData() != "0x02" || dataErr.(rpc.Error).ErrorCode() != 3 {
+		t.Fatalf("expected revert error, got %v", err)
+	}
+
+	// 注册的方法同样可以注入错误, 调用记录和请求数照常统计
+	node.SetError("eth_call", errors.New("rate limited"))
+	if err := client.CallContext(ctx, &result, "eth_call", hexutil.Bytes{1}); err == nil || err.Error() != "rate limited" {
+		t.Fatalf("expected injected error, got %v", err)
+	}
+	if node.CallCount("eth_call") != 2 || node.Requests() != 3 {
+		t.Fatalf("unexpected calls %d requests %d", node.CallCount("eth_call"), node.Requests())
+	}
+}
@@ -0,0 +1,429 @@
+package txtest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	defaultSimAccounts = 3
+	defaultSimGasLimit = 30000000
+)
+
+// SimChainId SimulatedBackend 固定使用的链 id
+var SimChainId = big.NewInt(1337)
+
+// Account 预置余额的测试账户
+type Account struct {
+	Key     *ecdsa.PrivateKey
+	Address common.Address
+	// 0x 开头的十六进制私钥, 可直接用于 tx.NewDefaultTransactionManager
+	PrivateKey string
+}
+
+// NewAccount 按序号生成确定的测试账户, 同一序号每次得到相同的地址
+func NewAccount(index int) *Account {
+	key, err := crypto.ToECDSA(crypto.Keccak256([]byte(fmt.Sprintf("txtest account %d", index))))
+	if err != nil {
+		panic(err)
+	}
+	return &Account{
+		Key:        key,
+		Address:    crypto.PubkeyToAddress(key.PublicKey),
+		PrivateKey: hexutil.Encode(crypto.FromECDSA(key)),
+	}
+}
+
+type simOptions struct {
+	accounts int
+	balance  *big.Int
+	gasLimit uint64
+	alloc    core.GenesisAlloc
+	autoMine bool
+}
+
+type SimOption func(*simOptions)
+
+// WithAccounts 预置账户数量
+func WithAccounts(count int) SimOption {
+	return func(o *simOptions) {
+		o.accounts = count
+	}
+}
+
+// WithBalance 预置账户的初始余额, 默认 1000 ETH
+func WithBalance(balance *big.Int) SimOption {
+	return func(o *simOptions) {
+		o.balance = balance
+	}
+}
+
+// WithGasLimit 区块 gas 上限
+func WithGasLimit(gasLimit uint64) SimOption {
+	return func(o *simOptions) {
+		o.gasLimit = gasLimit
+	}
+}
+
+// WithGenesisAlloc 额外的创世状态, 例如预置合约代码
+func WithGenesisAlloc(alloc core.GenesisAlloc) SimOption {
+	return func(o *simOptions) {
+		o.alloc = alloc
+	}
+}
+
+// WithAutoMine 收到交易后是否立即出块, 默认开启. 关闭后需要调用 Mine 打包
+func WithAutoMine(autoMine bool) SimOption {
+	return func(o *simOptions) {
+		o.autoMine = autoMine
+	}
+}
+
+// SimChain 基于 SimulatedBackend 的本地链, 通过 MockNode 以 HTTP 和 WebSocket 提供 JSON-RPC,
+// 用于在不依赖外部节点的情况下测试 Web3Client 及相关组件
+type SimChain struct {
+	// HTTP JSON-RPC 地址
+	URL string
+	// WebSocket JSON-RPC 地址, 支持 eth_subscribe
+	WSURL    string
+	Accounts []*Account
+
+	t       testing.TB
+	backend *backends.SimulatedBackend
+	db      ethdb.Database
+	node    *MockNode
+	signer  types.Signer
+	txFeed  event.Feed
+	// 把链上的新区块和日志推送给 node 的订阅
+	headSub ethereum.Subscription
+	logSub  ethereum.Subscription
+
+	mutex    sync.Mutex
+	autoMine bool
+	pending  []*types.Transaction
+	closed   bool
+}
+
+// NewSimChain 启动本地链, 测试结束时自动关闭
+func NewSimChain(t testing.TB, opts ...SimOption) *SimChain {
+	t.Helper()
+
+	options := &simOptions{
+		accounts: defaultSimAccounts,
+		balance:  new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether)),
+		gasLimit: defaultSimGasLimit,
+		autoMine: true,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	alloc := core.GenesisAlloc{}
+	for address, account := range options.alloc {
+		alloc[address] = account
+	}
+	var accounts []*Account
+	for i := 0; i < options.accounts; i++ {
+		account := NewAccount(i)
+		accounts = append(accounts, account)
+		if _, ok := alloc[account.Address]; !ok {
+			alloc[account.Address] = core.GenesisAccount{Balance: options.balance}
+		}
+	}
+
+	db := rawdb.NewMemoryDatabase()
+	backend := backends.NewSimulatedBackendWithDatabase(db, alloc, options.gasLimit)
+	s := &SimChain{
+		Accounts: accounts,
+		t:        t,
+		backend:  backend,
+		db:       db,
+		node:     NewMockNode(t),
+		signer:   types.LatestSigner(backend.Blockchain().Config()),
+		autoMine: options.autoMine,
+	}
+	t.Cleanup(s.Close)
+	if err := s.registerApis(); err != nil {
+		t.Fatalf("register sim chain apis: %v", err)
+	}
+	if err := s.forwardEvents(); err != nil {
+		t.Fatalf("subscribe sim chain events: %v", err)
+	}
+	s.URL = s.node.URL
+	s.WSURL = s.node.WSURL
+	return s
+}
+
+// forwardEvents 新区块和日志 (包括重组时 Removed 的日志) 通过 node 推送给 eth_subscribe 订阅
+func (s *SimChain) forwardEvents() error {
+	ctx := context.Background()
+	heads := make(chan *types.Header, 16)
+	headSub, err := s.backend.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return err
+	}
+	logs := make(chan types.Log, 256)
+	logSub, err := s.backend.SubscribeFilterLogs(ctx, ethereum.FilterQuery{}, logs)
+	if err != nil {
+		headSub.Unsubscribe()
+		return err
+	}
+	s.headSub, s.logSub = headSub, logSub
+
+	go func() {
+		for {
+			select {
+			case header := <-heads:
+				s.node.EmitHead(header)
+			case <-headSub.Err():
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			select {
+			case l := <-logs:
+				s.node.EmitLogs(l)
+			case <-logSub.Err():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Node 返回提供 JSON-RPC 的 MockNode, 可以用来注入错误 延迟或者覆盖某个方法
+func (s *SimChain) Node() *MockNode {
+	return s.node
+}
+
+// Backend 返回底层的 SimulatedBackend, 可直接用于 abigen 绑定
+func (s *SimChain) Backend() *backends.SimulatedBackend {
+	return s.backend
+}
+
+// Dial 返回连接到本地链的 rpc.Client
+func (s *SimChain) Dial() *rpc.Client {
+	client, err := rpc.Dial(s.URL)
+	if err != nil {
+		s.t.Fatalf("dial sim chain: %v", err)
+	}
+	s.t.Cleanup(client.Close)
+	return client
+}
+
+// Close 关闭 RPC 服务和链, 可重复调用
+func (s *SimChain) Close() {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return
+	}
+	s.closed = true
+	s.mutex.Unlock()
+
+	if s.headSub != nil {
+		s.headSub.Unsubscribe()
+		s.logSub.Unsubscribe()
+	}
+	s.node.Close()
+	s.backend.Close()
+}
+
+// SetAutoMine 切换自动出块
+func (s *SimChain) SetAutoMine(autoMine bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.autoMine = autoMine
+}
+
+// Mine 把 pending 交易打包成一个新区块, 没有交易时产生空块
+func (s *SimChain) Mine() *types.Block {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.mineLocked()
+}
+
+func (s *SimChain) mineLocked() *types.Block {
+	s.backend.Commit()
+	s.dropPendingLocked()
+	return s.backend.Blockchain().CurrentBlock()
+}
+
+// MineBlocks 连续产生 n 个区块
+func (s *SimChain) MineBlocks(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := 0; i < n; i++ {
+		s.mineLocked()
+	}
+}
+
+// AdjustTime 产生一个时间戳向后偏移 d 的空块, 存在 pending 交易时返回错误
+func (s *SimChain) AdjustTime(d time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.backend.AdjustTime(d); err != nil {
+		return err
+	}
+	s.mineLocked()
+	return nil
+}
+
+// Rollback 丢弃所有 pending 交易
+func (s *SimChain) Rollback() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.backend.Rollback()
+	s.dropPendingLocked()
+}
+
+func (s *SimChain) dropPendingLocked() {
+	for _, tx := range s.pending {
+		s.node.RemovePendingTransaction(tx.Hash())
+	}
+	s.pending = nil
+}
+
+// Fork 从 parent 区块开始构造分叉链, 之后出块的区块数超过原链时发生重组
+func (s *SimChain) Fork(parent common.Hash) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.backend.Fork(context.Background(), parent)
+}
+
+// Head 返回当前最新区块
+func (s *SimChain) Head() *types.Block {
+	return s.backend.Blockchain().CurrentBlock()
+}
+
+// Pending 返回尚未出块的交易
+func (s *SimChain) Pending() []*types.Transaction {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pending := make([]*types.Transaction, len(s.pending))
+	copy(pending, s.pending)
+	return pending
+}
+
+// SendTransaction 提交已签名交易, 开启自动出块时立即打包
+func (s *SimChain) SendTransaction(tx *types.Transaction) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.sendLocked(tx); err != nil {
+		return err
+	}
+	s.pending = append(s.pending, tx)
+	s.txFeed.Send(core.NewTxsEvent{Txs: []*types.Transaction{tx}})
+	s.node.AddPendingTransactions(tx)
+	if s.autoMine {
+		s.mineLocked()
+	}
+	return nil
+}
+
+// sendLocked SimulatedBackend 在交易无法执行时 (余额不足 gas 不足等) 会 panic, 这里转换为错误
+func (s *SimChain) sendLocked(tx *types.Transaction) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+				return
+			}
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return s.backend.SendTransaction(context.Background(), tx)
+}
+
+// SignTx 用测试账户签名交易, nonce gas 和手续费未设置时自动填充
+func (s *SimChain) SignTx(from *Account, to *common.Address, data []byte, value *big.Int) (*types.Transaction, error) {
+	ctx := context.Background()
+	nonce, err := s.backend.PendingNonceAt(ctx, from.Address)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		value = new(big.Int)
+	}
+	gas, err := s.backend.EstimateGas(ctx, ethereum.CallMsg{From: from.Address, To: to, Data: data, Value: value})
+	if err != nil {
+		return nil, err
+	}
+
+	tip := big.NewInt(params.GWei)
+	feeCap := new(big.Int).Add(tip, new(big.Int).Mul(s.Head().BaseFee(), big.NewInt(2)))
+	return types.SignNewTx(from.Key, s.signer, &types.DynamicFeeTx{
+		ChainID:   SimChainId,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       gas,
+		To:        to,
+		Value:     value,
+		Data:      data,
+	})
+}
+
+// Transact 签名并发送交易, 确保出块后返回回执, 交易失败时测试失败
+func (s *SimChain) Transact(from *Account, to *common.Address, data []byte, value *big.Int) *types.Receipt {
+	s.t.Helper()
+
+	tx, err := s.SignTx(from, to, data, value)
+	if err != nil {
+		s.t.Fatalf("sign transaction: %v", err)
+	}
+	if err := s.SendTransaction(tx); err != nil {
+		s.t.Fatalf("send transaction: %v", err)
+	}
+	if len(s.Pending()) > 0 {
+		s.Mine()
+	}
+
+	receipt, err := s.backend.TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil {
+		s.t.Fatalf("transaction receipt: %v", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		s.t.Fatalf("transaction %s failed", tx.Hash().Hex())
+	}
+	return receipt
+}
+
+// Deploy 部署合约并返回地址
+func (s *SimChain) Deploy(from *Account, code []byte) common.Address {
+	s.t.Helper()
+	return s.Transact(from, nil, code, nil).ContractAddress
+}
+
+// Fund 从第一个预置账户向 to 转账
+func (s *SimChain) Fund(to common.Address, amount *big.Int) {
+	s.t.Helper()
+	if len(s.Accounts) == 0 {
+		s.t.Fatal(errors.New("sim chain has no funded account"))
+	}
+	s.Transact(s.Accounts[0], &to, nil, amount)
+}
@@ -0,0 +1,282 @@
+package txtest
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/snail-plus/eth-pkg/contract"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dialEthClient(t *testing.T, sim *SimChain) *ethclient.Client {
+	client, err := ethclient.Dial(sim.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+	return client
+}
+
+func TestSimChainRpc(t *testing.T) {
+	ctx := context.Background()
+	sim := NewSimChain(t, WithAutoMine(false))
+	client := dialEthClient(t, sim)
+
+	chainId, err := client.ChainID(ctx)
+	if err != nil || chainId.Cmp(SimChainId) != 0 {
+		t.Fatalf("unexpected chain id %v %v", chainId, err)
+	}
+	balance, err := client.BalanceAt(ctx, sim.Accounts[1].Address, nil)
+	if err != nil || balance.Cmp(new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether))) != 0 {
+		t.Fatalf("unexpected balance %v %v", balance, err)
+	}
+
+	to := common.HexToAddress("0x1234")
+	tx, err := sim.SignTx(sim.Accounts[0], &to, nil, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, isPending, err := client.TransactionByHash(ctx, tx.Hash()); err != nil || !isPending {
+		t.Fatalf("expected pending transaction %v %v", isPending, err)
+	}
+	if nonce, err := client.PendingNonceAt(ctx, sim.Accounts[0].Address); err != nil || nonce != 1 {
+		t.Fatalf("unexpected pending nonce %d %v", nonce, err)
+	}
+	if _, err := client.TransactionReceipt(ctx, tx.Hash()); err != ethereum.NotFound {
+		t.Fatalf("expected receipt not found, got %v", err)
+	}
+
+	block := sim.Mine()
+	receipt, err := client.TransactionReceipt(ctx, tx.Hash())
+	if err != nil || receipt.BlockHash != block.Hash() || receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("unexpected receipt %+v %v", receipt, err)
+	}
+	if _, isPending, err := client.TransactionByHash(ctx, tx.Hash()); err != nil || isPending {
+		t.Fatalf("expected mined transaction %v %v", isPending, err)
+	}
+	fullBlock, err := client.BlockByNumber(ctx, nil)
+	if err != nil || fullBlock.Hash() != block.Hash() || len(fullBlock.Transactions()) != 1 {
+		t.Fatalf("unexpected block %v", err)
+	}
+	if balance, err := client.BalanceAt(ctx, to, nil); err != nil || balance.Int64() != 100 {
+		t.Fatalf("unexpected balance %v %v", balance, err)
+	}
+	if balance, err := client.BalanceAt(ctx, to, big.NewInt(0)); err != nil || balance.Sign() != 0 {
+		t.Fatalf("unexpected historical balance %v %v", balance, err)
+	}
+
+	sim.MineBlocks(3)
+	if number, err := client.BlockNumber(ctx); err != nil || number != 4 {
+		t.Fatalf("unexpected block number %d %v", number, err)
+	}
+	before := sim.Head().Time()
+	if err := sim.AdjustTime(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if sim.Head().Time() < before+3600 {
+		t.Fatalf("time not adjusted: %d -> %d", before, sim.Head().Time())
+	}
+
+	// 余额不足的交易返回错误而不是让节点崩溃
+	poor := NewAccount(100)
+	tx, err = types.SignNewTx(poor.Key, types.LatestSignerForChainID(SimChainId), &types.LegacyTx{
+		To: &to, Gas: 21000, GasPrice: big.NewInt(params.GWei), Value: big.NewInt(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SendTransaction(ctx, tx); err == nil || !strings.Contains(err.Error(), "insufficient funds") {
+		t.Fatalf("expected insufficient funds, got %v", err)
+	}
+}
+
+func TestSimChainErc20(t *testing.T) {
+	ctx := context.Background()
+	sim := NewSimChain(t)
+	client := dialEthClient(t, sim)
+	owner, receiver := sim.Accounts[0], sim.Accounts[1]
+
+	supply := big.NewInt(1000000)
+	token := sim.DeployErc20(owner, "Test Token", "TT", 18, supply)
+	erc20, err := contract.NewErc20(token, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, err := erc20.Name(nil); err != nil || name != "Test Token" {
+		t.Fatalf("unexpected name %q %v", name, err)
+	}
+	if symbol, err := erc20.Symbol(nil); err != nil || symbol != "TT" {
+		t.Fatalf("unexpected symbol %q %v", symbol, err)
+	}
+	if decimals, err := erc20.Decimals(nil); err != nil || decimals != 18 {
+		t.Fatalf("unexpected decimals %d %v", decimals, err)
+	}
+
+	opts, err := bind.NewKeyedTransactorWithChainID(owner.Key, SimChainId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := erc20.Transfer(opts, receiver.Address, big.NewInt(300))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := bind.WaitMined(ctx, client, tx)
+	if err != nil || receipt.Status != types.ReceiptStatusSuccessful || len(receipt.Logs) != 1 {
+		t.Fatalf("unexpected receipt %+v %v", receipt, err)
+	}
+	transfer, err := erc20.ParseTransfer(*receipt.Logs[0])
+	if err != nil || transfer.From != owner.Address || transfer.To != receiver.Address || transfer.Value.Int64() != 300 {
+		t.Fatalf("unexpected transfer event %+v %v", transfer, err)
+	}
+	if balance := sim.Erc20BalanceOf(token, receiver.Address); balance.Int64() != 300 {
+		t.Fatalf("unexpected balance %v", balance)
+	}
+
+	// 余额存储在 slot 0 的 mapping 中
+	value, err := client.StorageAt(ctx, token, Erc20BalanceKey(receiver.Address), nil)
+	if err != nil || new(big.Int).SetBytes(value).Int64() != 300 {
+		t.Fatalf("unexpected storage %x %v", value, err)
+	}
+
+	// 超额转账回滚并带有原因
+	opts, _ = bind.NewKeyedTransactorWithChainID(receiver.Key, SimChainId)
+	if _, err := erc20.Transfer(opts, owner.Address, big.NewInt(301)); err == nil || !strings.Contains(err.Error(), "transfer amount exceeds balance") {
+		t.Fatalf("expected revert reason, got %v", err)
+	}
+
+	sim.Erc20Approve(receiver, token, owner.Address, big.NewInt(100))
+	if allowance, err := erc20.Allowance(nil, receiver.Address, owner.Address); err != nil || allowance.Int64() != 100 {
+		t.Fatalf("unexpected allowance %v %v", allowance, err)
+	}
+	opts, _ = bind.NewKeyedTransactorWithChainID(owner.Key, SimChainId)
+	if _, err := erc20.TransferFrom(opts, receiver.Address, owner.Address, big.NewInt(100)); err != nil {
+		t.Fatal(err)
+	}
+	if balance := sim.Erc20BalanceOf(token, receiver.Address); balance.Int64() != 200 {
+		t.Fatalf("unexpected balance after transferFrom %v", balance)
+	}
+	if _, err := erc20.TransferFrom(opts, receiver.Address, owner.Address, big.NewInt(1)); err == nil || !strings.Contains(err.Error(), "insufficient allowance") {
+		t.Fatalf("expected allowance revert, got %v", err)
+	}
+
+	if _, err := erc20.Mint(opts, receiver.Address, big.NewInt(50)); err != nil {
+		t.Fatal(err)
+	}
+	if total, err := erc20.TotalSupply(nil); err != nil || total.Int64() != 1000050 {
+		t.Fatalf("unexpected total supply %v %v", total, err)
+	}
+}
+
+func TestSimChainUniswap(t *testing.T) {
+	ctx := context.Background()
+	sim := NewSimChain(t)
+	client := dialEthClient(t, sim)
+	owner, trader := sim.Accounts[0], sim.Accounts[1]
+
+	supply := new(big.Int).Mul(big.NewInt(1000000), big.NewInt(params.Ether))
+	tokenA := sim.DeployErc20(owner, "Token A", "A", 18, supply)
+	tokenB := sim.DeployErc20(owner, "Token B", "B", 18, supply)
+	uniswap := sim.DeployUniswap(owner)
+
+	reserve := new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether))
+	pair := uniswap.AddLiquidity(owner, tokenA, reserve, tokenB, new(big.Int).Mul(reserve, big.NewInt(2)))
+	if pair != PairAddress(uniswap.Factory, tokenA, tokenB) {
+		t.Fatalf("pair address %s does not match CREATE2 address", pair.Hex())
+	}
+
+	factory, err := contract.NewUniswapFactory(uniswap.Factory, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := factory.INITCODEPAIRHASH(nil); err != nil || common.Hash(hash) != UniswapPairCodeHash() {
+		t.Fatalf("unexpected init code hash %x %v", hash, err)
+	}
+	if length, err := factory.AllPairsLength(nil); err != nil || length.Int64() != 1 {
+		t.Fatalf("unexpected pairs length %v %v", length, err)
+	}
+	if first, err := factory.AllPairs(nil, big.NewInt(0)); err != nil || first != pair {
+		t.Fatalf("unexpected allPairs(0) %s %v", first.Hex(), err)
+	}
+
+	pairContract, err := contract.NewUniswapPair(pair, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token0, _ := SortTokens(tokenA, tokenB)
+	if got, err := pairContract.Token0(nil); err != nil || got != token0 {
+		t.Fatalf("unexpected token0 %s %v", got.Hex(), err)
+	}
+
+	amountIn := big.NewInt(params.Ether)
+	sim.Erc20Transfer(owner, tokenA, trader.Address, amountIn)
+	sim.Erc20Approve(trader, tokenA, uniswap.Router, amountIn)
+
+	router, err := contract.NewUniswapRouter(uniswap.Router, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := []common.Address{tokenA, tokenB}
+	amounts, err := router.GetAmountsOut(nil, amountIn, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// amountIn * 997 * reserveOut / (reserveIn * 1000 + amountIn * 997)
+	inWithFee := new(big.Int).Mul(amountIn, big.NewInt(997))
+	expected := new(big.Int).Div(
+		new(big.Int).Mul(inWithFee, new(big.Int).Mul(reserve, big.NewInt(2))),
+		new(big.Int).Add(new(big.Int).Mul(reserve, big.NewInt(1000)), inWithFee),
+	)
+	if len(amounts) != 2 || amounts[1].Cmp(expected) != 0 {
+		t.Fatalf("unexpected amounts %v, expected %v", amounts, expected)
+	}
+
+	opts, _ := bind.NewKeyedTransactorWithChainID(trader.Key, SimChainId)
+	deadline := big.NewInt(time.Now().Add(time.Hour).Unix())
+	tooMuch := new(big.Int).Add(expected, big.NewInt(1))
+	if _, err := router.SwapExactTokensForTokens(opts, amountIn, tooMuch, path, trader.Address, deadline); err == nil || !strings.Contains(err.Error(), "INSUFFICIENT_OUTPUT_AMOUNT") {
+		t.Fatalf("expected slippage revert, got %v", err)
+	}
+
+	tx, err := router.SwapExactTokensForTokens(opts, amountIn, expected, path, trader.Address, deadline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := bind.WaitMined(ctx, client, tx)
+	if err != nil || receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("swap failed %+v %v", receipt, err)
+	}
+	var swapped bool
+	for _, l := range receipt.Logs {
+		if event, err := pairContract.ParseSwap(*l); err == nil {
+			swapped = event.To == trader.Address
+		}
+	}
+	if !swapped {
+		t.Fatal("missing Swap event")
+	}
+	if balance := sim.Erc20BalanceOf(tokenB, trader.Address); balance.Cmp(expected) != 0 {
+		t.Fatalf("unexpected output balance %v, expected %v", balance, expected)
+	}
+	if balance := sim.Erc20BalanceOf(tokenA, trader.Address); balance.Sign() != 0 {
+		t.Fatalf("unexpected input balance %v", balance)
+	}
+
+	reserve0, reserve1 := uniswap.GetReserves(pair)
+	reserveA, reserveB := reserve0, reserve1
+	if token0 != tokenA {
+		reserveA, reserveB = reserve1, reserve0
+	}
+	if reserveA.Cmp(new(big.Int).Add(reserve, amountIn)) != 0 || reserveB.Cmp(new(big.Int).Sub(new(big.Int).Mul(reserve, big.NewInt(2)), expected)) != 0 {
+		t.Fatalf("unexpected reserves %v %v", reserveA, reserveB)
+	}
+}
@@ -0,0 +1,86 @@
+package txtest
+
+import (
+	"context"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/bloombits"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// simFilterBackend 为 geth 的 filters.PublicFilterAPI 提供数据, 支持 eth_newFilter eth_getLogs 以及 eth_subscribe
+type simFilterBackend struct {
+	chain *SimChain
+}
+
+func (b *simFilterBackend) ChainDb() ethdb.Database {
+	return b.chain.db
+}
+
+func (b *simFilterBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	bc := b.chain.backend.Blockchain()
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		return bc.CurrentHeader(), nil
+	}
+	return bc.GetHeaderByNumber(uint64(number.Int64())), nil
+}
+
+func (b *simFilterBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return b.chain.backend.Blockchain().GetHeaderByHash(hash), nil
+}
+
+func (b *simFilterBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	number := rawdb.ReadHeaderNumber(b.chain.db, hash)
+	if number == nil {
+		return nil, nil
+	}
+	return rawdb.ReadReceipts(b.chain.db, hash, *number, b.chain.backend.Blockchain().Config()), nil
+}
+
+func (b *simFilterBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
+	receipts, err := b.GetReceipts(ctx, hash)
+	if err != nil || receipts == nil {
+		return nil, err
+	}
+	logs := make([][]*types.Log, len(receipts))
+	for i, receipt := range receipts {
+		logs[i] = receipt.Logs
+	}
+	return logs, nil
+}
+
+func (b *simFilterBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
+	return b.chain.txFeed.Subscribe(ch)
+}
+
+func (b *simFilterBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
+	return b.chain.backend.Blockchain().SubscribeChainEvent(ch)
+}
+
+func (b *simFilterBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
+	return b.chain.backend.Blockchain().SubscribeRemovedLogsEvent(ch)
+}
+
+func (b *simFilterBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
+	return b.chain.backend.Blockchain().SubscribeLogsEvent(ch)
+}
+
+func (b *simFilterBackend) SubscribePendingLogsEvent(ch chan<- []*types.Log) event.Subscription {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	})
+}
+
+// BloomStatus 没有 bloombits 索引, 范围查询逐块匹配 bloom
+func (b *simFilterBackend) BloomStatus() (uint64, uint64) {
+	return params.BloomBitsBlocks, 0
+}
+
+func (b *simFilterBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
+}
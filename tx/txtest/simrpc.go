@@ -0,0 +1,458 @@
+package txtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/filters"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"math/big"
+	"time"
+)
+
+// simTipCap eth_maxPriorityFeePerGas 返回的小费
+var simTipCap = big.NewInt(params.GWei)
+
+func (s *SimChain) registerApis() error {
+	apis := []struct {
+		namespace string
+		service   interface{}
+	}{
+		{"eth", &simEthService{chain: s}},
+		{"eth", filters.NewPublicFilterAPI(&simFilterBackend{chain: s}, false, 5*time.Minute)},
+		{"net", &simNetService{}},
+		{"web3", &simWeb3Service{}},
+		{"txpool", &simTxPoolService{chain: s}},
+	}
+	for _, api := range apis {
+		if err := s.node.Register(api.namespace, api.service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type simNetService struct{}
+
+func (s *simNetService) Version() string {
+	return SimChainId.String()
+}
+
+type simWeb3Service struct{}
+
+func (s *simWeb3Service) ClientVersion() string {
+	return "txtest/simchain"
+}
+
+// simCallArgs eth_call eth_estimateGas 的参数
+type simCallArgs struct {
+	From                 *common.Address `json:"from"`
+	To                   *common.Address `json:"to"`
+	Gas                  *hexutil.Uint64 `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+	Value                *hexutil.Big    `json:"value"`
+	Data                 *hexutil.Bytes  `json:"data"`
+	Input                *hexutil.Bytes  `json:"input"`
+}
+
+func (args simCallArgs) toCallMsg() ethereum.CallMsg {
+	var msg ethereum.CallMsg
+	if args.From != nil {
+		msg.From = *args.From
+	}
+	msg.To = args.To
+	if args.Gas != nil {
+		msg.Gas = uint64(*args.Gas)
+	}
+	msg.GasPrice = (*big.Int)(args.GasPrice)
+	msg.GasFeeCap = (*big.Int)(args.MaxFeePerGas)
+	msg.GasTipCap = (*big.Int)(args.MaxPriorityFeePerGas)
+	msg.Value = (*big.Int)(args.Value)
+	if args.Input != nil {
+		msg.Data = *args.Input
+	} else if args.Data != nil {
+		msg.Data = *args.Data
+	}
+	return msg
+}
+
+// simRevertError 与 geth 一致, 回滚时返回 code 3 以及十六进制的回滚数据
+type simRevertError struct {
+	error
+	data string
+}
+
+func (e *simRevertError) ErrorCode() int {
+	return 3
+}
+
+func (e *simRevertError) ErrorData() interface{} {
+	return e.data
+}
+
+func newSimRevertError(result *core.ExecutionResult) *simRevertError {
+	err := errors.New("execution reverted")
+	if reason, errUnpack := abi.UnpackRevert(result.Revert()); errUnpack == nil {
+		err = fmt.Errorf("execution reverted: %s", reason)
+	}
+	return &simRevertError{error: err, data: hexutil.Encode(result.Revert())}
+}
+
+type simEthService struct {
+	chain *SimChain
+}
+
+func (s *simEthService) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(SimChainId)
+}
+
+func (s *simEthService) BlockNumber() hexutil.Uint64 {
+	return hexutil.Uint64(s.chain.Head().NumberU64())
+}
+
+// header 解析区块参数, pending 按最新区块处理
+func (s *simEthService) header(blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error) {
+	bc := s.chain.backend.Blockchain()
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		header := bc.GetHeaderByHash(hash)
+		if header == nil {
+			return nil, fmt.Errorf("header for hash %s not found", hash.Hex())
+		}
+		if blockNrOrHash.RequireCanonical && bc.GetCanonicalHash(header.Number.Uint64()) != hash {
+			return nil, fmt.Errorf("hash %s is not currently canonical", hash.Hex())
+		}
+		return header, nil
+	}
+
+	number, ok := blockNrOrHash.Number()
+	if !ok {
+		return nil, errors.New("invalid arguments; neither block nor hash specified")
+	}
+	return s.headerByNumber(number)
+}
+
+func (s *simEthService) headerByNumber(number rpc.BlockNumber) (*types.Header, error) {
+	bc := s.chain.backend.Blockchain()
+	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
+		return bc.CurrentHeader(), nil
+	}
+	header := bc.GetHeaderByNumber(uint64(number.Int64()))
+	if header == nil {
+		return nil, fmt.Errorf("header #%d not found", number)
+	}
+	return header, nil
+}
+
+func (s *simEthService) state(blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error) {
+	header, err := s.header(blockNrOrHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	statedb, err := s.chain.backend.Blockchain().StateAt(header.Root)
+	return statedb, header, err
+}
+
+func isPending(blockNrOrHash rpc.BlockNumberOrHash) bool {
+	number, ok := blockNrOrHash.Number()
+	return ok && number == rpc.PendingBlockNumber
+}
+
+func (s *simEthService) GetBalance(address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (*hexutil.Big, error) {
+	statedb, _, err := s.state(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return (*hexutil.Big)(statedb.GetBalance(address)), nil
+}
+
+func (s *simEthService) GetTransactionCount(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Uint64, error) {
+	if isPending(blockNrOrHash) {
+		nonce, err := s.chain.backend.PendingNonceAt(ctx, address)
+		return hexutil.Uint64(nonce), err
+	}
+
+	statedb, _, err := s.state(blockNrOrHash)
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(statedb.GetNonce(address)), nil
+}
+
+func (s *simEthService) GetCode(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	if isPending(blockNrOrHash) {
+		return s.chain.backend.PendingCodeAt(ctx, address)
+	}
+
+	statedb, _, err := s.state(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return statedb.GetCode(address), nil
+}
+
+func (s *simEthService) GetStorageAt(address common.Address, key string, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	slot, err := hexutil.DecodeBig(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage key %q: %w", key, err)
+	}
+	statedb, _, err := s.state(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	value := statedb.GetState(address, common.BigToHash(slot))
+	return value[:], nil
+}
+
+func (s *simEthService) Call(ctx context.Context, args simCallArgs, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	if isPending(blockNrOrHash) {
+		return s.chain.backend.PendingCallContract(ctx, args.toCallMsg())
+	}
+
+	statedb, header, err := s.state(blockNrOrHash)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.chain.applyCall(args.toCallMsg(), header, statedb)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Revert()) > 0 {
+		return nil, newSimRevertError(result)
+	}
+	return result.Return(), result.Err
+}
+
+func (s *simEthService) EstimateGas(ctx context.Context, args simCallArgs, blockNrOrHash *rpc.BlockNumberOrHash) (hexutil.Uint64, error) {
+	gas, err := s.chain.backend.EstimateGas(ctx, args.toCallMsg())
+	return hexutil.Uint64(gas), err
+}
+
+// GasPrice 下一个区块的 baseFee 加上默认小费
+func (s *simEthService) GasPrice() *hexutil.Big {
+	return (*hexutil.Big)(new(big.Int).Add(s.chain.nextBaseFee(), simTipCap))
+}
+
+func (s *simEthService) MaxPriorityFeePerGas() *hexutil.Big {
+	return (*hexutil.Big)(simTipCap)
+}
+
+func (s *simEthService) SendRawTransaction(input hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	if err := s.chain.SendTransaction(tx); err != nil {
+		return common.Hash{}, err
+	}
+	return tx.Hash(), nil
+}
+
+func (s *simEthService) GetTransactionByHash(hash common.Hash) (map[string]interface{}, error) {
+	if tx, blockHash, blockNumber, index := rawdb.ReadTransaction(s.chain.db, hash); tx != nil {
+		header := s.chain.backend.Blockchain().GetHeaderByHash(blockHash)
+		return s.chain.marshalTx(tx, header, blockNumber, index)
+	}
+
+	for _, tx := range s.chain.Pending() {
+		if tx.Hash() == hash {
+			return s.chain.marshalTx(tx, nil, 0, 0)
+		}
+	}
+	return nil, nil
+}
+
+func (s *simEthService) GetTransactionReceipt(hash common.Hash) (map[string]interface{}, error) {
+	tx, blockHash, _, _ := rawdb.ReadTransaction(s.chain.db, hash)
+	if tx == nil {
+		return nil, nil
+	}
+	receipt, _, _, _ := rawdb.ReadReceipt(s.chain.db, hash, s.chain.backend.Blockchain().Config())
+	if receipt == nil {
+		return nil, nil
+	}
+
+	fields, err := toFields(receipt)
+	if err != nil {
+		return nil, err
+	}
+	from, err := types.Sender(s.chain.signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	fields["from"] = from
+	fields["to"] = tx.To()
+	if tx.To() != nil {
+		fields["contractAddress"] = nil
+	}
+	header := s.chain.backend.Blockchain().GetHeaderByHash(blockHash)
+	fields["effectiveGasPrice"] = (*hexutil.Big)(effectiveGasPrice(tx, header.BaseFee))
+	return fields, nil
+}
+
+func (s *simEthService) GetBlockByNumber(number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
+	header, err := s.headerByNumber(number)
+	if err != nil {
+		return nil, nil
+	}
+	return s.chain.marshalBlock(s.chain.backend.Blockchain().GetBlock(header.Hash(), header.Number.Uint64()), fullTx)
+}
+
+func (s *simEthService) GetBlockByHash(hash common.Hash, fullTx bool) (map[string]interface{}, error) {
+	block := s.chain.backend.Blockchain().GetBlockByHash(hash)
+	if block == nil {
+		return nil, nil
+	}
+	return s.chain.marshalBlock(block, fullTx)
+}
+
+type simTxPoolService struct {
+	chain *SimChain
+}
+
+// Content 只包含 pending 交易, SimulatedBackend 不存在 queued 交易
+func (s *simTxPoolService) Content() (map[string]map[string]map[string]map[string]interface{}, error) {
+	content := map[string]map[string]map[string]map[string]interface{}{
+		"pending": make(map[string]map[string]map[string]interface{}),
+		"queued":  make(map[string]map[string]map[string]interface{}),
+	}
+	for _, tx := range s.chain.Pending() {
+		from, err := types.Sender(s.chain.signer, tx)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := s.chain.marshalTx(tx, nil, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		account, ok := content["pending"][from.Hex()]
+		if !ok {
+			account = make(map[string]map[string]interface{})
+			content["pending"][from.Hex()] = account
+		}
+		account[fmt.Sprintf("%d", tx.Nonce())] = fields
+	}
+	return content, nil
+}
+
+// applyCall 在指定区块状态上执行调用, 不校验 nonce 和手续费
+func (s *SimChain) applyCall(call ethereum.CallMsg, header *types.Header, statedb *state.StateDB) (*core.ExecutionResult, error) {
+	if call.Gas == 0 {
+		call.Gas = header.GasLimit
+	}
+	if call.Value == nil {
+		call.Value = new(big.Int)
+	}
+	gasPrice := call.GasPrice
+	if gasPrice == nil {
+		gasPrice = new(big.Int)
+	}
+	feeCap, tipCap := call.GasFeeCap, call.GasTipCap
+	if feeCap == nil {
+		feeCap = gasPrice
+	}
+	if tipCap == nil {
+		tipCap = gasPrice
+	}
+
+	msg := types.NewMessage(call.From, call.To, 0, call.Value, call.Gas, gasPrice, feeCap, tipCap, call.Data, call.AccessList, true)
+	bc := s.backend.Blockchain()
+	blockContext := core.NewEVMBlockContext(header, bc, nil)
+	evm := vm.NewEVM(blockContext, core.NewEVMTxContext(msg), statedb, bc.Config(), vm.Config{NoBaseFee: true})
+	return core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(math.MaxUint64))
+}
+
+// nextBaseFee 下一个区块的 baseFee
+func (s *SimChain) nextBaseFee() *big.Int {
+	bc := s.backend.Blockchain()
+	return misc.CalcBaseFee(bc.Config(), bc.CurrentHeader())
+}
+
+func effectiveGasPrice(tx *types.Transaction, baseFee *big.Int) *big.Int {
+	if baseFee == nil || tx.Type() != types.DynamicFeeTxType {
+		return tx.GasPrice()
+	}
+	return math.BigMin(new(big.Int).Add(tx.GasTipCap(), baseFee), tx.GasFeeCap())
+}
+
+func (s *SimChain) marshalTx(tx *types.Transaction, header *types.Header, blockNumber uint64, index uint64) (map[string]interface{}, error) {
+	return marshalRpcTx(s.signer, tx, header, blockNumber, index)
+}
+
+// marshalRpcTx 按 geth 的 RPCTransaction 格式输出, header 为 nil 时表示 pending 交易
+func marshalRpcTx(signer types.Signer, tx *types.Transaction, header *types.Header, blockNumber uint64, index uint64) (map[string]interface{}, error) {
+	fields, err := toFields(tx)
+	if err != nil {
+		return nil, err
+	}
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	fields["from"] = from
+	fields["to"] = tx.To()
+	fields["blockHash"] = nil
+	fields["blockNumber"] = nil
+	fields["transactionIndex"] = nil
+	fields["gasPrice"] = (*hexutil.Big)(tx.GasPrice())
+	if header != nil {
+		fields["blockHash"] = header.Hash()
+		fields["blockNumber"] = (*hexutil.Big)(new(big.Int).SetUint64(blockNumber))
+		fields["transactionIndex"] = hexutil.Uint64(index)
+		fields["gasPrice"] = (*hexutil.Big)(effectiveGasPrice(tx, header.BaseFee))
+	}
+	return fields, nil
+}
+
+func (s *SimChain) marshalBlock(block *types.Block, fullTx bool) (map[string]interface{}, error) {
+	if block == nil {
+		return nil, nil
+	}
+	fields, err := toFields(block.Header())
+	if err != nil {
+		return nil, err
+	}
+
+	fields["size"] = hexutil.Uint64(block.Size())
+	fields["totalDifficulty"] = (*hexutil.Big)(s.backend.Blockchain().GetTd(block.Hash(), block.NumberU64()))
+	fields["uncles"] = []common.Hash{}
+	txs := make([]interface{}, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		if !fullTx {
+			txs[i] = tx.Hash()
+			continue
+		}
+		txFields, err := s.marshalTx(tx, block.Header(), block.NumberU64(), uint64(i))
+		if err != nil {
+			return nil, err
+		}
+		txs[i] = txFields
+	}
+	fields["transactions"] = txs
+	return fields, nil
+}
+
+// toFields 把 geth 类型的 JSON 编码转换成 map, 便于补充 RPC 额外返回的字段
+func toFields(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
@@ -0,0 +1,397 @@
+package txtest
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+)
+
+// 测试用的简化版 UniswapV2, 只实现交易相关的接口, 手续费和 K 值校验与 V2 一致
+const (
+	pairToken0Slot   = 0
+	pairToken1Slot   = 1
+	pairReserve0Slot = 2
+	pairReserve1Slot = 3
+	pairFactorySlot  = 4
+
+	factoryGetPairSlot  = 0
+	factoryAllPairsSlot = 1
+)
+
+var (
+	syncTopic        = eventTopic("Sync(uint112,uint112)")
+	swapTopic        = eventTopic("Swap(address,uint256,uint256,uint256,uint256,address)")
+	pairCreatedTopic = eventTopic("PairCreated(address,address,address,uint256)")
+)
+
+// pair 内存布局
+const (
+	memAmount0Out = 0x80
+	memAmount1Out = 0xa0
+	memSwapTo     = 0xc0
+	memBalance0   = 0x140
+	memBalance1   = 0x160
+	memAmount0In  = 0x180
+	memAmount1In  = 0x1a0
+	memCall       = 0x200
+	memCallResult = 0x300
+)
+
+// UniswapPairCode 返回交易对的部署代码, 工厂通过 CREATE2 部署
+func UniswapPairCode() []byte {
+	return initCode(nil, uniswapPairRuntime())
+}
+
+// UniswapPairCodeHash 对应 INIT_CODE_PAIR_HASH, 可用于离线计算交易对地址
+func UniswapPairCodeHash() common.Hash {
+	return crypto.Keccak256Hash(UniswapPairCode())
+}
+
+func uniswapPairRuntime() []byte {
+	a := newAssembler()
+	a.dispatch(
+		"initialize(address,address)", "token0()", "token1()", "factory()",
+		"getReserves()", "sync()", "swap(uint256,uint256,address,bytes)",
+	)
+
+	a.label("initialize(address,address)")
+	a.push(pairToken0Slot).op(vm.SLOAD).jumpi("forbidden")
+	a.arg(0).push(pairToken0Slot).op(vm.SSTORE)
+	a.arg(1).push(pairToken1Slot).op(vm.SSTORE)
+	a.op(vm.CALLER).push(pairFactorySlot).op(vm.SSTORE)
+	a.op(vm.STOP)
+
+	a.label("token0()").push(pairToken0Slot).op(vm.SLOAD).returnTop()
+	a.label("token1()").push(pairToken1Slot).op(vm.SLOAD).returnTop()
+	a.label("factory()").push(pairFactorySlot).op(vm.SLOAD).returnTop()
+
+	a.label("getReserves()")
+	a.push(pairReserve0Slot).op(vm.SLOAD).mstore(0)
+	a.push(pairReserve1Slot).op(vm.SLOAD).mstore(0x20)
+	a.op(vm.TIMESTAMP).mstore(0x40)
+	a.push(0x60).push(0).op(vm.RETURN)
+
+	a.label("sync()")
+	pairBalances(a)
+	pairUpdate(a)
+	a.op(vm.STOP)
+
+	a.label("swap(uint256,uint256,address,bytes)")
+	a.arg(0).mstore(memAmount0Out)
+	a.arg(1).mstore(memAmount1Out)
+	a.arg(2).mstore(memSwapTo)
+	a.mload(memAmount0Out).mload(memAmount1Out).op(vm.OR, vm.ISZERO).jumpi("insufficientOutput")
+	a.push(pairReserve0Slot).op(vm.SLOAD).mload(memAmount0Out).op(vm.LT, vm.ISZERO).jumpi("insufficientLiquidity")
+	a.push(pairReserve1Slot).op(vm.SLOAD).mload(memAmount1Out).op(vm.LT, vm.ISZERO).jumpi("insufficientLiquidity")
+
+	a.mload(memAmount0Out).op(vm.ISZERO).jumpi("skipOut0")
+	pairTransfer(a, pairToken0Slot, memAmount0Out)
+	a.label("skipOut0")
+	a.mload(memAmount1Out).op(vm.ISZERO).jumpi("skipOut1")
+	pairTransfer(a, pairToken1Slot, memAmount1Out)
+	a.label("skipOut1")
+
+	pairBalances(a)
+	pairAmountIn(a, "0", pairReserve0Slot, memAmount0Out, memBalance0, memAmount0In)
+	pairAmountIn(a, "1", pairReserve1Slot, memAmount1Out, memBalance1, memAmount1In)
+	a.mload(memAmount0In).mload(memAmount1In).op(vm.OR, vm.ISZERO).jumpi("insufficientInput")
+
+	// (balance0 * 1000 - amount0In * 3) * (balance1 * 1000 - amount1In * 3) >= reserve0 * reserve1 * 1000^2
+	a.push(3).mload(memAmount0In).op(vm.MUL).push(1000).mload(memBalance0).op(vm.MUL, vm.SUB)
+	a.push(3).mload(memAmount1In).op(vm.MUL).push(1000).mload(memBalance1).op(vm.MUL, vm.SUB)
+	a.op(vm.MUL)
+	a.push(1000000).push(pairReserve1Slot).op(vm.SLOAD).push(pairReserve0Slot).op(vm.SLOAD).op(vm.MUL, vm.MUL)
+	a.op(vm.GT).jumpi("k")
+
+	pairUpdate(a)
+	a.mload(memAmount0Out).mstore(0x1c0)
+	a.mload(memAmount1Out).mstore(0x1e0)
+	a.mload(memSwapTo).op(vm.CALLER).push(swapTopic).push(0x80).push(memAmount0In).op(vm.LOG3)
+	a.op(vm.STOP)
+
+	a.label("forbidden").revertReason("UniswapV2: FORBIDDEN")
+	a.label("insufficientOutput").revertReason("UniswapV2: INSUFFICIENT_OUTPUT_AMOUNT")
+	a.label("insufficientInput").revertReason("UniswapV2: INSUFFICIENT_INPUT_AMOUNT")
+	a.label("insufficientLiquidity").revertReason("UniswapV2: INSUFFICIENT_LIQUIDITY")
+	a.label("k").revertReason("UniswapV2: K")
+	a.bubbleRevert("callFailed")
+	return a.bytes()
+}
+
+// pairBalances 查询两个代币在交易对中的余额, 写入 memBalance0 memBalance1
+func pairBalances(a *assembler) {
+	for i, slot := range []int{pairToken0Slot, pairToken1Slot} {
+		a.pushWord(selector("balanceOf(address)")).mstore(memCall)
+		a.op(vm.ADDRESS).mstore(memCall + 4)
+		a.push(0x20).push(memCallResult).push(0x24).push(memCall).push(slot).op(vm.SLOAD, vm.GAS, vm.STATICCALL)
+		a.op(vm.ISZERO).jumpi("callFailed")
+		a.mload(memCallResult).mstore(memBalance0 + 0x20*i)
+	}
+}
+
+// pairUpdate 用当前余额更新储备量并记录 Sync 事件
+func pairUpdate(a *assembler) {
+	a.mload(memBalance0).push(pairReserve0Slot).op(vm.SSTORE)
+	a.mload(memBalance1).push(pairReserve1Slot).op(vm.SSTORE)
+	a.push(syncTopic).push(0x40).push(memBalance0).op(vm.LOG1)
+}
+
+// pairTransfer 把内存 amountOffset 数量的代币转给 memSwapTo
+func pairTransfer(a *assembler, tokenSlot int, amountOffset int) {
+	a.pushWord(selector("transfer(address,uint256)")).mstore(memCall)
+	a.mload(memSwapTo).mstore(memCall + 4)
+	a.mload(amountOffset).mstore(memCall + 0x24)
+	a.push(0x20).push(memCallResult).push(0x44).push(memCall).push(0).push(tokenSlot).op(vm.SLOAD, vm.GAS, vm.CALL)
+	a.op(vm.ISZERO).jumpi("callFailed")
+}
+
+// pairAmountIn amountIn = balance > reserve - amountOut ? balance - (reserve - amountOut) : 0
+func pairAmountIn(a *assembler, suffix string, reserveSlot int, amountOutOffset int, balanceOffset int, amountInOffset int) {
+	a.mload(amountOutOffset).push(reserveSlot).op(vm.SLOAD, vm.SUB)
+	a.op(vm.DUP1).mload(balanceOffset).op(vm.GT).jumpi("amountIn" + suffix)
+	a.op(vm.POP).push(0).jump("amountInDone" + suffix)
+	a.label("amountIn" + suffix)
+	a.mload(balanceOffset).op(vm.SUB)
+	a.label("amountInDone" + suffix)
+	a.mstore(amountInOffset)
+}
+
+// factory 内存布局: 0x80 token0, 0xa0 token1, 0xc0 pair, 0xe0 allPairsLength
+const (
+	memToken0 = 0x80
+	memToken1 = 0xa0
+	memPair   = 0xc0
+	memLength = 0xe0
+	memCode   = 0x400
+)
+
+// UniswapFactoryCode 返回工厂的部署代码
+func UniswapFactoryCode() []byte {
+	return initCode(nil, uniswapFactoryRuntime())
+}
+
+func uniswapFactoryRuntime() []byte {
+	pairCode := UniswapPairCode()
+
+	a := newAssembler()
+	a.dispatch(
+		"createPair(address,address)", "getPair(address,address)", "allPairs(uint256)",
+		"allPairsLength()", "INIT_CODE_PAIR_HASH()",
+	)
+
+	a.label("createPair(address,address)")
+	a.arg(0).arg(1)
+	a.op(vm.DUP2, vm.DUP2, vm.EQ).jumpi("identical")
+	a.op(vm.DUP2, vm.DUP2, vm.LT).jumpi("swapped")
+	a.mstore(memToken1).mstore(memToken0).jump("sorted")
+	a.label("swapped")
+	a.mstore(memToken0).mstore(memToken1)
+	a.label("sorted")
+	a.mload(memToken0).op(vm.ISZERO).jumpi("zeroAddress")
+	a.nestedMappingSlot(memToken0, memToken1, factoryGetPairSlot).op(vm.SLOAD).jumpi("pairExists")
+
+	// CREATE2 salt = keccak256(token0, token1)
+	a.push(len(pairCode)).pushLabel("pairCode").push(memCode).op(vm.CODECOPY)
+	a.push(0x40).push(memToken0).op(vm.KECCAK256)
+	a.push(len(pairCode)).push(memCode).push(0).op(vm.CREATE2)
+	a.op(vm.DUP1, vm.ISZERO).jumpi("callFailed")
+	a.mstore(memPair)
+
+	a.pushWord(selector("initialize(address,address)")).mstore(memCall)
+	a.mload(memToken0).mstore(memCall + 4)
+	a.mload(memToken1).mstore(memCall + 0x24)
+	a.push(0).push(0).push(0x44).push(memCall).push(0).mload(memPair).op(vm.GAS, vm.CALL)
+	a.op(vm.ISZERO).jumpi("callFailed")
+
+	a.mload(memPair).nestedMappingSlot(memToken0, memToken1, factoryGetPairSlot).op(vm.SSTORE)
+	a.mload(memPair).nestedMappingSlot(memToken1, memToken0, factoryGetPairSlot).op(vm.SSTORE)
+
+	// allPairs.push(pair)
+	a.push(factoryAllPairsSlot).op(vm.SLOAD)
+	a.mload(memPair)
+	a.push(factoryAllPairsSlot).mstore(0).push(0x20).push(0).op(vm.KECCAK256)
+	a.op(vm.DUP3, vm.ADD, vm.SSTORE)
+	a.push(1).op(vm.ADD, vm.DUP1).push(factoryAllPairsSlot).op(vm.SSTORE)
+	a.mstore(memLength)
+
+	a.mload(memToken1).mload(memToken0).push(pairCreatedTopic).push(0x40).push(memPair).op(vm.LOG3)
+	a.push(0x20).push(memPair).op(vm.RETURN)
+
+	a.label("getPair(address,address)")
+	a.arg(0).mstore(memToken0)
+	a.arg(1).mstore(memToken1)
+	a.nestedMappingSlot(memToken0, memToken1, factoryGetPairSlot).op(vm.SLOAD).returnTop()
+
+	a.label("allPairs(uint256)")
+	a.arg(0).op(vm.DUP1).push(factoryAllPairsSlot).op(vm.SLOAD, vm.GT).jumpi("allPairsIndex")
+	a.op(vm.POP).push(0).op(vm.DUP1, vm.REVERT)
+	a.label("allPairsIndex")
+	a.push(factoryAllPairsSlot).mstore(0).push(0x20).push(0).op(vm.KECCAK256, vm.ADD, vm.SLOAD).returnTop()
+
+	a.label("allPairsLength()").push(factoryAllPairsSlot).op(vm.SLOAD).returnTop()
+	a.label("INIT_CODE_PAIR_HASH()").push(crypto.Keccak256Hash(pairCode)).returnTop()
+
+	a.label("identical").revertReason("UniswapV2: IDENTICAL_ADDRESSES")
+	a.label("zeroAddress").revertReason("UniswapV2: ZERO_ADDRESS")
+	a.label("pairExists").revertReason("UniswapV2: PAIR_EXISTS")
+	a.bubbleRevert("callFailed")
+	a.data("pairCode", pairCode)
+	return a.bytes()
+}
+
+// router 内存布局
+const (
+	memAmountIn   = 0x80
+	memPathIn     = 0xa0
+	memPathOut    = 0xc0
+	memRouterPair = 0xe0
+	memReserveIn  = 0x100
+	memReserveOut = 0x120
+	memAmountOut  = 0x140
+	memMode       = 0x160
+	memAmounts    = 0x500
+)
+
+// UniswapRouterCode 返回路由的部署代码, 只支持长度为 2 的兑换路径
+func UniswapRouterCode(factory common.Address) []byte {
+	return initCode(nil, uniswapRouterRuntime(factory))
+}
+
+func uniswapRouterRuntime(factory common.Address) []byte {
+	a := newAssembler()
+	a.dispatch(
+		"factory()", "getAmountOut(uint256,uint256,uint256)", "getAmountsOut(uint256,address[])",
+		"swapExactTokensForTokens(uint256,uint256,address[],address,uint256)",
+	)
+
+	a.label("factory()").push(factory).returnTop()
+
+	a.label("getAmountOut(uint256,uint256,uint256)")
+	a.arg(0).mstore(memAmountIn)
+	a.arg(1).mstore(memReserveIn)
+	a.arg(2).mstore(memReserveOut)
+	routerAmountOut(a)
+	a.mload(memAmountOut).returnTop()
+
+	a.label("getAmountsOut(uint256,address[])")
+	a.push(0).mstore(memMode)
+	a.arg(0).mstore(memAmountIn)
+	routerPath(a, 1)
+	a.jump("quote")
+
+	a.label("swapExactTokensForTokens(uint256,uint256,address[],address,uint256)")
+	a.push(1).mstore(memMode)
+	a.arg(0).mstore(memAmountIn)
+	routerPath(a, 2)
+	a.arg(4).op(vm.TIMESTAMP, vm.GT).jumpi("expired")
+	a.jump("quote")
+
+	// quote 查询交易对和储备量, 计算 amountOut
+	a.label("quote")
+	a.pushWord(selector("getPair(address,address)")).mstore(memCall)
+	a.mload(memPathIn).mstore(memCall + 4)
+	a.mload(memPathOut).mstore(memCall + 0x24)
+	a.push(0x20).push(memCallResult).push(0x44).push(memCall).push(factory).op(vm.GAS, vm.STATICCALL)
+	a.op(vm.ISZERO).jumpi("callFailed")
+	a.mload(memCallResult).op(vm.DUP1, vm.ISZERO).jumpi("noPair")
+	a.mstore(memRouterPair)
+
+	a.pushWord(selector("getReserves()")).mstore(memCall)
+	a.push(0x60).push(memCallResult).push(4).push(memCall).mload(memRouterPair).op(vm.GAS, vm.STATICCALL)
+	a.op(vm.ISZERO).jumpi("callFailed")
+	a.mload(memPathOut).mload(memPathIn).op(vm.LT).jumpi("inIsToken0")
+	a.mload(memCallResult + 0x20).mstore(memReserveIn)
+	a.mload(memCallResult).mstore(memReserveOut)
+	a.jump("reservesDone")
+	a.label("inIsToken0")
+	a.mload(memCallResult).mstore(memReserveIn)
+	a.mload(memCallResult + 0x20).mstore(memReserveOut)
+	a.label("reservesDone")
+	routerAmountOut(a)
+	a.mload(memMode).jumpi("swap")
+
+	a.label("returnAmounts")
+	a.push(0x20).mstore(memAmounts)
+	a.push(2).mstore(memAmounts + 0x20)
+	a.mload(memAmountIn).mstore(memAmounts + 0x40)
+	a.mload(memAmountOut).mstore(memAmounts + 0x60)
+	a.push(0x80).push(memAmounts).op(vm.RETURN)
+
+	a.label("swap")
+	a.arg(1).mload(memAmountOut).op(vm.LT).jumpi("insufficientOutput")
+
+	// transferFrom(msg.sender, pair, amountIn)
+	a.pushWord(selector("transferFrom(address,address,uint256)")).mstore(memCall)
+	a.op(vm.CALLER).mstore(memCall + 4)
+	a.mload(memRouterPair).mstore(memCall + 0x24)
+	a.mload(memAmountIn).mstore(memCall + 0x44)
+	a.push(0x20).push(memCallResult).push(0x64).push(memCall).push(0).mload(memPathIn).op(vm.GAS, vm.CALL)
+	a.op(vm.ISZERO).jumpi("callFailed")
+
+	// swap(amount0Out, amount1Out, to, "")
+	a.pushWord(selector("swap(uint256,uint256,address,bytes)")).mstore(memCall)
+	a.push(0).mstore(memCall + 4)
+	a.push(0).mstore(memCall + 0x24)
+	a.mload(memPathOut).mload(memPathIn).op(vm.LT).jumpi("outIsToken1")
+	a.mload(memAmountOut).mstore(memCall + 4)
+	a.jump("outDone")
+	a.label("outIsToken1")
+	a.mload(memAmountOut).mstore(memCall + 0x24)
+	a.label("outDone")
+	a.arg(3).mstore(memCall + 0x44)
+	a.push(0x80).mstore(memCall + 0x64)
+	a.push(0).mstore(memCall + 0x84)
+	a.push(0).push(0).push(0xa4).push(memCall).push(0).mload(memRouterPair).op(vm.GAS, vm.CALL)
+	a.op(vm.ISZERO).jumpi("callFailed")
+	a.jump("returnAmounts")
+
+	a.label("invalidPath").revertReason("UniswapV2Library: INVALID_PATH")
+	a.label("noPair").revertReason("UniswapV2Library: PAIR_NOT_FOUND")
+	a.label("insufficientInputAmount").revertReason("UniswapV2Library: INSUFFICIENT_INPUT_AMOUNT")
+	a.label("insufficientLiquidity").revertReason("UniswapV2Library: INSUFFICIENT_LIQUIDITY")
+	a.label("insufficientOutput").revertReason("UniswapV2Router: INSUFFICIENT_OUTPUT_AMOUNT")
+	a.label("expired").revertReason("UniswapV2Router: EXPIRED")
+	a.bubbleRevert("callFailed")
+	return a.bytes()
+}
+
+// routerPath 读取第 index 个参数指向的 address[], 长度必须为 2
+func routerPath(a *assembler, index int) {
+	a.arg(index).push(4).op(vm.ADD)
+	a.op(vm.DUP1, vm.CALLDATALOAD).push(2).op(vm.EQ, vm.ISZERO).jumpi("invalidPath")
+	a.op(vm.DUP1).push(0x20).op(vm.ADD, vm.CALLDATALOAD).mstore(memPathIn)
+	a.push(0x40).op(vm.ADD, vm.CALLDATALOAD).mstore(memPathOut)
+}
+
+// routerAmountOut amountOut = amountIn * 997 * reserveOut / (reserveIn * 1000 + amountIn * 997)
+func routerAmountOut(a *assembler) {
+	a.mload(memAmountIn).op(vm.ISZERO).jumpi("insufficientInputAmount")
+	a.mload(memReserveIn).op(vm.ISZERO).jumpi("insufficientLiquidity")
+	a.mload(memReserveOut).op(vm.ISZERO).jumpi("insufficientLiquidity")
+	a.push(997).mload(memAmountIn).op(vm.MUL)
+	a.op(vm.DUP1).mload(memReserveOut).op(vm.MUL)
+	a.op(vm.SWAP1).push(1000).mload(memReserveIn).op(vm.MUL, vm.ADD)
+	a.op(vm.SWAP1, vm.DIV)
+	a.mstore(memAmountOut)
+}
+
+// mappingKey 计算 mapping 元素的存储位置 keccak256(key . slot)
+func mappingKey(key common.Hash, slot int64) common.Hash {
+	return crypto.Keccak256Hash(key.Bytes(), common.BigToHash(big.NewInt(slot)).Bytes())
+}
+
+// PairAddress 按 CREATE2 规则计算交易对地址
+func PairAddress(factory common.Address, tokenA common.Address, tokenB common.Address) common.Address {
+	token0, token1 := SortTokens(tokenA, tokenB)
+	salt := crypto.Keccak256Hash(token0.Hash().Bytes(), token1.Hash().Bytes())
+	return crypto.CreateAddress2(factory, salt, UniswapPairCodeHash().Bytes())
+}
+
+// SortTokens 按地址大小排序, 与 UniswapV2Library.sortTokens 一致
+func SortTokens(tokenA common.Address, tokenB common.Address) (common.Address, common.Address) {
+	if new(big.Int).SetBytes(tokenA.Bytes()).Cmp(new(big.Int).SetBytes(tokenB.Bytes())) < 0 {
+		return tokenA, tokenB
+	}
+	return tokenB, tokenA
+}